@@ -38,3 +38,9 @@ Wallet server rest
 */
 CREATE USER 'edgeagent'@'%' IDENTIFIED BY 'edgeagent-secret-pw';
 GRANT ALL PRIVILEGES ON `edgeagent\_%`.* TO 'edgeagent'@'%';
+
+/*
+Mock adapter
+*/
+CREATE USER 'mockadapter'@'%' IDENTIFIED BY 'mockadapter-secret-pw';
+GRANT ALL PRIVILEGES ON `mockadapter\_%`.* TO 'mockadapter'@'%';
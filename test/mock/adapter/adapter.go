@@ -16,39 +16,37 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/jsonld"
-	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite"
-	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite/ed25519signature2018"
-
-	"github.com/btcsuite/btcutil/base58"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/piprate/json-gold/ld"
 	"github.com/square/go-jose/jwt"
 
-	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
 	"github.com/hyperledger/aries-framework-go/pkg/client/didexchange"
 	"github.com/hyperledger/aries-framework-go/pkg/client/outofband"
 	"github.com/hyperledger/aries-framework-go/pkg/client/outofbandv2"
 	"github.com/hyperledger/aries-framework-go/pkg/client/presentproof"
 	"github.com/hyperledger/aries-framework-go/pkg/common/log"
+	ariescrypto "github.com/hyperledger/aries-framework-go/pkg/crypto"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/decorator"
+	didexchangesvc "github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/didexchange"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/issuecredential"
 	presentproofsvc "github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/presentproof"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/transport"
 	"github.com/hyperledger/aries-framework-go/pkg/doc/cm"
 	"github.com/hyperledger/aries-framework-go/pkg/doc/presexch"
 	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/hyperledger/aries-framework-go/pkg/store/connection"
 	arieslog "github.com/hyperledger/aries-framework-go/spi/log"
 	"github.com/hyperledger/aries-framework-go/spi/storage"
 )
 
-var pdBytes []byte
-
 const (
 	// issuer html templates
 	issuerHTML          = "./templates/issuer/issuer.html"
@@ -72,14 +70,24 @@ const (
 	kid      = "did:key:z6MknC1wwS6DEYwtGbZZo2QvjQjkh2qSBjb4GYmbye8dv4S5#z6MknC1wwS6DEYwtGbZZo2QvjQjkh2qSBjb4GYmbye8dv4S5"
 )
 
+// defaultIssuerPath is the path of did:web DID document of the default issuer key.
+const defaultIssuerPath = "issuer"
+
 var logger = log.New("mock-adapter")
 
 type issuerConfiguration struct {
-	Issuer                string          `json:"issuer"`
-	AuthorizationEndpoint string          `json:"authorization_endpoint"`
-	CredentialEndpoint    string          `json:"credential_endpoint"`
-	TokenEndpoint         string          `json:"token_endpoint"`
-	CredentialManifests   json.RawMessage `json:"credential_manifests"`
+	Issuer                            string                          `json:"issuer"`
+	AuthorizationEndpoint             string                          `json:"authorization_endpoint"`
+	CredentialEndpoint                string                          `json:"credential_endpoint"`
+	TokenEndpoint                     string                          `json:"token_endpoint"`
+	CredentialManifests               json.RawMessage                 `json:"credential_manifests"`
+	GrantTypesSupported               []string                        `json:"grant_types_supported,omitempty"`
+	BatchCredentialEndpoint           string                          `json:"batch_credential_endpoint,omitempty"`
+	DeferredCredentialEndpoint        string                          `json:"deferred_credential_endpoint,omitempty"`
+	CredentialsSupported              map[string]*supportedCredential `json:"credentials_supported,omitempty"`
+	Display                           []*issuerDisplay                `json:"display,omitempty"`
+	TokenEndpointAuthMethodsSupported []string                        `json:"token_endpoint_auth_methods_supported,omitempty"`
+	CodeChallengeMethodsSupported     []string                        `json:"code_challenge_methods_supported,omitempty"`
 }
 
 // waciIssuanceData contains state of WACI demo.
@@ -87,24 +95,94 @@ type waciIssuanceData struct {
 	CredentialManifest json.RawMessage `json:"credential_manifest"`
 	CredentialResponse json.RawMessage `json:"credential_response"`
 	Credential         json.RawMessage `json:"credential"`
+	// IssuerKey signs the credential, nil for the default issuer key.
+	IssuerKey     *issuerKey   `json:"issuer_key,omitempty"`
+	Proof         *proofFormat `json:"proof,omitempty"`
+	StatusPurpose string       `json:"status_purpose,omitempty"`
+	SessionID     string       `json:"session_id,omitempty"`
+	// Challenge and Domain are sent in the options of the credential offer, the credential application must be signed
+	// with them.
+	Challenge string `json:"challenge,omitempty"`
+	Domain    string `json:"domain,omitempty"`
+}
+
+// waciShareData contains state of WACI share demo.
+type waciShareData struct {
+	PresentationDefinition json.RawMessage           `json:"presentation_definition"`
+	Challenge              string                    `json:"challenge,omitempty"`
+	Domain                 string                    `json:"domain,omitempty"`
+	Presentation           json.RawMessage           `json:"presentation,omitempty"`
+	Verification           *presentationVerification `json:"verification,omitempty"`
+	SessionID              string                    `json:"session_id,omitempty"`
+	// RequestFirst sessions send the presentation request once the DID exchange completes rather than in response to
+	// a proposal.
+	RequestFirst bool `json:"request_first,omitempty"`
+}
+
+// oidcShareData contains state of OIDC share demo.
+type oidcShareData struct {
+	PresentationDefinition json.RawMessage `json:"presentation_definition"`
+	Nonce                  string          `json:"nonce"`
 }
 
 type adapterApp struct {
-	agent *didComm
-	store storage.Store
+	agent          *didComm
+	store          storage.Store
+	presVerifier   *presentationVerifier
+	documentLoader ld.DocumentLoader
+	clients        map[string]*oauthClient
+	users          map[string]*issuerUser
+	kms            kms.KeyManager
+	crypto         ariescrypto.Crypto
+	orbIssuerKey   *issuerKey
+	// issuerKey is the signing identity of issuers initiated without one, nil for the built-in did:key.
+	issuerKey *issuerKey
+	// statusListMutex serializes allocation and updates of status list entries.
+	statusListMutex sync.Mutex
+	// adminToken, if set, is the bearer token required by the admin API.
+	adminToken string
+	// sessionMutex serializes updates of sessions reported by the control API.
+	sessionMutex sync.Mutex
+	events       *eventBroker
 }
 
-func startAdapterApp(agent *didComm, router *mux.Router) error {
+func startAdapterApp(agent *didComm, storeProvider storage.Provider, router *mux.Router) error {
 	log.SetLevel("", arieslog.DEBUG)
 
-	prov := mem.NewProvider()
-
-	store, err := prov.OpenStore("verifier")
+	store, err := storeProvider.OpenStore("verifier")
 	if err != nil {
 		return fmt.Errorf("failed to create store : %w", err)
 	}
 
-	app := adapterApp{agent: agent, store: store}
+	clients, err := loadOAuthClients(os.Getenv(oidcClientsFileEnvKey))
+	if err != nil {
+		return fmt.Errorf("failed to load OIDC clients : %w", err)
+	}
+
+	users, err := loadIssuerUsers(os.Getenv(issuerUsersFileEnvKey))
+	if err != nil {
+		return fmt.Errorf("failed to load issuer users : %w", err)
+	}
+
+	app := adapterApp{
+		agent:          agent,
+		store:          newExpiringStore(store),
+		presVerifier:   newPresentationVerifier(agent.VDRegistry, agent.DocumentLoader),
+		documentLoader: agent.DocumentLoader,
+		clients:        clients,
+		users:          users,
+		kms:            agent.KMS,
+		crypto:         agent.Crypto,
+		orbIssuerKey:   agent.OrbIssuerKey,
+		adminToken:     os.Getenv(adminTokenEnvKey),
+		events:         newEventBroker(),
+	}
+
+	app.issuerKey, err = app.startupIssuerKey(os.Getenv(issuerKeyTypeEnvKey), os.Getenv(issuerDIDMethodEnvKey),
+		os.Getenv(demoExternalURLEnvKey))
+	if err != nil {
+		return fmt.Errorf("failed to create issuer key : %w", err)
+	}
 
 	actionCh := make(chan service.DIDCommAction)
 
@@ -123,7 +201,29 @@ func startAdapterApp(agent *didComm, router *mux.Router) error {
 		return fmt.Errorf("failed to register action events on issue-credential-client : %w", err)
 	}
 
-	go listenForDIDCommMsg(actionCh, store)
+	connectionCh := make(chan service.StateMsg)
+
+	err = agent.DIDExchClient.RegisterMsgEvent(connectionCh)
+	if err != nil {
+		return fmt.Errorf("failed to register message events on didexchange-client : %w", err)
+	}
+
+	stateCh := make(chan service.StateMsg)
+
+	err = agent.PresentProofClient.RegisterMsgEvent(stateCh)
+	if err != nil {
+		return fmt.Errorf("failed to register message events on present-proof-client : %w", err)
+	}
+
+	err = agent.IssueCredentialClient.RegisterMsgEvent(stateCh)
+	if err != nil {
+		return fmt.Errorf("failed to register message events on issue-credential-client : %w", err)
+	}
+
+	go app.listenForDIDCommMsg(actionCh)
+	go app.listenForProblemReports(stateCh)
+	go app.listenForConnections(connectionCh)
+	go app.sweepExpiredRecordsPeriodically(sweepInterval)
 
 	// issuer routes
 	router.HandleFunc("/issuer", app.issuer)
@@ -134,11 +234,23 @@ func startAdapterApp(agent *didComm, router *mux.Router) error {
 	router.HandleFunc("/issuer/oidc", app.oidcIssuer)
 	router.HandleFunc("/issuer/oidc/login", app.oidcIssuerLogin)
 	router.HandleFunc("/issuer/oidc/issuance", app.initiateIssuance).Methods(http.MethodPost)
+	router.HandleFunc("/{id}/did.json", app.webDIDDocument).Methods(http.MethodGet)
+	router.HandleFunc("/status/{id}", app.statusListCredential).Methods(http.MethodGet)
+	router.HandleFunc("/admin/credential-status", app.updateCredentialStatus).Methods(http.MethodPost)
+	router.HandleFunc("/api/sessions", app.createSession).Methods(http.MethodPost)
+	router.HandleFunc("/api/sessions/{id}", app.getSession).Methods(http.MethodGet)
+	router.HandleFunc("/api/events", app.streamEvents).Methods(http.MethodGet)
 	router.HandleFunc("/{id}/.well-known/openid-configuration", app.wellKnownConfiguration).Methods(http.MethodGet)
+	router.HandleFunc("/{id}/.well-known/openid-credential-issuer",
+		app.wellKnownCredentialIssuer).Methods(http.MethodGet)
 	router.HandleFunc("/{id}/issuer/oidc/authorize", app.issuerAuthorize).Methods(http.MethodGet)
 	router.HandleFunc("/issuer/oidc/authorize-request", app.issuerSendAuthorizeResponse).Methods(http.MethodPost)
 	router.HandleFunc("/{id}/issuer/oidc/token", app.issuerTokenEndpoint).Methods(http.MethodPost)
 	router.HandleFunc("/{id}/issuer/oidc/credential", app.issuerCredentialEndpoint).Methods(http.MethodPost)
+	router.HandleFunc("/{id}/issuer/oidc/batch_credential",
+		app.issuerBatchCredentialEndpoint).Methods(http.MethodPost)
+	router.HandleFunc("/{id}/issuer/oidc/deferred_credential",
+		app.issuerDeferredCredentialEndpoint).Methods(http.MethodPost)
 
 	// verifier routes
 	router.HandleFunc("/verifier", app.verifier)
@@ -195,85 +307,160 @@ func (v *adapterApp) webWallet(w http.ResponseWriter, r *http.Request) {
 func (v *adapterApp) waciShare(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 
-	// generate OOB invitation
-	inv, err := v.agent.OOBClient.CreateInvitation(nil,
-		outofband.WithAccept(transport.MediaTypeAIP2RFC0019Profile, transport.MediaTypeProfileDIDCommAIP1),
-		outofband.WithGoal("share-vp", "streamlined-vp"))
-	if err != nil {
-		handleError(w, http.StatusInternalServerError,
-			fmt.Sprintf("failed to create oob invitation : %s", err))
-
-		return
+	if session := v.createWACIShareSession(w, r, false); session != nil {
+		http.Redirect(w, r, session.URL, http.StatusFound)
 	}
-
-	pdBytes = []byte(r.FormValue("pEx"))
-
-	v.waciInvitationRedirect(w, r, inv)
 }
 
 func (v *adapterApp) waciShareV2(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 
-	// generate OOB V2 invitation
-	inv, err := v.agent.OOBV2Client.CreateInvitation(
-		outofbandv2.WithAccept(transport.MediaTypeDIDCommV2Profile, transport.MediaTypeAIP2RFC0587Profile),
-		outofbandv2.WithFrom(v.agent.OrbDIDV2), outofbandv2.WithGoal("share-vp", "streamlined-vp"))
-	if err != nil {
-		handleError(w, http.StatusInternalServerError,
-			fmt.Sprintf("failed to create oob invitation : %s", err))
-
-		return
+	if session := v.createWACIShareSession(w, r, true); session != nil {
+		http.Redirect(w, r, session.URL, http.StatusFound)
 	}
+}
 
-	pdBytes = []byte(r.FormValue("pEx"))
+func (v *adapterApp) waciIssuance(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
 
-	v.waciInvitationRedirect(w, r, inv)
+	v.submitWACIIssuerForm(w, r, false)
 }
 
-func (v *adapterApp) waciIssuance(w http.ResponseWriter, r *http.Request) {
+func (v *adapterApp) waciIssuanceV2(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 
-	// generate OOB invitation
-	inv, err := v.agent.OOBClient.CreateInvitation(nil,
-		outofband.WithGoal("issue-vc", "streamlined-vc"),
-		outofband.WithAccept(transport.MediaTypeAIP2RFC0019Profile, transport.MediaTypeProfileDIDCommAIP1))
+	v.submitWACIIssuerForm(w, r, true)
+}
+
+// submitWACIIssuerForm starts WACI issuance of the issuer page form. Credentials that do not fit the credential
+// manifest are sent back to the form with the error and the input of the user.
+func (v *adapterApp) submitWACIIssuerForm(w http.ResponseWriter, r *http.Request, didCommV2 bool) {
+	manifest, response, err := v.prepareWACIIssuance(r)
 	if err != nil {
-		handleError(w, http.StatusInternalServerError,
-			fmt.Sprintf("failed to create oob invitation : %s", err))
+		form := make(map[string]string, len(r.Form))
+		for name := range r.Form {
+			form[name] = r.Form.Get(name)
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		loadTemplate(w, waciIssuerHTML, map[string]interface{}{"ErrMsg": "ERROR: " + err.Error(), "Form": form})
 
 		return
 	}
 
-	v.persistWACIIssuanceData(w, r, inv.ID)
-	v.waciInvitationRedirect(w, r, inv)
+	if session := v.createWACIIssuanceSession(w, r, didCommV2, manifest, response); session != nil {
+		http.Redirect(w, r, session.URL, http.StatusFound)
+	}
 }
 
-func (v *adapterApp) waciIssuanceV2(w http.ResponseWriter, r *http.Request) {
-	r.ParseForm()
+// createWACIShareSession creates a WACI share session with an OOB invitation of given DIDComm version, errors are
+// written to the response.
+func (v *adapterApp) createWACIShareSession(w http.ResponseWriter, r *http.Request, didCommV2 bool) *sessionData {
+	var (
+		inv   interface{}
+		invID string
+	)
+
+	// OOB V2 connections have no DID exchange, the adapter only learns of them when the wallet sends its first
+	// message, which is a proposal.
+	if didCommV2 && r.FormValue("requestFirst") == "true" {
+		handleError(w, http.StatusBadRequest, "request-presentation-first requires a DIDComm V1 invitation")
+
+		return nil
+	}
+
+	if didCommV2 {
+		// generate OOB V2 invitation
+		invV2, err := v.agent.OOBV2Client.CreateInvitation(
+			outofbandv2.WithAccept(transport.MediaTypeDIDCommV2Profile, transport.MediaTypeAIP2RFC0587Profile),
+			outofbandv2.WithFrom(v.agent.OrbDIDV2), outofbandv2.WithGoal("share-vp", "streamlined-vp"))
+		if err != nil {
+			handleError(w, http.StatusInternalServerError,
+				fmt.Sprintf("failed to create oob invitation : %s", err))
+
+			return nil
+		}
+
+		inv, invID = invV2, invV2.ID
+	} else {
+		// generate OOB invitation
+		invV1, err := v.agent.OOBClient.CreateInvitation(nil,
+			outofband.WithAccept(transport.MediaTypeAIP2RFC0019Profile, transport.MediaTypeProfileDIDCommAIP1),
+			outofband.WithGoal("share-vp", "streamlined-vp"))
+		if err != nil {
+			handleError(w, http.StatusInternalServerError,
+				fmt.Sprintf("failed to create oob invitation : %s", err))
 
-	// generate OOB V2 invitation
-	inv, err := v.agent.OOBV2Client.CreateInvitation(outofbandv2.WithAccept(transport.MediaTypeDIDCommV2Profile),
-		outofbandv2.WithFrom(v.agent.OrbDIDV2), outofbandv2.WithGoal("issue-vc", "streamlined-vc"))
+			return nil
+		}
+
+		inv, invID = invV1, invV1.ID
+	}
+
+	err := v.persistWACIShareData(r, invID)
 	if err != nil {
 		handleError(w, http.StatusInternalServerError,
-			fmt.Sprintf("failed to create oob invitation : %s", err))
+			fmt.Sprintf("failed to persist waci share data : %s", err))
 
-		return
+		return nil
 	}
 
-	v.persistWACIIssuanceData(w, r, inv.ID)
-	v.waciInvitationRedirect(w, r, inv)
+	return v.createWACISession(w, r, sessionTypeWACIShare, invID, inv)
 }
 
-func (v *adapterApp) waciInvitationRedirect(w http.ResponseWriter, r *http.Request, inv interface{}) {
-	r.ParseForm()
+// createWACIIssuanceSession creates a WACI issuance session of the prepared manifest and credential response with an
+// OOB invitation of given DIDComm version, errors are written to the response.
+func (v *adapterApp) createWACIIssuanceSession(w http.ResponseWriter, r *http.Request, didCommV2 bool,
+	manifest *cm.CredentialManifest, response json.RawMessage) *sessionData {
+	var (
+		inv   interface{}
+		invID string
+	)
+
+	if didCommV2 {
+		// generate OOB V2 invitation
+		invV2, err := v.agent.OOBV2Client.CreateInvitation(outofbandv2.WithAccept(transport.MediaTypeDIDCommV2Profile),
+			outofbandv2.WithFrom(v.agent.OrbDIDV2), outofbandv2.WithGoal("issue-vc", "streamlined-vc"))
+		if err != nil {
+			handleError(w, http.StatusInternalServerError,
+				fmt.Sprintf("failed to create oob invitation : %s", err))
+
+			return nil
+		}
+
+		inv, invID = invV2, invV2.ID
+	} else {
+		// generate OOB invitation
+		invV1, err := v.agent.OOBClient.CreateInvitation(nil,
+			outofband.WithGoal("issue-vc", "streamlined-vc"),
+			outofband.WithAccept(transport.MediaTypeAIP2RFC0019Profile, transport.MediaTypeProfileDIDCommAIP1))
+		if err != nil {
+			handleError(w, http.StatusInternalServerError,
+				fmt.Sprintf("failed to create oob invitation : %s", err))
+
+			return nil
+		}
+
+		inv, invID = invV1, invV1.ID
+	}
+
+	if !v.persistWACIIssuanceData(w, r, invID, manifest, response) {
+		return nil
+	}
+
+	return v.createWACISession(w, r, sessionTypeWACIIssuance, invID, inv)
+}
 
+// createWACISession saves session of given OOB invitation, the wallet is sent to the walletURL with the invitation.
+func (v *adapterApp) createWACISession(w http.ResponseWriter, r *http.Request, sessionType, invID string,
+	inv interface{}) *sessionData {
 	invBytes, err := json.Marshal(inv)
 	if err != nil {
 		handleError(w, http.StatusInternalServerError,
 			fmt.Sprintf("failed to marshal invitation : %s", err))
 
-		return
+		return nil
 	}
 
 	redirectURL := fmt.Sprintf("%s/waci?oob=%s", r.FormValue("walletURL"),
@@ -281,52 +468,170 @@ func (v *adapterApp) waciInvitationRedirect(w http.ResponseWriter, r *http.Reque
 
 	logger.Infof("waci redirect : url=%s oob-invitation=%s", redirectURL, string(invBytes))
 
-	http.Redirect(w, r, redirectURL, http.StatusFound)
+	return v.saveNewSession(w, invID, sessionType, redirectURL, invBytes)
+}
+
+// prepareWACIIssuance validates the credential manifest and the credential to issue, and returns the manifest with
+// the credential response mapping the credential to its output descriptor.
+func (v *adapterApp) prepareWACIIssuance(r *http.Request) (*cm.CredentialManifest, json.RawMessage, error) {
+	manifest, err := parseCredentialManifest([]byte(r.FormValue("credManifest")))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vc, err := verifiable.ParseCredential([]byte(r.FormValue("credToIssue")), verifiable.WithDisabledProofCheck(),
+		verifiable.WithJSONLDDocumentLoader(v.documentLoader))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid credential to issue : %w", err)
+	}
+
+	response, err := manifestCredentialResponse(manifest, vc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("credential to issue does not fit the credential manifest : %w", err)
+	}
+
+	return manifest, response, nil
 }
 
-func (v *adapterApp) persistWACIIssuanceData(w http.ResponseWriter, r *http.Request, invID string) {
+// persistWACIIssuanceData saves state of the WACI issuance session of given invitation, errors are written to the
+// response.
+func (v *adapterApp) persistWACIIssuanceData(w http.ResponseWriter, r *http.Request, invID string,
+	manifest *cm.CredentialManifest, response json.RawMessage) bool {
+	signingKey, err := v.sessionIssuerKey(r, invID)
+	if err != nil {
+		handleError(w, http.StatusBadRequest,
+			fmt.Sprintf("failed to create issuer key : %s", err))
+
+		return false
+	}
+
+	proof, err := sessionProofFormat(r, signingKey)
+	if err != nil {
+		handleError(w, http.StatusBadRequest,
+			fmt.Sprintf("invalid proof format : %s", err))
+
+		return false
+	}
+
+	err = checkManifestProofType(manifest, proof.signatureType(signingKeyType(signingKey)))
+	if err != nil {
+		handleError(w, http.StatusBadRequest,
+			fmt.Sprintf("invalid proof format : %s", err))
+
+		return false
+	}
+
+	statusPurpose, err := sessionStatusPurpose(r)
+	if err != nil {
+		handleError(w, http.StatusBadRequest,
+			fmt.Sprintf("invalid credential status : %s", err))
+
+		return false
+	}
+
 	waciData, err := json.Marshal(&waciIssuanceData{
-		CredentialResponse: []byte(r.FormValue("response")),
+		CredentialResponse: response,
 		CredentialManifest: []byte(r.FormValue("credManifest")),
 		Credential:         []byte(r.FormValue("credToIssue")),
+		IssuerKey:          signingKey,
+		Proof:              proof,
+		StatusPurpose:      statusPurpose,
+		SessionID:          invID,
 	})
 	if err != nil {
 		handleError(w, http.StatusInternalServerError,
 			fmt.Sprintf("failed to persist waci data : %s", err))
 
-		return
+		return false
 	}
 
-	err = v.store.Put(getWACIIssuanceDataStoreKeyPrefix(invID), waciData)
+	err = putWithLifetime(v.store, getWACIIssuanceDataStoreKeyPrefix(invID), waciData, sessionLifetime)
 	if err != nil {
 		handleError(w, http.StatusInternalServerError,
 			fmt.Sprintf("failed to persist waci data : %s", err))
 
-		return
+		return false
 	}
 
 	logger.Infof("waci redirect :data=%s invitationID=%s", string(waciData), invID)
+
+	return true
+}
+
+func (v *adapterApp) persistWACIShareData(r *http.Request, invID string) error {
+	pd := presexch.PresentationDefinition{}
+
+	err := json.Unmarshal([]byte(r.FormValue("pEx")), &pd)
+	if err != nil {
+		return fmt.Errorf("invalid presentation definition : %w", err)
+	}
+
+	err = requestProofFormat(r, &pd)
+	if err != nil {
+		return err
+	}
+
+	pdBytes, err := json.Marshal(&pd)
+	if err != nil {
+		return err
+	}
+
+	return saveWACIShareData(v.store, invID, &waciShareData{
+		PresentationDefinition: pdBytes,
+		SessionID:              invID,
+		RequestFirst:           r.FormValue("requestFirst") == "true",
+	})
 }
 
 func (v *adapterApp) waciShareCallback(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	_, err := v.store.Get(id)
-	if err != nil {
+	// declined actions pass their problem, the share data is not saved for threads stopped on the proposal.
+	problem := problemFromQuery(r.URL.Query())
+
+	shareData, err := readWACIShareData(v.store, id, "")
+	if err != nil && problem == "" {
 		handleError(w, http.StatusInternalServerError,
 			fmt.Sprintf("failed to get interaction data : %s", err))
 
 		return
 	}
 
-	loadTemplate(w, waciVerifierHTML, map[string]interface{}{"Msg": "Successfully Received Presentation"})
+	if err != nil || shareData.Verification == nil {
+		if problem == "" {
+			problem = "Presentation not received"
+		}
+
+		loadTemplate(w, waciVerifierHTML, map[string]interface{}{"ErrMsg": problem})
+
+		return
+	}
+
+	data := map[string]interface{}{
+		"Checks":       shareData.Verification.Checks,
+		"Presentation": string(shareData.Presentation),
+	}
+
+	if shareData.Verification.Verified() {
+		data["Msg"] = "Successfully Received Presentation"
+	} else {
+		data["ErrMsg"] = "ERROR: presentation verification failed"
+	}
+
+	loadTemplate(w, waciVerifierHTML, data)
 }
 
 func (v *adapterApp) waciIssuanceCallback(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
+	if problem := problemFromQuery(r.URL.Query()); problem != "" {
+		loadTemplate(w, waciIssuerHTML, map[string]interface{}{"ErrMsg": problem})
+
+		return
+	}
+
 	_, err := v.store.Get(id)
 	if err != nil {
 		handleError(w, http.StatusInternalServerError,
@@ -341,8 +646,16 @@ func (v *adapterApp) waciIssuanceCallback(w http.ResponseWriter, r *http.Request
 func (v *adapterApp) oidcShare(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 
+	if session := v.createOIDCShareSession(w, r); session != nil {
+		http.Redirect(w, r, session.URL, http.StatusFound)
+	}
+}
+
+// createOIDCShareSession creates an OIDC share session identified by the state of the authorization request sent to
+// the wallet, errors are written to the response.
+func (v *adapterApp) createOIDCShareSession(w http.ResponseWriter, r *http.Request) *sessionData {
 	walletAuthURL := r.FormValue("walletAuthURL")
-	pdBytes = []byte(r.FormValue("pEx"))
+	pdBytes := []byte(r.FormValue("pEx"))
 
 	var pd *presexch.PresentationDefinition
 	err := json.Unmarshal(pdBytes, &pd)
@@ -350,7 +663,23 @@ func (v *adapterApp) oidcShare(w http.ResponseWriter, r *http.Request) {
 		handleError(w, http.StatusInternalServerError,
 			fmt.Sprintf("failed to unmarshal presentation definition : %s", err))
 
-		return
+		return nil
+	}
+
+	err = requestProofFormat(r, pd)
+	if err != nil {
+		handleError(w, http.StatusBadRequest,
+			fmt.Sprintf("invalid proof format : %s", err))
+
+		return nil
+	}
+
+	pdBytes, err = json.Marshal(pd)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError,
+			fmt.Sprintf("failed to marshal presentation definition : %s", err))
+
+		return nil
 	}
 
 	authClaims := &OIDCAuthClaims{
@@ -364,10 +693,20 @@ func (v *adapterApp) oidcShare(w http.ResponseWriter, r *http.Request) {
 		handleError(w, http.StatusInternalServerError,
 			fmt.Sprintf("failed to unmarshal invitation : %s", err))
 
-		return
+		return nil
+	}
+
+	// client metadata advertising formats the verifier accepts.
+	registrationBytes, err := json.Marshal(map[string]interface{}{"vp_formats": verifierFormats(pd)})
+	if err != nil {
+		handleError(w, http.StatusInternalServerError,
+			fmt.Sprintf("failed to marshal client metadata : %s", err))
+
+		return nil
 	}
 
 	state := uuid.NewString()
+	nonce := uuid.NewString()
 
 	// TODO: use OIDC client library
 	// construct wallet auth req with PEx
@@ -376,7 +715,7 @@ func (v *adapterApp) oidcShare(w http.ResponseWriter, r *http.Request) {
 		handleError(w, http.StatusInternalServerError,
 			fmt.Sprintf("failed to get interaction data : %s", err))
 
-		return
+		return nil
 	}
 
 	q := req.URL.Query()
@@ -384,7 +723,9 @@ func (v *adapterApp) oidcShare(w http.ResponseWriter, r *http.Request) {
 	q.Add("redirect_uri", os.Getenv(demoExternalURLEnvKey)+"/verifier/oidc/share/cb")
 	q.Add("scope", "openid")
 	q.Add("state", state)
+	q.Add("nonce", nonce)
 	q.Add("claims", string(claimsBytes))
+	q.Add("registration", string(registrationBytes))
 
 	req.URL.RawQuery = q.Encode()
 
@@ -392,21 +733,60 @@ func (v *adapterApp) oidcShare(w http.ResponseWriter, r *http.Request) {
 
 	logger.Infof("oidc share redirect : url=%s claims=%s", redirectURL, string(claimsBytes))
 
-	err = v.store.Put(state, pdBytes)
+	shareData, err := json.Marshal(&oidcShareData{PresentationDefinition: pdBytes, Nonce: nonce})
+	if err != nil {
+		handleError(w, http.StatusInternalServerError,
+			fmt.Sprintf("failed to marshal state data : %s", err))
+
+		return nil
+	}
+
+	err = putWithLifetime(v.store, getOIDCShareDataStoreKeyPrefix(state), shareData, sessionLifetime)
 	if err != nil {
 		handleError(w, http.StatusInternalServerError,
 			fmt.Sprintf("failed to save state data : %s", err))
 
-		return
+		return nil
 	}
 
-	http.Redirect(w, r, redirectURL, http.StatusFound)
+	return v.saveNewSession(w, state, sessionTypeOIDCShare, redirectURL, nil)
 }
 
 func (v *adapterApp) oidcShareCallback(w http.ResponseWriter, r *http.Request) {
 	state := r.URL.Query().Get("state")
+	idToken := r.URL.Query().Get("id_token")
+	vpToken := r.URL.Query().Get("vp_token")
+
+	logger.Infof("oidc share callback : id_token=%s vp_token=%s",
+		idToken, vpToken)
+
+	v.publishEvent(&adapterEvent{Type: eventPresentationReceived, SessionID: state})
+
+	data := map[string]interface{}{
+		"ID_TOKEN": "\n" + idToken,
+		"VP_TOKEN": vpToken,
+	}
+
+	result := &presentationVerification{}
+
+	// state is consumed by the first callback, replays are rejected.
+	shareDataBytes, err := v.store.Get(getOIDCShareDataStoreKeyPrefix(state))
+	if err == nil {
+		err = v.store.Delete(getOIDCShareDataStoreKeyPrefix(state))
+	}
+
+	if !result.add(stateCheck, err) {
+		data["ErrMsg"] = "ERROR: unknown or already used state"
+		data["Checks"] = result.Checks
+
+		loadTemplate(w, oidcVerifierHTML, data)
 
-	pdBytes, err := v.store.Get(state)
+		return
+	}
+
+	var shareData oidcShareData
+
+	err = json.Unmarshal(shareDataBytes, &shareData)
 	if err != nil {
 		handleError(w, http.StatusInternalServerError,
 			fmt.Sprintf("failed to get oidc state data : %s", err))
@@ -416,7 +796,7 @@ func (v *adapterApp) oidcShareCallback(w http.ResponseWriter, r *http.Request) {
 
 	var pd *presexch.PresentationDefinition
 
-	err = json.Unmarshal(pdBytes, &pd)
+	err = json.Unmarshal(shareData.PresentationDefinition, &pd)
 	if err != nil {
 		handleError(w, http.StatusInternalServerError,
 			fmt.Sprintf("failed to unmarshal presentation definition : %s", err))
@@ -424,12 +804,6 @@ func (v *adapterApp) oidcShareCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	idToken := r.URL.Query().Get("id_token")
-	vpToken := r.URL.Query().Get("vp_token")
-
-	logger.Infof("oidc share callback : id_token=%s vp_token=%s",
-		idToken, vpToken)
-
 	var claims *OIDCTokenClaims
 
 	token, err := jwt.ParseSigned(idToken)
@@ -440,6 +814,7 @@ func (v *adapterApp) oidcShareCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// claims are read before the signature check so that every check can be reported.
 	err = token.UnsafeClaimsWithoutVerification(&claims)
 	if err != nil {
 		handleError(w, http.StatusInternalServerError,
@@ -456,531 +831,1564 @@ func (v *adapterApp) oidcShareCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	data["DECODED_VPDEF_IN_ID_TOKEN"] = string(presSubBytes)
+
 	logger.Infof("oidc share callback : _vp_token=%v vp_token=%s", string(presSubBytes), vpToken)
 
-	_, err = verifiable.ParsePresentation([]byte(vpToken), verifiable.WithPresJSONLDDocumentLoader(ld.NewDefaultDocumentLoader(nil)), verifiable.WithPresDisabledProofCheck())
-	if err != nil {
-		loadTemplate(w, oidcVerifierHTML,
-			map[string]interface{}{
-				"ErrMsg":                    fmt.Sprintf("ERROR: failed to validate presentation : %s", err),
-				"ID_TOKEN":                  "\n" + idToken,
-				"DECODED_VPDEF_IN_ID_TOKEN": string(presSubBytes),
-				"VP_TOKEN":                  string(vpToken),
-			},
-		)
+	verifiedIDToken, err := v.presVerifier.verifyJWT(idToken)
+	result.add(idTokenSignatureCheck, err)
+
+	if claims.Nonce != shareData.Nonce {
+		result.add(nonceCheck, fmt.Errorf("id_token nonce %q does not match %q", claims.Nonce, shareData.Nonce))
+	} else {
+		result.add(nonceCheck, nil)
+	}
+
+	presReq := &presentationRequest{Definition: pd, Challenge: shareData.Nonce}
+	if claims.VPToken != nil {
+		presReq.Submission = claims.VPToken.PresSub
+	}
+
+	vp, vpResult := v.presVerifier.verify([]byte(vpToken), presReq)
+	result.Checks = append(result.Checks, vpResult.Checks...)
+
+	// the id_token and the presentation have to come from the same subject, failed signatures are reported already.
+	if verifiedIDToken != nil && vp != nil {
+		result.add(idTokenSubjectCheck, checkIDTokenSubject(verifiedIDToken, vp))
+	}
+
+	data["Checks"] = result.Checks
+
+	v.setSessionPresentation(state, rawPresentation([]byte(vpToken)), result)
+	v.publishEvent(&adapterEvent{Type: eventVerificationResult, SessionID: state, Data: result,
+		Error: verificationError(result)})
+
+	if !result.Verified() {
+		data["ErrMsg"] = fmt.Sprintf("ERROR: failed to validate presentation : %s", result.Error())
+
+		loadTemplate(w, oidcVerifierHTML, data)
 
 		return
 	}
 
-	loadTemplate(w, oidcVerifierHTML,
-		map[string]interface{}{
-			"Msg":                       "Successfully Received Presentation",
-			"ID_TOKEN":                  "\n" + idToken,
-			"DECODED_VPDEF_IN_ID_TOKEN": string(presSubBytes),
-			"VP_TOKEN":                  string(vpToken),
-		},
-	)
+	data["Msg"] = "Successfully Received Presentation"
+
+	loadTemplate(w, oidcVerifierHTML, data)
 }
 
 func (v *adapterApp) initiateIssuance(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 
+	if session := v.createOIDCIssuanceSession(w, r); session != nil {
+		http.Redirect(w, r, session.URL, http.StatusFound)
+	}
+}
+
+// createOIDCIssuanceSession creates a mock issuer and its OIDC issuance session identified by the issuer ID, the
+// wallet is sent to its initiate issuance URL. Errors are written to the response.
+func (v *adapterApp) createOIDCIssuanceSession(w http.ResponseWriter, r *http.Request) *sessionData {
 	walletURL := r.FormValue("walletInitIssuanceURL")
 	credentialTypes := strings.Split(r.FormValue("credentialTypes"), ",")
 	manifestIDs := strings.Split(r.FormValue("manifestIDs"), ",")
 	issuerURL := r.FormValue("issuerURL")
 	credManifest := r.FormValue("credManifest")
 	credentials := r.FormValue("credsToIssue")
+	preAuthorize := r.FormValue("preAuthorize") == "true"
+	userPIN := r.FormValue("userPIN")
+	deferIssuance := r.FormValue("deferIssuance") == "true"
 
-	key := uuid.NewString()
-	issuer := issuerURL + "/" + key
-	issuerConf, err := json.MarshalIndent(&issuerConfiguration{
-		Issuer:                issuer,
-		AuthorizationEndpoint: issuer + "/issuer/oidc/authorize",
-		TokenEndpoint:         issuer + "/issuer/oidc/token",
-		CredentialEndpoint:    issuer + "/issuer/oidc/credential",
-		CredentialManifests:   []byte(credManifest),
-	}, "", "	")
+	pendingCount, err := strconv.Atoi(r.FormValue("pendingCount"))
+	if err != nil || pendingCount < 0 {
+		pendingCount = 0
+	}
+
+	var credentialsToSave map[string]json.RawMessage
+	err = json.Unmarshal([]byte(credentials), &credentialsToSave)
 	if err != nil {
 		handleError(w, http.StatusInternalServerError,
-			fmt.Sprintf("failed to prepare issuer wellknown configuration : %s", err))
+			fmt.Sprintf("failed to parse credentials : %s", err))
 
-		return
+		return nil
 	}
 
-	err = v.store.Put(key, issuerConf)
+	key := uuid.NewString()
+
+	signingKey, err := v.sessionIssuerKey(r, key)
 	if err != nil {
-		handleError(w, http.StatusInternalServerError,
-			fmt.Sprintf("failed to prepare server configuration : %s", err))
+		handleError(w, http.StatusBadRequest,
+			fmt.Sprintf("failed to create issuer key : %s", err))
 
-		return
+		return nil
 	}
 
-	var credentialsToSave map[string]json.RawMessage
-	err = json.Unmarshal([]byte(credentials), &credentialsToSave)
+	proof, err := sessionProofFormat(r, signingKey)
 	if err != nil {
-		handleError(w, http.StatusInternalServerError,
-			fmt.Sprintf("failed to parse credentials : %s", err))
+		handleError(w, http.StatusBadRequest,
+			fmt.Sprintf("invalid proof format : %s", err))
 
-		return
+		return nil
+	}
+
+	statusPurpose, err := sessionStatusPurpose(r)
+	if err != nil {
+		handleError(w, http.StatusBadRequest,
+			fmt.Sprintf("invalid credential status : %s", err))
+
+		return nil
+	}
+
+	settings := &issuerSettings{
+		DeferredIssuance: deferIssuance,
+		PendingCount:     pendingCount,
+		Key:              signingKey,
+		Proof:            proof,
+		StatusPurpose:    statusPurpose,
 	}
 
+	credentialsSupported := make(map[string]*supportedCredential)
+
 	for ct, credential := range credentialsToSave {
-		err = v.store.Put(getCredStoreKeyPrefix(key, ct), credential)
+		credentialsSupported[ct], err = newSupportedCredential(credential, settings)
 		if err != nil {
 			handleError(w, http.StatusInternalServerError,
-				fmt.Sprintf("failed to server configuration : %s", err))
+				fmt.Sprintf("failed to read credential type : %s", err))
 
-			return
+			return nil
 		}
 	}
 
-	u, err := url.Parse(walletURL)
+	issuerDisplay, err := addManifestDisplay(credentialsSupported, credManifest)
+	if err != nil {
+		handleError(w, http.StatusBadRequest,
+			fmt.Sprintf("failed to read credential manifests : %s", err))
+
+		return nil
+	}
+
+	issuer := issuerURL + "/" + key
+	conf := &issuerConfiguration{
+		Issuer:                  issuer,
+		AuthorizationEndpoint:   issuer + "/issuer/oidc/authorize",
+		TokenEndpoint:           issuer + "/issuer/oidc/token",
+		CredentialEndpoint:      issuer + "/issuer/oidc/credential",
+		BatchCredentialEndpoint: issuer + "/issuer/oidc/batch_credential",
+		CredentialManifests:     []byte(credManifest),
+		GrantTypesSupported:     []string{authorizationCodeGrantType, preAuthorizedCodeGrantType},
+		CredentialsSupported:    credentialsSupported,
+		Display:                 issuerDisplay,
+		TokenEndpointAuthMethodsSupported: []string{clientAuthNone, clientAuthSecretBasic, clientAuthSecretPost,
+			clientAuthPrivateKeyJWT},
+		CodeChallengeMethodsSupported: []string{pkceMethodS256, pkceMethodPlain},
+	}
+
+	if deferIssuance {
+		conf.DeferredCredentialEndpoint = issuer + "/issuer/oidc/deferred_credential"
+	}
+
+	offeredTypes, err := resolveClaims(offerClaims(credentialTypes, manifestIDs), conf)
+	if err != nil {
+		handleError(w, http.StatusBadRequest,
+			fmt.Sprintf("invalid credential offer : %s", err))
+
+		return nil
+	}
+
+	issuerConf, err := json.MarshalIndent(conf, "", "	")
+	if err != nil {
+		handleError(w, http.StatusInternalServerError,
+			fmt.Sprintf("failed to prepare issuer wellknown configuration : %s", err))
+
+		return nil
+	}
+
+	err = putWithLifetime(v.store, key, issuerConf, sessionLifetime)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError,
+			fmt.Sprintf("failed to prepare server configuration : %s", err))
+
+		return nil
+	}
+
+	err = saveIssuerSettings(v.store, key, settings)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError,
+			fmt.Sprintf("failed to save issuer settings : %s", err))
+
+		return nil
+	}
+
+	for ct, credential := range credentialsToSave {
+		err = putWithLifetime(v.store, getCredStoreKeyPrefix(key, ct), credential, sessionLifetime)
+		if err != nil {
+			handleError(w, http.StatusInternalServerError,
+				fmt.Sprintf("failed to server configuration : %s", err))
+
+			return nil
+		}
+	}
+
+	u, err := url.Parse(walletURL)
 	if err != nil {
 		handleError(w, http.StatusInternalServerError,
 			fmt.Sprintf("failed to parse wallet init issuance URL : %s", err))
 
-		return
+		return nil
+	}
+
+	q := u.Query()
+	q.Set("issuer", issuer)
+
+	for _, credType := range credentialTypes {
+		q.Add("credential_type", credType)
+	}
+
+	for _, manifestID := range manifestIDs {
+		q.Add("manifest_id", manifestID)
+	}
+
+	if preAuthorize {
+		preAuthCode := uuid.NewString()
+
+		err = savePreAuthorizedCode(v.store, preAuthCode, &preAuthorizedCodeData{IssuerID: key, UserPIN: userPIN,
+			CredentialTypes: offeredTypes})
+		if err != nil {
+			handleError(w, http.StatusInternalServerError,
+				fmt.Sprintf("failed to save pre-authorized code : %s", err))
+
+			return nil
+		}
+
+		q.Set("pre-authorized_code", preAuthCode)
+		q.Set("user_pin_required", strconv.FormatBool(userPIN != ""))
+	}
+
+	u.RawQuery = q.Encode()
+
+	return v.saveNewSession(w, key, sessionTypeOIDCIssuance, u.String(), nil)
+}
+
+func (v *adapterApp) wellKnownConfiguration(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	issuerConf, err := v.store.Get(id)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError,
+			fmt.Sprintf("failed to read wellknown configuration : %s", err))
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(issuerConf)
+}
+
+func (v *adapterApp) wellKnownCredentialIssuer(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	issuerConf, err := v.readIssuerConfiguration(id)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError,
+			fmt.Sprintf("failed to read wellknown configuration : %s", err))
+
+		return
+	}
+
+	credentialsSupported := issuerConf.CredentialsSupported
+	if credentialsSupported == nil {
+		credentialsSupported = map[string]*supportedCredential{}
+	}
+
+	metadata, err := json.MarshalIndent(&credentialIssuerMetadata{
+		CredentialIssuer:           issuerConf.Issuer,
+		AuthorizationServer:        issuerConf.Issuer,
+		CredentialEndpoint:         issuerConf.CredentialEndpoint,
+		BatchCredentialEndpoint:    issuerConf.BatchCredentialEndpoint,
+		DeferredCredentialEndpoint: issuerConf.DeferredCredentialEndpoint,
+		CredentialsSupported:       credentialsSupported,
+		Display:                    issuerConf.Display,
+	}, "", "	")
+	if err != nil {
+		handleError(w, http.StatusInternalServerError,
+			fmt.Sprintf("failed to prepare credential issuer metadata : %s", err))
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(metadata)
+}
+
+func (v *adapterApp) issuerAuthorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		handleError(w, http.StatusBadRequest,
+			fmt.Sprintf("failed to parse request : %s", err))
+
+		return
+	}
+
+	claims, err := url.PathUnescape(r.Form.Get("claims"))
+	if err != nil {
+		handleError(w, http.StatusBadRequest,
+			fmt.Sprintf("failed to read claims : %s", err))
+
+		return
+	}
+
+	redirectURI, err := url.PathUnescape(r.Form.Get("redirect_uri"))
+	if err != nil {
+		handleError(w, http.StatusBadRequest,
+			fmt.Sprintf("failed to read redirect URI : %s", err))
+
+		return
+	}
+
+	scope := r.Form.Get("scope")
+	state := r.Form.Get("state")
+	// the wallet builds the authorize URL of a multiline template, its response_type ends with the line break.
+	responseType := strings.TrimSpace(r.Form.Get("response_type"))
+	clientID := r.Form.Get("client_id")
+
+	codeChallenge := r.Form.Get("code_challenge")
+	codeChallengeMethod := r.Form.Get("code_challenge_method")
+
+	// basic validation only.
+	if claims == "" || redirectURI == "" || clientID == "" || state == "" {
+		handleError(w, http.StatusBadRequest, fmt.Sprintf("Invalid Request"))
+
+		return
+	}
+
+	// errors with client or redirect URI are not sent to the redirect URI.
+	client, ok := v.clients[clientID]
+	if !ok {
+		handleError(w, http.StatusBadRequest, fmt.Sprintf("%s : unknown client", errInvalidClient))
+
+		return
+	}
+
+	if !client.allowsRedirectURI(redirectURI) {
+		handleError(w, http.StatusBadRequest,
+			fmt.Sprintf("%s : redirect_uri is not registered for client", errInvalidRequest))
+
+		return
+	}
+
+	if responseType != "code" {
+		redirectOAuthError(w, r, redirectURI, state, newOAuthError(errUnsupportedResponse,
+			fmt.Sprintf("unsupported response type %q", responseType), http.StatusBadRequest))
+
+		return
+	}
+
+	if codeChallenge != "" && codeChallengeMethod == "" {
+		codeChallengeMethod = pkceMethodPlain
+	}
+
+	if codeChallengeMethod != "" && (codeChallenge == "" || !isSupportedPKCEMethod(codeChallengeMethod)) {
+		redirectOAuthError(w, r, redirectURI, state, newOAuthError(errInvalidRequest,
+			"code_challenge with S256 or plain code_challenge_method is expected", http.StatusBadRequest))
+
+		return
+	}
+
+	issuerID := mux.Vars(r)["id"]
+
+	issuerConf, err := v.readIssuerConfiguration(issuerID)
+	if err != nil {
+		redirectOAuthError(w, r, redirectURI, state, newOAuthError(errInvalidRequest, "unknown issuer",
+			http.StatusBadRequest))
+
+		return
+	}
+
+	_, err = authorizedCredentialTypes(claims, issuerConf)
+	if err != nil {
+		redirectOAuthError(w, r, redirectURI, state, newOAuthError(errInvalidRequest,
+			fmt.Sprintf("invalid claims : %s", err), http.StatusBadRequest))
+
+		return
+	}
+
+	authState := uuid.NewString()
+
+	authRequest, err := json.Marshal(map[string]string{
+		"issuer_id":             issuerID,
+		"claims":                claims,
+		"scope":                 scope,
+		"state":                 state,
+		"response_type":         responseType,
+		"client_id":             clientID,
+		"redirect_uri":          redirectURI,
+		"code_challenge":        codeChallenge,
+		"code_challenge_method": codeChallengeMethod,
+	})
+	if err != nil {
+		handleError(w, http.StatusInternalServerError,
+			fmt.Sprintf("failed to process authorization request : %s", err))
+
+		return
+	}
+
+	err = putWithLifetime(v.store, getAuthStateKeyPrefix(authState), authRequest, authStateLifetime)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError,
+			fmt.Sprintf("failed to save state : %s", err))
+
+		return
+	}
+
+	authStateCookie := http.Cookie{
+		Name:    "state",
+		Value:   authState,
+		Expires: time.Now().Add(authRequestLifetime),
+		Path:    "/",
+	}
+
+	http.SetCookie(w, &authStateCookie)
+	http.Redirect(w, r, "/issuer/oidc/login", http.StatusFound)
+}
+
+func (v *adapterApp) issuerSendAuthorizeResponse(w http.ResponseWriter, r *http.Request) {
+	stateCookie, err := r.Cookie("state")
+	if err != nil {
+		handleError(w, http.StatusForbidden, "invalid state")
+
+		return
+	}
+
+	authRqstBytes, err := v.store.Get(getAuthStateKeyPrefix(stateCookie.Value))
+	if err != nil {
+		handleError(w, http.StatusBadRequest, "invalid request")
+
+		return
+	}
+
+	var authRequest map[string]string
+	err = json.Unmarshal(authRqstBytes, &authRequest)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, "failed to read request")
+
+		return
+	}
+
+	redirectURI, ok := authRequest["redirect_uri"]
+	if !ok {
+		handleError(w, http.StatusInternalServerError, "failed to redirect, invalid URL")
+
+		return
+	}
+
+	state, ok := authRequest["state"]
+	if !ok {
+		handleError(w, http.StatusInternalServerError, "failed to redirect, invalid state")
+
+		return
+	}
+
+	username := r.FormValue("username")
+
+	user, ok := v.users[username]
+	if !ok || !user.authenticate(r.FormValue("password")) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusUnauthorized)
+		loadTemplate(w, oidcIssuerLoginHTML, map[string]interface{}{"Error": "Invalid username or password"})
+
+		return
+	}
+
+	// the logged in user is the subject of credentials issued with the authorization code.
+	authRequest["username"] = username
+
+	authRqstBytes, err = json.Marshal(authRequest)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, "failed to process login")
+
+		return
+	}
+
+	err = putWithLifetime(v.store, getAuthStateKeyPrefix(stateCookie.Value), authRqstBytes, authStateLifetime)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, "failed to save state")
+
+		return
+	}
+
+	authCode := uuid.NewString()
+
+	err = saveAuthCode(v.store, authCode, stateCookie.Value)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, "failed to save authorization code")
+
+		return
+	}
+
+	redirectTo := fmt.Sprintf("%s?code=%s&state=%s", redirectURI, authCode, state)
+
+	http.Redirect(w, r, redirectTo, http.StatusFound)
+}
+
+func (v *adapterApp) issuerTokenEndpoint(w http.ResponseWriter, r *http.Request) {
+	setOIDCResponseHeaders(w)
+
+	mockIssuerID := mux.Vars(r)["id"]
+
+	var (
+		credentialTypes []string
+		username        string
+		oauthErr        *oauthError
+	)
+
+	switch grantType := r.FormValue("grant_type"); grantType {
+	case authorizationCodeGrantType:
+		credentialTypes, username, oauthErr = v.redeemAuthorizationCode(r, mockIssuerID)
+	case preAuthorizedCodeGrantType:
+		credentialTypes, oauthErr = redeemPreAuthorizedCode(v.store, mockIssuerID, r.FormValue("pre-authorized_code"),
+			r.FormValue("user_pin"))
+	default:
+		oauthErr = newOAuthError(errUnsupportedGrantType,
+			fmt.Sprintf("unsupported grant type %q", grantType), http.StatusBadRequest)
+	}
+
+	if oauthErr != nil {
+		v.publishEvent(&adapterEvent{Type: eventError, SessionID: mockIssuerID, Error: oauthErr.Error()})
+		sendOAuthErrorResponse(w, oauthErr)
+
+		return
+	}
+
+	mockAccessToken := uuid.NewString()
+
+	tokenData := &accessTokenData{IssuerID: mockIssuerID, ExpiresAt: time.Now().Add(accessTokenLifetime),
+		CredentialTypes: credentialTypes, Username: username}
+	tokenData.rotateCNonce()
+
+	err := saveAccessToken(v.store, mockAccessToken, tokenData)
+	if err != nil {
+		sendOIDCErrorResponse(w, "failed to save token state", http.StatusInternalServerError)
+		return
+	}
+
+	v.setSessionStatus(mockIssuerID, sessionStatusInProgress)
+	v.publishEvent(&adapterEvent{Type: eventTokenIssued, SessionID: mockIssuerID})
+
+	response, err := json.Marshal(map[string]interface{}{
+		"token_type":         "Bearer",
+		"access_token":       mockAccessToken,
+		"expires_in":         int(accessTokenLifetime.Seconds()),
+		"c_nonce":            tokenData.CNonce,
+		"c_nonce_expires_in": int(cNonceLifetime.Seconds()),
+	})
+	// TODO add id_token
+	if err != nil {
+		sendOIDCErrorResponse(w, "response_write_error", http.StatusBadRequest)
+
+		return
+	}
+
+	w.Write(response)
+}
+
+// redeemAuthorizationCode authenticates client and validates authorization code, redirect URI and PKCE code
+// verifier sent to the token endpoint of given issuer, and returns the credential types claimed in the authorization
+// request and the user who logged in to authorize it.
+func (v *adapterApp) redeemAuthorizationCode(r *http.Request, issuerID string) ([]string, string, *oauthError) {
+	issuerConf, err := v.readIssuerConfiguration(issuerID)
+	if err != nil {
+		return nil, "", newOAuthError(errInvalidRequest, "unknown issuer", http.StatusBadRequest)
+	}
+
+	authState, oauthErr := redeemAuthCode(v.store, r.FormValue("code"))
+	if oauthErr != nil {
+		return nil, "", oauthErr
+	}
+
+	authRqstBytes, err := v.store.Get(getAuthStateKeyPrefix(authState))
+	if errors.Is(err, errRecordExpired) {
+		return nil, "", newOAuthError(errInvalidGrant, "authorization request expired", http.StatusBadRequest)
+	} else if err != nil {
+		return nil, "", newOAuthError(errInvalidGrant, "invalid request", http.StatusBadRequest)
+	}
+
+	var authRequest map[string]string
+
+	err = json.Unmarshal(authRqstBytes, &authRequest)
+	if err != nil {
+		return nil, "", newOAuthError(errServerError, "failed to read request", http.StatusInternalServerError)
+	}
+
+	// public clients may leave out client_id, it is the client the code was issued to.
+	client, oauthErr := v.authenticateClient(r, authRequest["client_id"], issuerConf.TokenEndpoint, issuerConf.Issuer)
+	if oauthErr != nil {
+		return nil, "", oauthErr
+	}
+
+	if authRequest["issuer_id"] != issuerID {
+		return nil, "", newOAuthError(errInvalidGrant, "authorization code was issued by another issuer",
+			http.StatusBadRequest)
+	}
+
+	if authRequest["client_id"] != client.ID {
+		return nil, "", newOAuthError(errInvalidGrant, "authorization code was issued to another client",
+			http.StatusBadRequest)
+	}
+
+	if authRedirectURI := authRequest["redirect_uri"]; authRedirectURI != r.FormValue("redirect_uri") {
+		return nil, "", newOAuthError(errInvalidGrant, "redirect_uri does not match authorization request",
+			http.StatusBadRequest)
+	}
+
+	oauthErr = verifyPKCE(authRequest["code_challenge"], authRequest["code_challenge_method"],
+		r.FormValue("code_verifier"))
+	if oauthErr != nil {
+		return nil, "", oauthErr
+	}
+
+	credentialTypes, err := authorizedCredentialTypes(authRequest["claims"], issuerConf)
+	if err != nil {
+		return nil, "", newOAuthError(errInvalidGrant, fmt.Sprintf("invalid claims : %s", err), http.StatusBadRequest)
+	}
+
+	return credentialTypes, authRequest["username"], nil
+}
+
+func (v *adapterApp) issuerCredentialEndpoint(w http.ResponseWriter, r *http.Request) {
+	setOIDCResponseHeaders(w)
+
+	req, err := parseCredentialRequest(r)
+	if err != nil {
+		sendOAuthErrorResponse(w, newOAuthError(errInvalidRequest, err.Error(), http.StatusBadRequest))
+		return
+	}
+
+	v.handleCredentialRequests(w, r, []*credentialRequest{req}, func(responses []*credentialResponse,
+		cNonce string) (interface{}, *oauthError) {
+		resp := responses[0]
+		if resp.Error == errServerError {
+			return nil, newOAuthError(resp.Error, resp.ErrorDescription, http.StatusInternalServerError)
+		}
+
+		if resp.Error != "" {
+			return nil, newOAuthError(resp.Error, resp.ErrorDescription, http.StatusBadRequest)
+		}
+
+		resp.CNonce = cNonce
+		resp.CNonceExpiresIn = int(cNonceLifetime.Seconds())
+
+		return resp, nil
+	})
+}
+
+func (v *adapterApp) issuerBatchCredentialEndpoint(w http.ResponseWriter, r *http.Request) {
+	setOIDCResponseHeaders(w)
+
+	var batchRequest batchCredentialRequest
+
+	err := json.NewDecoder(r.Body).Decode(&batchRequest)
+	if err != nil {
+		sendOAuthErrorResponse(w, newOAuthError(errInvalidRequest,
+			fmt.Sprintf("failed to decode batch credential request : %s", err), http.StatusBadRequest))
+
+		return
+	}
+
+	if len(batchRequest.CredentialRequests) == 0 {
+		sendOAuthErrorResponse(w, newOAuthError(errInvalidRequest, "credential_requests is required",
+			http.StatusBadRequest))
+
+		return
+	}
+
+	v.handleCredentialRequests(w, r, batchRequest.CredentialRequests, func(responses []*credentialResponse,
+		cNonce string) (interface{}, *oauthError) {
+		return &batchCredentialResponse{
+			CredentialResponses: responses,
+			CNonce:              cNonce,
+			CNonceExpiresIn:     int(cNonceLifetime.Seconds()),
+		}, nil
+	})
+}
+
+// handleCredentialRequests authorizes credential requests sent with an access token, checks proofs of possession
+// of holder key and issues credentials. Failures of individual requests are reported in their responses and
+// respond decides how they are sent back.
+func (v *adapterApp) handleCredentialRequests(w http.ResponseWriter, r *http.Request, requests []*credentialRequest,
+	respond func(responses []*credentialResponse, cNonce string) (interface{}, *oauthError)) {
+	mockIssuerID := mux.Vars(r)["id"]
+
+	accessToken, tokenData, oauthErr := v.readBearerAccessToken(r, mockIssuerID)
+	if oauthErr != nil {
+		sendOAuthErrorResponse(w, oauthErr)
+		return
+	}
+
+	issuerConf, err := v.readIssuerConfiguration(mockIssuerID)
+	if err != nil {
+		sendOIDCErrorResponse(w, "failed to read issuer configuration", http.StatusInternalServerError)
+		return
+	}
+
+	settings, err := readIssuerSettings(v.store, mockIssuerID)
+	if err != nil {
+		sendOIDCErrorResponse(w, "failed to read issuer settings", http.StatusInternalServerError)
+		return
+	}
+
+	// all proofs are signed over the same c_nonce, it is rotated once requests are checked.
+	holderDIDs := make([]string, len(requests))
+	proofErrs := make([]error, len(requests))
+
+	for i, req := range requests {
+		holderDIDs[i], proofErrs[i] = v.checkProof(req.Proof, tokenData, issuerConf.Issuer)
+	}
+
+	proofNonce := tokenData.CNonce
+
+	// every response carries a fresh c_nonce, used ones can not be replayed.
+	tokenData.rotateCNonce()
+
+	err = saveAccessToken(v.store, accessToken, tokenData)
+	if err != nil {
+		sendOIDCErrorResponse(w, "failed to save token state", http.StatusInternalServerError)
+		return
+	}
+
+	responses := make([]*credentialResponse, len(requests))
+
+	for i, req := range requests {
+		if proofErrs[i] != nil {
+			responses[i] = &credentialResponse{Error: errInvalidOrMissingProof, ErrorDescription: proofErrs[i].Error()}
+			continue
+		}
+
+		output, errResponse := v.authorizeCredentialRequest(req, tokenData, issuerConf,
+			&applicationHolder{DID: holderDIDs[i], CNonce: proofNonce})
+		if errResponse != nil {
+			responses[i] = errResponse
+			continue
+		}
+
+		responses[i] = v.processCredentialRequest(mockIssuerID, req, holderDIDs[i], tokenData.Username, settings,
+			output)
+	}
+
+	resp, oauthErr := respond(responses, tokenData.CNonce)
+	if oauthErr != nil {
+		if oauthErr.Code == errInvalidOrMissingProof {
+			oauthErr.CNonce = tokenData.CNonce
+			oauthErr.CNonceExpiresIn = int(cNonceLifetime.Seconds())
+		}
+
+		v.publishEvent(&adapterEvent{Type: eventError, SessionID: mockIssuerID, Error: oauthErr.Error()})
+		sendOAuthErrorResponse(w, oauthErr)
+
+		return
+	}
+
+	response, err := json.Marshal(resp)
+	if err != nil {
+		sendOIDCErrorResponse(w, "response_write_error", http.StatusBadRequest)
+		return
+	}
+
+	w.Write(response)
+}
+
+// readBearerAccessToken reads state of the access token sent in authorization header to given issuer.
+func (v *adapterApp) readBearerAccessToken(r *http.Request, issuerID string) (string, *accessTokenData, *oauthError) {
+	authHeader := strings.Split(r.Header.Get("Authorization"), "Bearer ")
+	if len(authHeader) != 2 {
+		return "", nil, newOAuthError(errInvalidRequest, "malformed token", http.StatusBadRequest)
+	}
+
+	if authHeader[1] == "" {
+		return "", nil, newOAuthError(errInvalidToken, "invalid token", http.StatusForbidden)
+	}
+
+	tokenData, err := readAccessToken(v.store, authHeader[1])
+	if errors.Is(err, errRecordExpired) {
+		return "", nil, newOAuthError(errInvalidToken, "access token expired", http.StatusUnauthorized)
+	} else if err != nil {
+		return "", nil, newOAuthError(errInvalidToken, "unknown access token", http.StatusUnauthorized)
+	}
+
+	if issuerID != tokenData.IssuerID {
+		return "", nil, newOAuthError(errInvalidToken, "invalid transaction", http.StatusForbidden)
+	}
+
+	return authHeader[1], tokenData, nil
+}
+
+// authorizeCredentialRequest checks that the access token authorizes the credential type of the request. Requests
+// with a credential application are for the credential type of the output descriptor the application is fulfilled
+// with, which is returned. The application must be presented by the holder proving possession of the key.
+func (v *adapterApp) authorizeCredentialRequest(req *credentialRequest, token *accessTokenData,
+	issuerConf *issuerConfiguration, holder *applicationHolder) (*applicationOutput, *credentialResponse) {
+	var output *applicationOutput
+
+	if len(req.CredentialApplication) > 0 {
+		var err error
+
+		output, err = v.readCredentialApplication(req.CredentialApplication, req.Type, issuerConf, holder)
+		if err != nil {
+			return nil, &credentialResponse{Error: errInvalidRequest, ErrorDescription: err.Error()}
+		}
+
+		req.Type = output.CredentialType
+	}
+
+	if !token.authorizes(req.Type) {
+		return nil, &credentialResponse{Error: errUnsupportedCredentialType,
+			ErrorDescription: fmt.Sprintf("credential type %q is not authorized by the access token", req.Type)}
+	}
+
+	return output, nil
+}
+
+// processCredentialRequest issues credential requested by the holder, or accepts the request for deferred issuance
+// if the issuer is set up to defer it. Credentials applied for with a credential application are returned with
+// their fulfillment.
+func (v *adapterApp) processCredentialRequest(issuerID string, req *credentialRequest, holderDID, username string,
+	settings *issuerSettings, output *applicationOutput) *credentialResponse {
+	format := req.Format
+	if format == "" {
+		format = ldpVCFormat
+	}
+
+	if !isSupportedFormat(format) || !canSignFormat(format, signingKeyType(settings.Key)) {
+		return &credentialResponse{Error: errUnsupportedCredentialFormat,
+			ErrorDescription: fmt.Sprintf("unsupported format %q requested", req.Format)}
+	}
+
+	// credential types without a staged credential are not issued, only failures to read it are server errors.
+	_, err := v.store.Get(getCredStoreKeyPrefix(issuerID, req.Type))
+	if errors.Is(err, storage.ErrDataNotFound) || errors.Is(err, errRecordExpired) {
+		return &credentialResponse{Error: errUnsupportedCredentialType,
+			ErrorDescription: fmt.Sprintf("no credential of type %q is staged for issuance", req.Type)}
+	} else if err != nil {
+		return &credentialResponse{Error: errServerError, ErrorDescription: "failed to get credential"}
+	}
+
+	if settings.DeferredIssuance {
+		acceptanceToken := uuid.NewString()
+
+		err = saveDeferredCredential(v.store, acceptanceToken, &deferredCredentialData{
+			IssuerID:       issuerID,
+			Format:         format,
+			CredentialType: req.Type,
+			HolderDID:      holderDID,
+			Username:       username,
+			PendingCount:   settings.PendingCount,
+			Output:         output,
+		})
+		if err != nil {
+			return &credentialResponse{Error: errServerError,
+				ErrorDescription: "failed to save deferred credential state"}
+		}
+
+		return &credentialResponse{Format: format, AcceptanceToken: acceptanceToken}
+	}
+
+	credBytes, err := v.issueCredential(issuerID, req.Type, format, holderDID, username, settings)
+	if err != nil {
+		return &credentialResponse{Error: errServerError, ErrorDescription: err.Error()}
+	}
+
+	return &credentialResponse{Format: format, Credential: credBytes,
+		CredentialFulfillment: outputFulfillment(output, format)}
+}
+
+// outputFulfillment returns fulfillment of the credential issued in given format for the output descriptor of a
+// credential application, or nil if the credential was not applied for.
+func outputFulfillment(output *applicationOutput, format string) *cm.CredentialFulfillment {
+	if output == nil {
+		return nil
+	}
+
+	return newCredentialFulfillment(output.ManifestID, output.DescriptorID, format, "$.credential")
+}
+
+// issuerDeferredCredentialEndpoint returns credential accepted for deferred issuance once it is no longer pending.
+// Acceptance token is sent as a bearer token.
+func (v *adapterApp) issuerDeferredCredentialEndpoint(w http.ResponseWriter, r *http.Request) {
+	setOIDCResponseHeaders(w)
+
+	authHeader := strings.Split(r.Header.Get("Authorization"), "Bearer ")
+	if len(authHeader) != 2 || authHeader[1] == "" {
+		sendOIDCErrorResponse(w, "malformed acceptance token", http.StatusBadRequest)
+		return
+	}
+
+	acceptanceToken := authHeader[1]
+	mockIssuerID := mux.Vars(r)["id"]
+
+	deferred, err := readDeferredCredential(v.store, acceptanceToken)
+	if errors.Is(err, errRecordExpired) {
+		sendOAuthErrorResponse(w, newOAuthError(errInvalidToken, "acceptance token expired", http.StatusUnauthorized))
+		return
+	} else if err != nil {
+		sendOAuthErrorResponse(w, newOAuthError(errInvalidToken, "unknown acceptance token", http.StatusUnauthorized))
+		return
+	}
+
+	if mockIssuerID != deferred.IssuerID {
+		sendOIDCErrorResponse(w, "invalid transaction", http.StatusForbidden)
+		return
+	}
+
+	if deferred.PendingCount > 0 {
+		deferred.PendingCount--
+
+		err = saveDeferredCredential(v.store, acceptanceToken, deferred)
+		if err != nil {
+			sendOIDCErrorResponse(w, "failed to save deferred credential state", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+
+		err = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    errIssuancePending,
+			"interval": deferredPollInterval,
+		})
+		if err != nil {
+			logger.Errorf("failed to write issuance pending response : %s", err)
+		}
+
+		return
+	}
+
+	settings, err := readIssuerSettings(v.store, mockIssuerID)
+	if err != nil {
+		sendOIDCErrorResponse(w, "failed to read issuer settings", http.StatusInternalServerError)
+		return
+	}
+
+	credBytes, err := v.issueCredential(mockIssuerID, deferred.CredentialType, deferred.Format, deferred.HolderDID,
+		deferred.Username, settings)
+	if err != nil {
+		sendOIDCErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// acceptance tokens are one-time.
+	err = v.store.Delete(getAcceptanceTokenKeyPrefix(acceptanceToken))
+	if err != nil {
+		sendOIDCErrorResponse(w, "failed to redeem acceptance token", http.StatusInternalServerError)
+		return
+	}
+
+	response, err := json.Marshal(&credentialResponse{Format: deferred.Format, Credential: credBytes,
+		CredentialFulfillment: outputFulfillment(deferred.Output, deferred.Format)})
+	if err != nil {
+		sendOIDCErrorResponse(w, "response_write_error", http.StatusBadRequest)
+		return
+	}
+
+	w.Write(response)
+}
+
+// issueCredential signs credential of given type saved for the issuer with the issuer key and proof format of the
+// settings, bound to the holder DID and with an entry in the status list of the issuer key. Credential subject is
+// filled with claims of the user who logged in, if any. Linked data proof credentials are returned as JSON objects
+// and JWT credentials as JSON strings holding the compact JWS.
+func (v *adapterApp) issueCredential(issuerID, credentialType, format, holderDID, username string,
+	settings *issuerSettings) (json.RawMessage, error) {
+	signer, err := v.issuerSigner(settings.Key, settings.Proof)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue credential : %w", err)
+	}
+
+	credentialBytes, err := v.store.Get(getCredStoreKeyPrefix(issuerID, credentialType))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credential : %w", err)
+	}
+
+	credential, err := verifiable.ParseCredential(credentialBytes,
+		verifiable.WithJSONLDDocumentLoader(v.documentLoader))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare credential : %w", err)
+	}
+
+	fillCredentialSubject(credential, v.userClaims(username))
+	templateCredential(credential, holderDID, time.Now())
+	signer.setIssuer(credential)
+
+	err = v.addCredentialStatus(credential, settings.Key, settings.StatusPurpose)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue credential : %w", err)
+	}
+
+	var credBytes json.RawMessage
+
+	if format == jwtVCJSONFormat || format == jwtVCJSONLDFormat {
+		jws, e := signCredentialJWT(credential, signer)
+		if e != nil {
+			return nil, fmt.Errorf("failed to issue credential : %w", e)
+		}
+
+		credBytes, err = json.Marshal(jws)
+	} else {
+		err = signCredential(credential, signer, v.documentLoader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to issue credential : %w", err)
+		}
+
+		credBytes, err = credential.MarshalJSON()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to write credential bytes : %w", err)
+	}
+
+	v.addSessionCredential(issuerID, credBytes)
+	v.publishEvent(&adapterEvent{Type: eventCredentialIssued, SessionID: issuerID,
+		Data: map[string]string{"type": credentialType, "format": format}})
+
+	return credBytes, nil
+}
+
+func (v *adapterApp) readIssuerConfiguration(issuerID string) (*issuerConfiguration, error) {
+	issuerConfBytes, err := v.store.Get(issuerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var issuerConf issuerConfiguration
+
+	err = json.Unmarshal(issuerConfBytes, &issuerConf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &issuerConf, nil
+}
+
+func (v *adapterApp) listenForDIDCommMsg(actionCh chan service.DIDCommAction) {
+	for action := range actionCh {
+		logger.Infof("received action message : type=%s", action.Message.Type())
+
+		v.publishActionEvent(action)
+
+		// handlers either continue the action or return the problem it is stopped with.
+		var problem *actionProblem
+
+		switch action.Message.Type() {
+		case didexchange.RequestMsgType:
+			action.Continue(nil)
+		case presentproofsvc.ProposePresentationMsgTypeV2, presentproofsvc.ProposePresentationMsgTypeV3:
+			problem = v.handleProposePresentation(action)
+		case presentproofsvc.PresentationMsgTypeV2, presentproofsvc.PresentationMsgTypeV3:
+			problem = v.verifyWACIPresentation(action)
+		case issuecredential.ProposeCredentialMsgTypeV2, issuecredential.ProposeCredentialMsgTypeV3:
+			problem = v.handleProposeCredential(action)
+		case issuecredential.RequestCredentialMsgTypeV2, issuecredential.RequestCredentialMsgTypeV3:
+			problem = v.handleRequestCredential(action)
+		default:
+			problem = newActionProblem(problemCodeUnsupportedMessage, "unsupported message type", nil)
+		}
+
+		if problem != nil {
+			v.stopAction(action, problem)
+		}
+	}
+}
+
+// handleProposePresentation requests presentation of the share session of the invitation the proposal answers.
+func (v *adapterApp) handleProposePresentation(action service.DIDCommAction) *actionProblem {
+	thID, err := action.Message.ThreadID()
+	if err != nil {
+		return newActionProblem(problemCodeInvalidMessage, "failed to get thread ID", err)
+	}
+
+	invitationID, err := v.getInvitationID(action)
+	if err != nil {
+		return newActionProblem(problemCodeUnknownSession, "failed to get invitation ID", err)
+	}
+
+	shareData, err := readWACIShareData(v.store, invitationID, thID)
+	if err != nil {
+		return newActionProblem(problemCodeUnknownSession, "failed to get WACI share data", err)
+	}
+
+	// request-first sessions request presentation once the connection completes, a proposal after it is not answered.
+	if shareData.RequestFirst && !v.startSession(shareData.SessionID) {
+		return newActionProblem(problemCodeInvalidMessage, "presentation is already requested", nil)
+	}
+
+	pd := presexch.PresentationDefinition{}
+
+	err = json.Unmarshal(shareData.PresentationDefinition, &pd)
+	if err != nil {
+		return newActionProblem(problemCodeInternalError, "failed to unmarshal presentation definition", err)
+	}
+
+	shareData.Challenge, shareData.Domain = uuid.NewString(), uuid.NewString()
+
+	err = saveWACIShareData(v.store, thID, shareData)
+	if err != nil {
+		return newActionProblem(problemCodeInternalError, "failed to save WACI share data", err)
+	}
+
+	v.setSessionStatus(shareData.SessionID, sessionStatusInProgress)
+
+	action.Continue(presentproof.WithRequestPresentation(newWACIPresentationRequest(shareData, &pd)))
+
+	return nil
+}
+
+// newWACIPresentationRequest returns request for presentation of the share session's presentation definition.
+func newWACIPresentationRequest(shareData *waciShareData,
+	pd *presexch.PresentationDefinition) *presentproof.RequestPresentation {
+	return &presentproof.RequestPresentation{
+		Comment: "Request Presentation",
+		Attachments: []decorator.GenericAttachment{
+			{
+				ID:        uuid.NewString(),
+				MediaType: "application/json",
+				Data: decorator.AttachmentData{
+					JSON: struct {
+						Challenge string                           `json:"challenge"`
+						Domain    string                           `json:"domain"`
+						PD        *presexch.PresentationDefinition `json:"presentation_definition"`
+					}{
+						Challenge: shareData.Challenge,
+						Domain:    shareData.Domain,
+						PD:        pd,
+					},
+				},
+			},
+		},
+		WillConfirm: true,
+	}
+}
+
+// handleProposeCredential offers the credential of the issuance session of the invitation the proposal answers.
+func (v *adapterApp) handleProposeCredential(action service.DIDCommAction) *actionProblem {
+	thID, err := action.Message.ThreadID()
+	if err != nil {
+		return newActionProblem(problemCodeInvalidMessage, "failed to get thread ID", err)
+	}
+
+	err = putWithLifetime(v.store, thID, []byte(thID), sessionLifetime)
+	if err != nil {
+		return newActionProblem(problemCodeInternalError, "failed to save interaction data", err)
+	}
+
+	invitationID, err := credentialProposalInvitationID(action.Message)
+	if err != nil {
+		return newActionProblem(problemCodeInvalidMessage, "failed to decode propose credential message", err)
+	}
+
+	waciData, err := readWACIIssuanceData(v.store, invitationID)
+	if err != nil {
+		return newActionProblem(problemCodeUnknownSession, "failed to get WACI issuance data", err)
+	}
+
+	waciData.Challenge, waciData.Domain = uuid.NewString(), uuid.NewString()
+
+	err = saveWACIIssuanceData(v.store, thID, waciData)
+	if err != nil {
+		return newActionProblem(problemCodeInternalError, "failed to save WACI issuance data", err)
 	}
 
-	q := u.Query()
-	q.Set("issuer", issuer)
+	vp, err := v.createResponseVP(waciData, actionTheirDID(action), false)
+	if err != nil {
+		return newActionProblem(problemCodeInternalError, "failed to prepare response", err)
+	}
 
-	for _, credType := range credentialTypes {
-		q.Add("credential_type", credType)
+	credResponseBytes, err := vp.MarshalJSON()
+	if err != nil {
+		return newActionProblem(problemCodeInternalError, "failed to prepare response bytes", err)
 	}
 
-	for _, manifestID := range manifestIDs {
-		q.Add("manifest_id", manifestID)
+	offerCredMsg, err := createOfferCredentialMsg(waciData, credResponseBytes)
+	if err != nil {
+		return newActionProblem(problemCodeInternalError, "failed to prepare offer credential message", err)
 	}
 
-	u.RawQuery = q.Encode()
+	v.setSessionStatus(waciData.SessionID, sessionStatusInProgress)
 
-	http.Redirect(w, r, u.String(), http.StatusFound)
-}
+	action.Continue(issuecredential.WithOfferCredential(offerCredMsg))
 
-func (v *adapterApp) wellKnownConfiguration(w http.ResponseWriter, r *http.Request) {
-	id := mux.Vars(r)["id"]
+	return nil
+}
 
-	issuerConf, err := v.store.Get(id)
+// handleRequestCredential issues the credential of the issuance session the request belongs to.
+func (v *adapterApp) handleRequestCredential(action service.DIDCommAction) *actionProblem {
+	thID, err := action.Message.ThreadID()
 	if err != nil {
-		handleError(w, http.StatusInternalServerError,
-			fmt.Sprintf("failed to read wellknown configuration : %s", err))
+		return newActionProblem(problemCodeInvalidMessage, "failed to get thread ID", err)
+	}
 
-		return
+	waciData, err := readWACIIssuanceData(v.store, thID)
+	if err != nil {
+		return newActionProblem(problemCodeUnknownSession, "failed to get WACI issuance data", err)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(issuerConf)
-}
+	problem := v.verifyWACIApplication(action.Message, thID, waciData)
+	if problem != nil {
+		return problem
+	}
 
-func (v *adapterApp) issuerAuthorize(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseForm(); err != nil {
-		handleError(w, http.StatusBadRequest,
-			fmt.Sprintf("failed to parse request : %s", err))
+	vp, err := v.createResponseVP(waciData, actionTheirDID(action), true)
+	if err != nil {
+		return newActionProblem(problemCodeInternalError, "failed to prepare response", err)
+	}
 
-		return
+	credResponseBytes, err := vp.MarshalJSON()
+	if err != nil {
+		return newActionProblem(problemCodeInternalError, "failed to prepare response bytes", err)
 	}
 
-	claims, err := url.PathUnescape(r.Form.Get("claims"))
+	issueCredMsg, err := createIssueCredentialMsg(credResponseBytes, actionRedirectURL(action.Message.Type(), thID))
 	if err != nil {
-		handleError(w, http.StatusBadRequest,
-			fmt.Sprintf("failed to read claims : %s", err))
+		return newActionProblem(problemCodeInternalError, "failed to prepare issue credential message", err)
+	}
 
-		return
+	for _, credential := range vp.Credentials() {
+		if credBytes, e := json.Marshal(credential); e == nil {
+			v.addSessionCredential(waciData.SessionID, credBytes)
+		}
 	}
 
-	redirectURI, err := url.PathUnescape(r.Form.Get("redirect_uri"))
+	v.publishEvent(&adapterEvent{Type: eventCredentialIssued, SessionID: waciData.SessionID, ThreadID: thID,
+		MessageType: action.Message.Type()})
+
+	action.Continue(issuecredential.WithIssueCredential(issueCredMsg))
+
+	return nil
+}
+
+// verifyWACIApplication verifies the credential application attached to the request-credential message when the
+// credential manifest of the issuance has a presentation definition, issuance is refused if it does not satisfy it.
+func (v *adapterApp) verifyWACIApplication(msg service.DIDCommMsg, thID string,
+	waciData *waciIssuanceData) *actionProblem {
+	manifest, err := parseCredentialManifest(waciData.CredentialManifest)
 	if err != nil {
-		handleError(w, http.StatusBadRequest,
-			fmt.Sprintf("failed to read redirect URI : %s", err))
+		return newActionProblem(problemCodeInternalError, "failed to parse credential manifest", err)
+	}
 
-		return
+	if manifest.PresentationDefinition == nil {
+		return nil
 	}
 
-	scope := r.Form.Get("scope")
-	state := r.Form.Get("state")
-	responseType := r.Form.Get("response_type")
-	clientID := r.Form.Get("client_id")
+	vpBytes, err := getCredentialApplicationAttachment(msg)
+	if err != nil {
+		return newActionProblem(problemCodeInvalidMessage, "failed to get credential application", err)
+	}
 
-	// basic validation only.
-	if claims == "" || redirectURI == "" || clientID == "" || state == "" {
-		handleError(w, http.StatusBadRequest, fmt.Sprintf("Invalid Request"))
+	_, verification := v.presVerifier.verifyApplication(vpBytes, manifest, waciData.Challenge, waciData.Domain)
 
-		return
+	v.publishEvent(&adapterEvent{Type: eventVerificationResult, SessionID: waciData.SessionID, ThreadID: thID,
+		Data: verification, Error: verificationError(verification)})
+
+	if !verification.Verified() {
+		logger.Warnf("credential application verification failed : thID=%s reason=%s", thID, verification.Error())
+
+		return &actionProblem{Code: problemCodeVerificationFailed, Description: verification.Error()}
 	}
 
-	authState := uuid.NewString()
+	return nil
+}
 
-	authRequest, err := json.Marshal(map[string]string{
-		"claims":        claims,
-		"scope":         scope,
-		"state":         state,
-		"response_type": responseType,
-		"client_id":     clientID,
-		"redirect_uri":  redirectURI,
-	})
+// verifyWACIPresentation verifies the presentation received on given thread against the share session and accepts
+// it, presentations failing verification are declined with a problem-report. The holder is redirected to the result
+// page in both cases.
+func (v *adapterApp) verifyWACIPresentation(action service.DIDCommAction) *actionProblem {
+	thID, err := action.Message.ThreadID()
 	if err != nil {
-		handleError(w, http.StatusInternalServerError,
-			fmt.Sprintf("failed to process authorization request : %s", err))
+		return newActionProblem(problemCodeInvalidMessage, "failed to get thread ID", err)
+	}
 
-		return
+	shareData, err := readWACIShareData(v.store, thID, "")
+	if err != nil {
+		return newActionProblem(problemCodeUnknownSession, "failed to get WACI share data", err)
 	}
 
-	err = v.store.Put(getAuthStateKeyPrefix(authState), authRequest)
+	pd := presexch.PresentationDefinition{}
+
+	err = json.Unmarshal(shareData.PresentationDefinition, &pd)
 	if err != nil {
-		handleError(w, http.StatusInternalServerError,
-			fmt.Sprintf("failed to save state : %s", err))
+		return newActionProblem(problemCodeInternalError, "failed to unmarshal presentation definition", err)
+	}
 
-		return
+	vpBytes, err := getPresentationAttachment(action.Message)
+	if err != nil {
+		shareData.Verification = &presentationVerification{}
+		shareData.Verification.add(presentationProofCheck, err)
+	} else {
+		_, shareData.Verification = v.presVerifier.verify(vpBytes, &presentationRequest{
+			Definition: &pd,
+			Challenge:  shareData.Challenge,
+			Domain:     shareData.Domain,
+		})
+		shareData.Presentation = vpBytes
+	}
+
+	err = saveWACIShareData(v.store, thID, shareData)
+	if err != nil {
+		return newActionProblem(problemCodeInternalError, "failed to save WACI share data", err)
 	}
 
-	authStateCookie := http.Cookie{
-		Name:    "state",
-		Value:   authState,
-		Expires: time.Now().Add(5 * time.Minute),
-		Path:    "/",
+	v.setSessionPresentation(shareData.SessionID, rawPresentation(shareData.Presentation), shareData.Verification)
+	v.publishEvent(&adapterEvent{Type: eventVerificationResult, SessionID: shareData.SessionID, ThreadID: thID,
+		Data: shareData.Verification, Error: verificationError(shareData.Verification)})
+
+	if !shareData.Verification.Verified() {
+		logger.Warnf("presentation verification failed : thID=%s reason=%s", thID, shareData.Verification.Error())
+
+		return &actionProblem{Code: problemCodeVerificationFailed, Description: shareData.Verification.Error()}
 	}
 
-	http.SetCookie(w, &authStateCookie)
-	http.Redirect(w, r, "/issuer/oidc/login", http.StatusFound)
+	action.Continue(presentproofsvc.WithProperties(
+		map[string]interface{}{
+			"~web-redirect": &decorator.WebRedirect{
+				Status: "OK",
+				URL:    actionRedirectURL(action.Message.Type(), thID),
+			},
+		},
+	))
+
+	return nil
 }
 
-func (v *adapterApp) issuerSendAuthorizeResponse(w http.ResponseWriter, r *http.Request) {
-	stateCookie, err := r.Cookie("state")
-	if err != nil {
-		handleError(w, http.StatusForbidden, "invalid state")
+// listenForConnections requests presentations of request-first share sessions once their DID exchange completes.
+func (v *adapterApp) listenForConnections(stateCh chan service.StateMsg) {
+	for msg := range stateCh {
+		if msg.Type != service.PostState || msg.StateID != didexchangesvc.StateIDCompleted {
+			continue
+		}
+
+		connectionID, _ := msg.Properties.All()["connectionID"].(string)
+
+		record, err := v.agent.ConnectionLookup.GetConnectionRecord(connectionID)
+		if err != nil {
+			logger.Errorf("failed to get connection %s : %s", connectionID, err)
+
+			continue
+		}
+
+		v.requestWACIPresentation(record)
+	}
+}
+
+// requestWACIPresentation sends the presentation request of the request-first share session the connection was
+// established for, connections of other sessions are ignored.
+func (v *adapterApp) requestWACIPresentation(record *connection.Record) {
+	shareData, err := readWACIShareData(v.store, record.InvitationID, "")
+	if errors.Is(err, storage.ErrDataNotFound) {
+		return
+	} else if err != nil {
+		logger.Errorf("failed to get WACI share data : %s", err)
 
 		return
 	}
 
-	authRqstBytes, err := v.store.Get(getAuthStateKeyPrefix(stateCookie.Value))
-	if err != nil {
-		handleError(w, http.StatusBadRequest, "invalid request")
+	if !shareData.RequestFirst {
+		return
+	}
 
+	// the wallet may have proposed already, the presentation was requested in response.
+	if !v.startSession(shareData.SessionID) {
 		return
 	}
 
-	var authRequest map[string]string
-	err = json.Unmarshal(authRqstBytes, &authRequest)
+	err = v.sendWACIPresentationRequest(record, shareData)
 	if err != nil {
-		handleError(w, http.StatusInternalServerError, "failed to read request")
+		logger.Errorf("failed to request presentation : %s", err)
 
-		return
+		v.failSession(shareData.SessionID, err.Error())
+		v.publishEvent(&adapterEvent{Type: eventError, SessionID: shareData.SessionID, Error: err.Error()})
 	}
+}
 
-	redirectURI, ok := authRequest["redirect_uri"]
-	if !ok {
-		handleError(w, http.StatusInternalServerError, "failed to redirect, invalid URL")
+func (v *adapterApp) sendWACIPresentationRequest(record *connection.Record, shareData *waciShareData) error {
+	pd := presexch.PresentationDefinition{}
 
-		return
+	err := json.Unmarshal(shareData.PresentationDefinition, &pd)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal presentation definition : %w", err)
 	}
 
-	state, ok := authRequest["state"]
-	if !ok {
-		handleError(w, http.StatusInternalServerError, "failed to redirect, invalid state")
+	shareData.Challenge, shareData.Domain = uuid.NewString(), uuid.NewString()
 
-		return
+	thID, err := v.agent.PresentProofClient.SendRequestPresentation(newWACIPresentationRequest(shareData, &pd), record)
+	if err != nil {
+		return fmt.Errorf("failed to send presentation request : %w", err)
 	}
 
-	authCode := uuid.NewString()
-	v.store.Put(getAuthCodeKeyPrefix(authCode), []byte(stateCookie.Value))
+	err = saveWACIShareData(v.store, thID, shareData)
+	if err != nil {
+		return fmt.Errorf("failed to save WACI share data : %w", err)
+	}
 
-	redirectTo := fmt.Sprintf("%s?code=%s&state=%s", redirectURI, authCode, state)
+	v.setThreadSession(thID, shareData.SessionID)
+	v.setSessionStatus(shareData.SessionID, sessionStatusInProgress)
+	v.publishEvent(&adapterEvent{Type: eventRequestSent, ThreadID: thID,
+		MessageType: presentproofsvc.RequestPresentationMsgTypeV2})
 
-	// TODO process credential types or manifests from claims and prepare credential endpoint with credential to be issued.
-	http.Redirect(w, r, redirectTo, http.StatusFound)
+	return nil
 }
 
-func (v *adapterApp) issuerTokenEndpoint(w http.ResponseWriter, r *http.Request) {
-	setOIDCResponseHeaders(w)
+func getPresentationAttachment(msg service.DIDCommMsg) ([]byte, error) {
+	msgMap, ok := msg.(service.DIDCommMsgMap)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", msg)
+	}
 
-	code := r.FormValue("code")
-	redirectURI := r.FormValue("redirect_uri")
-	grantType := r.FormValue("grant_type")
+	presentation := presentproof.Presentation{}
 
-	if grantType != "authorization_code" {
-		sendOIDCErrorResponse(w, "unsupported grant type", http.StatusBadRequest)
-		return
+	err := presentation.FromDIDCommMsgMap(msgMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode presentation message : %w", err)
 	}
 
-	authState, err := v.store.Get(getAuthCodeKeyPrefix(code))
-	if err != nil {
-		sendOIDCErrorResponse(w, "invalid state", http.StatusBadRequest)
-		return
+	if len(presentation.Attachments) == 0 {
+		return nil, errors.New("presentation message has no attachments")
 	}
 
-	authRqstBytes, err := v.store.Get(getAuthStateKeyPrefix(string(authState)))
-	if err != nil {
-		sendOIDCErrorResponse(w, "invalid request", http.StatusBadRequest)
-		return
+	return presentation.Attachments[0].Data.Fetch()
+}
+
+// getCredentialApplicationAttachment returns the credential application attached to the request-credential message,
+// preferring the attachment in credential application format over the first one.
+func getCredentialApplicationAttachment(msg service.DIDCommMsg) ([]byte, error) {
+	msgMap, ok := msg.(service.DIDCommMsgMap)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", msg)
 	}
 
-	var authRequest map[string]string
-	err = json.Unmarshal(authRqstBytes, &authRequest)
+	request := issuecredential.RequestCredentialParams{}
+
+	err := request.FromDIDCommMsgMap(msgMap)
 	if err != nil {
-		sendOIDCErrorResponse(w, "failed to read request", http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("failed to decode request credential message : %w", err)
 	}
 
-	if authRedirectURI := authRequest["redirect_uri"]; authRedirectURI != redirectURI {
-		sendOIDCErrorResponse(w, "request validation failed", http.StatusInternalServerError)
-		return
+	if len(request.Attachments) == 0 {
+		return nil, errors.New("request credential message has no attachments")
 	}
 
-	mockAccessToken := uuid.NewString()
-	mockIssuerID := mux.Vars(r)["id"]
+	attachment := request.Attachments[0]
 
-	err = v.store.Put(getAccessTokenKeyPrefix(mockAccessToken), []byte(mockIssuerID))
-	if err != nil {
-		sendOIDCErrorResponse(w, "failed to save token state", http.StatusInternalServerError)
-		return
+	for i := range request.Attachments {
+		if isCredentialApplicationAttachment(&request.Attachments[i], request.Formats) {
+			attachment = request.Attachments[i]
+
+			break
+		}
 	}
 
-	response, err := json.Marshal(map[string]interface{}{
-		"token_type":   "Bearer",
-		"access_token": mockAccessToken,
-		"expires_in":   3600 * time.Second,
-	})
-	// TODO add id_token, c_nonce, c_nonce_expires_in
-	if err != nil {
-		sendOIDCErrorResponse(w, "response_write_error", http.StatusBadRequest)
+	return attachment.Data.Fetch()
+}
 
-		return
+// isCredentialApplicationAttachment returns true if the attachment, or its entry in the formats of a DIDComm V1
+// message, is in credential application format.
+func isCredentialApplicationAttachment(attachment *decorator.GenericAttachment,
+	formats []issuecredential.Format) bool {
+	if attachment.Format == cm.CredentialApplicationAttachmentFormat {
+		return true
 	}
 
-	w.Write(response)
+	for _, format := range formats {
+		if format.AttachID == attachment.ID && format.Format == cm.CredentialApplicationAttachmentFormat {
+			return true
+		}
+	}
+
+	return false
 }
 
-func (v *adapterApp) issuerCredentialEndpoint(w http.ResponseWriter, r *http.Request) {
-	setOIDCResponseHeaders(w)
+// getInvitationID returns the ID of the OOB invitation which led to the connection the action was received on.
+func (v *adapterApp) getInvitationID(action service.DIDCommAction) (string, error) {
+	props := action.Properties.All()
 
-	format := r.FormValue("format")
-	credentialType := r.FormValue("type")
+	myDID, _ := props["myDID"].(string)
+	theirDID, _ := props["theirDID"].(string)
 
-	if format != "" && format != "ldp_vc" {
-		sendOIDCErrorResponse(w, "unsupported format requested", http.StatusBadRequest)
-		return
+	record, err := v.agent.ConnectionLookup.GetConnectionRecordByDIDs(myDID, theirDID)
+	if err == nil && record.InvitationID != "" {
+		return record.InvitationID, nil
 	}
 
-	authHeader := strings.Split(r.Header.Get("Authorization"), "Bearer ")
-	if len(authHeader) != 2 {
-		sendOIDCErrorResponse(w, "malformed token", http.StatusBadRequest)
-		return
+	if pthID := action.Message.ParentThreadID(); pthID != "" {
+		return pthID, nil
 	}
 
-	if authHeader[1] == "" {
-		sendOIDCErrorResponse(w, "invalid token", http.StatusForbidden)
-		return
+	return "", fmt.Errorf("failed to find connection for myDID=%s theirDID=%s", myDID, theirDID)
+}
+
+// actionTheirDID returns DID of the holder the action was received from, or an empty string if unknown.
+func actionTheirDID(action service.DIDCommAction) string {
+	if action.Properties == nil {
+		return ""
 	}
 
-	mockIssuerID := mux.Vars(r)["id"]
+	theirDID, _ := action.Properties.All()["theirDID"].(string)
 
-	issuerID, err := v.store.Get(getAccessTokenKeyPrefix(authHeader[1]))
+	return theirDID
+}
+
+// credentialProposalInvitationID returns the ID of the OOB invitation the propose-credential message answers.
+func credentialProposalInvitationID(msg service.DIDCommMsg) (string, error) {
+	var msgData map[string]interface{}
+
+	err := msg.Decode(&msgData)
 	if err != nil {
-		sendOIDCErrorResponse(w, "unsupported format requested", http.StatusBadRequest)
-		return
+		return "", err
 	}
 
-	if mockIssuerID != string(issuerID) {
-		sendOIDCErrorResponse(w, "invalid transaction", http.StatusForbidden)
-		return
+	var invitationID string
+	if invID, ok := msgData["invitationID"]; ok {
+		invitationID, _ = invID.(string)
+	} else if invID, ok := msgData["pthid"]; ok {
+		invitationID, _ = invID.(string)
 	}
 
-	credentialBytes, err := v.store.Get(getCredStoreKeyPrefix(mockIssuerID, credentialType))
-	if err != nil {
-		sendOIDCErrorResponse(w, "failed to get credential", http.StatusInternalServerError)
-		return
-	}
+	return invitationID, nil
+}
 
-	docLoader := ld.NewDefaultDocumentLoader(nil)
-	credential, err := verifiable.ParseCredential(credentialBytes, verifiable.WithJSONLDDocumentLoader(docLoader))
+func saveWACIShareData(store storage.Store, id string, shareData *waciShareData) error {
+	data, err := json.Marshal(shareData)
 	if err != nil {
-		sendOIDCErrorResponse(w, "failed to prepare credential", http.StatusInternalServerError)
-		return
+		return err
 	}
 
-	err = signCredentialWithED25519(credential)
+	return putWithLifetime(store, getWACIShareDataStoreKeyPrefix(id), data, sessionLifetime)
+}
+
+func readWACIShareData(store storage.Store, id string, newID string) (*waciShareData, error) {
+	data, err := store.Get(getWACIShareDataStoreKeyPrefix(id))
 	if err != nil {
-		sendOIDCErrorResponse(w, "failed to issue credential", http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	credBytes, err := credential.MarshalJSON()
+	var shareData waciShareData
+	err = json.Unmarshal(data, &shareData)
 	if err != nil {
-		sendOIDCErrorResponse(w, "failed to write credential bytes", http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	response, err := json.Marshal(map[string]interface{}{
-		"format":     format,
-		"credential": json.RawMessage(credBytes),
-	})
-	// TODO add support for acceptance token & nonce for deferred flow.
-	if err != nil {
-		sendOIDCErrorResponse(w, "response_write_error", http.StatusBadRequest)
-		return
+	if newID != "" {
+		err = putWithLifetime(store, getWACIShareDataStoreKeyPrefix(newID), data, sessionLifetime)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	w.Write(response)
+	return &shareData, nil
 }
 
-func listenForDIDCommMsg(actionCh chan service.DIDCommAction, store storage.Store) {
-	for action := range actionCh {
-		logger.Infof("received action message : type=%s", action.Message.Type())
-
-		switch action.Message.Type() {
-		case didexchange.RequestMsgType:
-			action.Continue(nil)
-		case presentproofsvc.ProposePresentationMsgTypeV2, presentproofsvc.ProposePresentationMsgTypeV3:
-			thID, err := action.Message.ThreadID()
-			if err != nil {
-				logger.Errorf("failed to get thread ID", err)
-				action.Stop(nil)
-			}
-
-			pd := presexch.PresentationDefinition{}
-			err = json.Unmarshal(pdBytes, &pd)
-			if err != nil {
-				logger.Errorf("failed to unmarshal presentation definition", err)
-				action.Stop(nil)
-			}
-
-			err = store.Put(thID, pdBytes)
-			if err != nil {
-				logger.Errorf("failed to save presentation definition", err)
-				action.Stop(nil)
-			}
-
-			continueArg := presentproof.WithRequestPresentation(&presentproof.RequestPresentation{
-				Comment: "Request Presentation",
-				Attachments: []decorator.GenericAttachment{
-					{
-						ID:        uuid.NewString(),
-						MediaType: "application/json",
-						Data: decorator.AttachmentData{
-							JSON: struct {
-								Challenge string                           `json:"challenge"`
-								Domain    string                           `json:"domain"`
-								PD        *presexch.PresentationDefinition `json:"presentation_definition"`
-							}{
-								Challenge: uuid.NewString(),
-								Domain:    uuid.NewString(),
-								PD:        &pd,
-							},
-						},
-					},
-				},
-				WillConfirm: true,
-			})
-
-			action.Continue(continueArg)
-		case presentproofsvc.PresentationMsgTypeV2, presentproofsvc.PresentationMsgTypeV3:
-			thID, err := action.Message.ThreadID()
-			if err != nil {
-				logger.Errorf("failed to get thread ID", err)
-				action.Stop(nil)
-			}
-
-			action.Continue(presentproofsvc.WithProperties(
-				map[string]interface{}{
-					"~web-redirect": &decorator.WebRedirect{
-						Status: "OK",
-						URL:    os.Getenv(demoExternalURLEnvKey) + "/verifier/waci-share/" + thID,
-					},
-				},
-			))
-		case issuecredential.ProposeCredentialMsgTypeV2, issuecredential.ProposeCredentialMsgTypeV3:
-			thID, err := action.Message.ThreadID()
-			if err != nil {
-				logger.Errorf("failed to get thread ID", err)
-				action.Stop(nil)
-			}
-
-			err = store.Put(thID, []byte(thID))
-			if err != nil {
-				logger.Errorf("failed to save interaction data", err)
-				action.Stop(nil)
-			}
-
-			var msgData map[string]interface{}
-			err = action.Message.Decode(&msgData)
-			if err != nil {
-				logger.Errorf("failed to decode propose credential message", err)
-				action.Stop(nil)
-			}
-
-			var invitationID string
-			if invID, ok := msgData["invitationID"]; ok {
-				invitationID, _ = invID.(string)
-			} else if invID, ok := msgData["pthid"]; ok {
-				invitationID, _ = invID.(string)
-			}
-
-			waciData, err := readWACIIssuanceData(store, invitationID, action.Message.ID())
-			if err != nil {
-				logger.Errorf("failed to get WACI issuance data", err)
-				action.Stop(nil)
-			}
-
-			vp, err := createResponseVP(waciData.CredentialResponse, waciData.Credential, false)
-			if err != nil {
-				logger.Errorf("failed to prepare response", err)
-				action.Stop(nil)
-			}
-
-			credResponseBytes, err := vp.MarshalJSON()
-			if err != nil {
-				logger.Errorf("failed to prepare response bytes", err)
-				action.Stop(nil)
-			}
-
-			offerCredMsg, err := createOfferCredentialMsg(waciData.CredentialManifest, credResponseBytes)
-			if err != nil {
-				logger.Errorf("failed to prepare offer credential message", err)
-				action.Stop(nil)
-			}
-
-			action.Continue(issuecredential.WithOfferCredential(offerCredMsg))
-		case issuecredential.RequestCredentialMsgTypeV2, issuecredential.RequestCredentialMsgTypeV3:
-			thID, err := action.Message.ThreadID()
-			if err != nil {
-				logger.Errorf("failed to get thread ID", err)
-				action.Stop(nil)
-			}
-
-			waciData, err := readWACIIssuanceData(store, thID, "")
-			if err != nil {
-				logger.Errorf("failed to get WACI issuance data", err)
-				action.Stop(nil)
-			}
-
-			vp, err := createResponseVP(waciData.CredentialResponse, waciData.Credential, true)
-			if err != nil {
-				logger.Errorf("failed to prepare response", err)
-				action.Stop(nil)
-			}
-
-			credResponseBytes, err := vp.MarshalJSON()
-			if err != nil {
-				logger.Errorf("failed to prepare response bytes", err)
-				action.Stop(nil)
-			}
-
-			issueCredMsg, err := createIssueCredentialMsg(credResponseBytes, os.Getenv(demoExternalURLEnvKey)+"/issuer/waci-issuance/"+thID)
-			if err != nil {
-				logger.Errorf("failed to prepare issue credential message", err)
-				action.Stop(nil)
-			}
-
-			action.Continue(issuecredential.WithIssueCredential(issueCredMsg))
-		default:
-			action.Stop(nil)
-		}
+func saveWACIIssuanceData(store storage.Store, id string, waciData *waciIssuanceData) error {
+	data, err := json.Marshal(waciData)
+	if err != nil {
+		return err
 	}
+
+	return putWithLifetime(store, getWACIIssuanceDataStoreKeyPrefix(id), data, sessionLifetime)
 }
 
-func readWACIIssuanceData(store storage.Store, id string, newID string) (*waciIssuanceData, error) {
+func readWACIIssuanceData(store storage.Store, id string) (*waciIssuanceData, error) {
 	data, err := store.Get(getWACIIssuanceDataStoreKeyPrefix(id))
 	if err != nil {
 		return nil, err
@@ -992,20 +2400,14 @@ func readWACIIssuanceData(store storage.Store, id string, newID string) (*waciIs
 		return nil, err
 	}
 
-	if newID != "" {
-		err = store.Put(getWACIIssuanceDataStoreKeyPrefix(newID), data)
-		if err != nil {
-			return nil, err
-		}
-	}
-
 	return &waciData, nil
 }
 
-func createOfferCredentialMsg(manifest, responseVP []byte) (*issuecredential.OfferCredentialParams, error) {
-	var credentialManifest cm.CredentialManifest
-
-	err := json.Unmarshal(manifest, &credentialManifest)
+// createOfferCredentialMsg returns the offer of the credential response of the issuance, with the challenge and domain
+// the credential application is signed with in the options of the manifest attachment.
+func createOfferCredentialMsg(waciData *waciIssuanceData,
+	responseVP []byte) (*issuecredential.OfferCredentialParams, error) {
+	credentialManifest, err := parseCredentialManifest(waciData.CredentialManifest)
 	if err != nil {
 		return nil, err
 	}
@@ -1020,7 +2422,7 @@ func createOfferCredentialMsg(manifest, responseVP []byte) (*issuecredential.Off
 
 	return &issuecredential.OfferCredentialParams{
 		Type:    issuecredential.OfferCredentialMsgTypeV2,
-		Comment: "Offer to issue University Degree Credential for Mr.Smith",
+		Comment: offerComment(waciData.CredentialManifest),
 		Formats: []issuecredential.Format{{
 			AttachID: attachID1,
 			Format:   format1,
@@ -1035,8 +2437,10 @@ func createOfferCredentialMsg(manifest, responseVP []byte) (*issuecredential.Off
 				Format:    format1,
 				Data: decorator.AttachmentData{
 					JSON: struct {
-						Manifest cm.CredentialManifest `json:"credential_manifest,omitempty"`
+						Options  *applicationOptions    `json:"options,omitempty"`
+						Manifest *cm.CredentialManifest `json:"credential_manifest,omitempty"`
 					}{
+						Options:  &applicationOptions{Challenge: waciData.Challenge, Domain: waciData.Domain},
 						Manifest: credentialManifest,
 					},
 				},
@@ -1056,10 +2460,7 @@ func createOfferCredentialMsg(manifest, responseVP []byte) (*issuecredential.Off
 func createIssueCredentialMsg(vp []byte, redirect string) (*issuecredential.IssueCredentialParams, error) {
 	attachID := uuid.New().String()
 
-	// change credential ID
-	vpStr := strings.ReplaceAll(string(vp), "http://example.gov/credentials/3732", "http://example.gov/credentials/"+uuid.NewString())
-
-	presentation, err := verifiable.ParsePresentation([]byte(vpStr), verifiable.WithPresDisabledProofCheck(),
+	presentation, err := verifiable.ParsePresentation(vp, verifiable.WithPresDisabledProofCheck(),
 		verifiable.WithPresJSONLDDocumentLoader(ld.NewDefaultDocumentLoader(nil)))
 	if err != nil {
 		return nil, err
@@ -1108,6 +2509,14 @@ func getWACIIssuanceDataStoreKeyPrefix(key string) string {
 	return fmt.Sprintf("waci_issuance_data_%s", key)
 }
 
+func getOIDCShareDataStoreKeyPrefix(key string) string {
+	return fmt.Sprintf("oidc_share_data_%s", key)
+}
+
+func getWACIShareDataStoreKeyPrefix(key string) string {
+	return fmt.Sprintf("waci_share_data_%s", key)
+}
+
 func setOIDCResponseHeaders(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Cache-Control", "no-store")
@@ -1119,45 +2528,16 @@ func sendOIDCErrorResponse(w http.ResponseWriter, msg string, status int) {
 	w.Write([]byte(fmt.Sprintf(`{"error": "%s"}`, msg)))
 }
 
-func signCredentialWithED25519(vc *verifiable.Credential) error {
-	edPriv := ed25519.PrivateKey(base58.Decode(pkBase58))
-	edSigner := &edd25519Signer{edPriv}
-	sigSuite := ed25519signature2018.New(suite.WithSigner(edSigner))
-
-	tt := time.Now()
-
-	ldpContext := &verifiable.LinkedDataProofContext{
-		SignatureType:           "Ed25519Signature2018",
-		SignatureRepresentation: verifiable.SignatureProofValue,
-		Suite:                   sigSuite,
-		VerificationMethod:      kid,
-		Purpose:                 "assertionMethod",
-		Created:                 &tt,
-	}
-
-	return vc.AddLinkedDataProof(ldpContext, jsonld.WithDocumentLoader(ld.NewDefaultDocumentLoader(nil)))
-}
-
-func signPresentationWithED25519(vc *verifiable.Presentation) error {
-	edPriv := ed25519.PrivateKey(base58.Decode(pkBase58))
-	edSigner := &edd25519Signer{edPriv}
-	sigSuite := ed25519signature2018.New(suite.WithSigner(edSigner))
-
-	tt := time.Now()
-
-	ldpContext := &verifiable.LinkedDataProofContext{
-		SignatureType:           "Ed25519Signature2018",
-		SignatureRepresentation: verifiable.SignatureProofValue,
-		Suite:                   sigSuite,
-		VerificationMethod:      kid,
-		Purpose:                 "authentication",
-		Created:                 &tt,
+// createResponseVP wraps credential response and credential of WACI issuance, templated for the holder DID, in a
+// presentation signed with the issuer key if sign is set. Signed credentials get an entry in the status list of the
+// issuer key.
+func (v *adapterApp) createResponseVP(waciData *waciIssuanceData, holderDID string,
+	sign bool) (*verifiable.Presentation, error) {
+	signer, err := v.issuerSigner(waciData.IssuerKey, waciData.Proof)
+	if err != nil {
+		return nil, err
 	}
 
-	return vc.AddLinkedDataProof(ldpContext, jsonld.WithDocumentLoader(ld.NewDefaultDocumentLoader(nil)))
-}
-
-func createResponseVP(response []byte, credential []byte, sign bool) (*verifiable.Presentation, error) {
 	presentation, err := verifiable.NewPresentation()
 	if err != nil {
 		return nil, err
@@ -1170,21 +2550,30 @@ func createResponseVP(response []byte, credential []byte, sign bool) (*verifiabl
 	presentation.CustomFields = make(map[string]interface{})
 
 	var responseMap map[string]interface{}
-	err = json.Unmarshal(response, &responseMap)
+	err = json.Unmarshal(waciData.CredentialResponse, &responseMap)
 	if err != nil {
 		return nil, err
 	}
 
 	presentation.CustomFields = responseMap
 
-	cred, err := verifiable.ParseCredential(credential, verifiable.WithJSONLDDocumentLoader(ld.NewDefaultDocumentLoader(nil)),
+	cred, err := verifiable.ParseCredential(waciData.Credential, verifiable.WithJSONLDDocumentLoader(v.documentLoader),
 		verifiable.WithDisabledProofCheck())
 	if err != nil {
 		return nil, err
 	}
 
+	templateCredential(cred, holderDID, time.Now())
+
 	if sign {
-		err = signCredentialWithED25519(cred)
+		signer.setIssuer(cred)
+
+		err = v.addCredentialStatus(cred, waciData.IssuerKey, waciData.StatusPurpose)
+		if err != nil {
+			return nil, err
+		}
+
+		err = signCredential(cred, signer, v.documentLoader)
 		if err != nil {
 			return nil, err
 		}
@@ -1193,7 +2582,7 @@ func createResponseVP(response []byte, credential []byte, sign bool) (*verifiabl
 	presentation.AddCredentials(cred)
 
 	if sign {
-		err = signPresentationWithED25519(presentation)
+		err = signPresentation(presentation, signer, v.documentLoader)
 		if err != nil {
 			return nil, err
 		}
@@ -1216,5 +2605,5 @@ func (s *edd25519Signer) Sign(doc []byte) ([]byte, error) {
 }
 
 func (s *edd25519Signer) Alg() string {
-	return ""
+	return "EdDSA"
 }
@@ -0,0 +1,220 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	presentproofsvc "github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/presentproof"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/presexch"
+	mockprovider "github.com/hyperledger/aries-framework-go/pkg/mock/provider"
+	"github.com/hyperledger/aries-framework-go/pkg/store/connection"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWACIShareData(t *testing.T) {
+	t.Run("concurrent share sessions are isolated", func(t *testing.T) {
+		store, err := mem.NewProvider().OpenStore("verifier")
+		require.NoError(t, err)
+
+		app := &adapterApp{store: store}
+
+		const sessions = 100
+
+		var wg sync.WaitGroup
+
+		errs := make(chan error, sessions)
+
+		for i := 0; i < sessions; i++ {
+			wg.Add(1)
+
+			go func(n int) {
+				defer wg.Done()
+
+				errs <- runShareSession(app, fmt.Sprintf("pd-%d", n))
+			}(i)
+		}
+
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("invalid presentation definition", func(t *testing.T) {
+		store, err := mem.NewProvider().OpenStore("verifier")
+		require.NoError(t, err)
+
+		app := &adapterApp{store: store}
+
+		err = app.persistWACIShareData(newFormRequest(url.Values{"pEx": {"{"}}), uuid.NewString())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid presentation definition")
+	})
+
+	t.Run("unknown session", func(t *testing.T) {
+		store, err := mem.NewProvider().OpenStore("verifier")
+		require.NoError(t, err)
+
+		_, err = readWACIShareData(store, uuid.NewString(), uuid.NewString())
+		require.Error(t, err)
+	})
+
+	t.Run("request first", func(t *testing.T) {
+		app := newTestAdapterApp(t)
+		invID := uuid.NewString()
+
+		err := app.persistWACIShareData(newFormRequest(url.Values{
+			"pEx":          {`{"id":"pd","input_descriptors":[{"id":"in"}]}`},
+			"requestFirst": {"true"},
+		}), invID)
+		require.NoError(t, err)
+
+		shareData, err := readWACIShareData(app.store, invID, "")
+		require.NoError(t, err)
+		require.True(t, shareData.RequestFirst)
+	})
+}
+
+func TestRequestWACIPresentation(t *testing.T) {
+	app := newTestAdapterApp(t)
+
+	t.Run("sessions waiting for a proposal are not requested", func(t *testing.T) {
+		invID := uuid.NewString()
+
+		require.NoError(t, saveWACIShareData(app.store, invID, &waciShareData{SessionID: invID}))
+		require.NoError(t, saveSession(app.store, &sessionData{ID: invID, Status: sessionStatusCreated}))
+
+		app.requestWACIPresentation(&connection.Record{InvitationID: invID})
+		require.Equal(t, sessionStatusCreated, getTestSession(t, app, invID).Status)
+	})
+
+	t.Run("connections of other invitations are ignored", func(t *testing.T) {
+		app.requestWACIPresentation(&connection.Record{InvitationID: uuid.NewString()})
+	})
+
+	t.Run("failure fails the session", func(t *testing.T) {
+		invID := uuid.NewString()
+
+		require.NoError(t, saveWACIShareData(app.store, invID, &waciShareData{
+			PresentationDefinition: []byte(`"invalid"`),
+			SessionID:              invID,
+			RequestFirst:           true,
+		}))
+		require.NoError(t, saveSession(app.store, &sessionData{ID: invID, Status: sessionStatusCreated}))
+
+		events := app.events.subscribe(&eventFilter{SessionID: invID})
+
+		app.requestWACIPresentation(&connection.Record{InvitationID: invID})
+
+		session := getTestSession(t, app, invID)
+		require.Equal(t, sessionStatusFailed, session.Status)
+		require.Contains(t, session.Error, "failed to unmarshal presentation definition")
+		require.Equal(t, eventError, (<-events).Type)
+	})
+
+	t.Run("DIDComm V2 sessions can not request first", func(t *testing.T) {
+		rr := postSessionRequest(t, app, &sessionRequest{
+			Type:         sessionTypeWACIShare,
+			DIDCommV2:    true,
+			PEx:          []byte(`{"id":"pd","input_descriptors":[{"id":"in"}]}`),
+			RequestFirst: true,
+		})
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "requires a DIDComm V1 invitation")
+	})
+
+	t.Run("presentation is requested once", func(t *testing.T) {
+		app.agent = &didComm{ConnectionLookup: newTestConnectionRecorder(t).Lookup}
+
+		invID := uuid.NewString()
+
+		require.NoError(t, saveWACIShareData(app.store, invID, &waciShareData{
+			PresentationDefinition: []byte(`"invalid"`),
+			SessionID:              invID,
+			RequestFirst:           true,
+		}))
+		require.NoError(t, saveSession(app.store, &sessionData{ID: invID, Status: sessionStatusInProgress}))
+
+		// the wallet proposed before the connection event was handled.
+		app.requestWACIPresentation(&connection.Record{InvitationID: invID})
+		require.Equal(t, sessionStatusInProgress, getTestSession(t, app, invID).Status)
+
+		// the wallet proposed after the presentation was requested on the connection.
+		stops := runTestActionWithProperties(t, app, service.DIDCommMsgMap{
+			"@id":     "proposal-1",
+			"@type":   presentproofsvc.ProposePresentationMsgTypeV2,
+			"~thread": map[string]interface{}{"pthid": invID},
+		}, testEventProperties{})
+		require.Len(t, stops, 1)
+		require.Equal(t, problemCodeInvalidMessage, stops[0].Code)
+		require.Contains(t, stops[0].Description, "presentation is already requested")
+	})
+}
+
+func newTestConnectionRecorder(t *testing.T) *connection.Recorder {
+	t.Helper()
+
+	recorder, err := connection.NewRecorder(&mockprovider.Provider{
+		StorageProviderValue:              mem.NewProvider(),
+		ProtocolStateStorageProviderValue: mem.NewProvider(),
+	})
+	require.NoError(t, err)
+
+	return recorder
+}
+
+func runShareSession(app *adapterApp, pdID string) error {
+	invID, thID := uuid.NewString(), uuid.NewString()
+
+	pEx := fmt.Sprintf(`{"id":%q,"input_descriptors":[{"id":%q}]}`, pdID, uuid.NewString())
+
+	err := app.persistWACIShareData(newFormRequest(url.Values{"pEx": {pEx}}), invID)
+	if err != nil {
+		return err
+	}
+
+	if _, err = readWACIShareData(app.store, invID, thID); err != nil {
+		return err
+	}
+
+	shareData, err := readWACIShareData(app.store, thID, "")
+	if err != nil {
+		return err
+	}
+
+	var pd presexch.PresentationDefinition
+
+	if err = json.Unmarshal(shareData.PresentationDefinition, &pd); err != nil {
+		return err
+	}
+
+	if pd.ID != pdID {
+		return fmt.Errorf("session %s got presentation definition %s", pdID, pd.ID)
+	}
+
+	return nil
+}
+
+func newFormRequest(form url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/verifier/waci-share", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return r
+}
@@ -92,6 +92,7 @@ type VPToken struct {
 }
 
 type OIDCTokenClaims struct {
+	Nonce   string        `json:"nonce"`
 	VPToken *VPTokenClaim `json:"_vp_token"`
 }
 
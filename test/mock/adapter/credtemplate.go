@@ -0,0 +1,101 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/util"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
+)
+
+// credentialValidity is the validity period of issued credentials whose template has no expiration date.
+const credentialValidity = 365 * 24 * time.Hour
+
+// templateCredential makes the submitted credential a fresh issuance: it gets a new ID, is issued at given time and
+// expires after the validity period of the template, and its subject is the holder DID if known. The issuer is set
+// by the signer.
+func templateCredential(vc *verifiable.Credential, holderDID string, now time.Time) {
+	validity := credentialValidity
+
+	if vc.Issued != nil && vc.Expired != nil && vc.Expired.Time.After(vc.Issued.Time) {
+		validity = vc.Expired.Time.Sub(vc.Issued.Time)
+	}
+
+	vc.ID = "urn:uuid:" + uuid.NewString()
+	vc.Issued = util.NewTime(now.UTC().Truncate(time.Second))
+	vc.Expired = util.NewTime(now.UTC().Truncate(time.Second).Add(validity))
+
+	if holderDID != "" {
+		setCredentialSubjectID(vc, holderDID)
+	}
+}
+
+// fillCredentialSubject sets the claims declared by the credential subject of the template, other claims of the
+// user are left out as the context of the credential may not define them. Subject ID is not a claim, it is set to the
+// holder DID.
+func fillCredentialSubject(vc *verifiable.Credential, claims map[string]interface{}) {
+	if len(claims) == 0 {
+		return
+	}
+
+	fill := func(fields map[string]interface{}) {
+		for name := range fields {
+			if value, ok := claims[name]; ok && name != "id" {
+				fields[name] = value
+			}
+		}
+	}
+
+	switch subject := vc.Subject.(type) {
+	case []verifiable.Subject:
+		for i := range subject {
+			fill(subject[i].CustomFields)
+		}
+	case verifiable.Subject:
+		fill(subject.CustomFields)
+	case map[string]interface{}:
+		fill(subject)
+	case []map[string]interface{}:
+		for i := range subject {
+			fill(subject[i])
+		}
+	}
+}
+
+// offerComment returns comment of a credential offer naming the credentials of the manifest and their issuer.
+func offerComment(manifest []byte) string {
+	var display manifestDisplay
+
+	err := json.Unmarshal(manifest, &display)
+	if err != nil {
+		return "Offer to issue credentials"
+	}
+
+	var names []string
+
+	for _, descriptor := range display.OutputDescriptors {
+		if descriptor != nil {
+			names = append(names, newCredentialDisplay(descriptor, display.Locale).Name)
+		}
+	}
+
+	comment := "Offer to issue credentials"
+	if len(names) > 0 {
+		comment = fmt.Sprintf("Offer to issue %s", strings.Join(names, ", "))
+	}
+
+	if display.Issuer.Name != "" {
+		comment = fmt.Sprintf("%s from %s", comment, display.Issuer.Name)
+	}
+
+	return comment
+}
@@ -0,0 +1,113 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateCredential(t *testing.T) {
+	loader := testDocumentLoader(t)
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	parse := func(t *testing.T, credential string) *verifiable.Credential {
+		t.Helper()
+
+		vc, err := verifiable.ParseCredential([]byte(credential), verifiable.WithDisabledProofCheck(),
+			verifiable.WithJSONLDDocumentLoader(loader))
+		require.NoError(t, err)
+
+		return vc
+	}
+
+	t.Run("fresh issuance", func(t *testing.T) {
+		first, second := parse(t, testCredential), parse(t, testCredential)
+
+		templateCredential(first, didKey, now)
+		templateCredential(second, didKey, now)
+
+		require.NotEqual(t, "http://example.gov/credentials/3732", first.ID)
+		require.NotEqual(t, first.ID, second.ID)
+		require.Equal(t, now, first.Issued.Time)
+		require.Equal(t, now.Add(credentialValidity), first.Expired.Time)
+		require.Equal(t, didKey, first.Subject.([]verifiable.Subject)[0].ID)
+	})
+
+	t.Run("validity of the template is kept", func(t *testing.T) {
+		vc := parse(t, `{
+			"@context": ["https://www.w3.org/2018/credentials/v1"],
+			"type": ["VerifiableCredential"],
+			"issuer": "did:example:issuer",
+			"issuanceDate": "2020-01-01T00:00:00Z",
+			"expirationDate": "2020-01-31T00:00:00Z",
+			"credentialSubject": {"id": "did:example:holder"}
+		}`)
+
+		templateCredential(vc, "", now)
+
+		require.Equal(t, now.Add(30*24*time.Hour), vc.Expired.Time)
+		require.Equal(t, "did:example:holder", vc.Subject.([]verifiable.Subject)[0].ID)
+	})
+}
+
+func TestFillCredentialSubject(t *testing.T) {
+	claims := map[string]interface{}{"id": "did:example:other", "givenName": "Alice"}
+
+	t.Run("subject of the template", func(t *testing.T) {
+		vc := &verifiable.Credential{Subject: []verifiable.Subject{{ID: "did:example:holder",
+			CustomFields: verifiable.CustomFields{"givenName": "John", "familyName": "Smith"}}}}
+
+		fillCredentialSubject(vc, claims)
+
+		subject := vc.Subject.([]verifiable.Subject)[0]
+		require.Equal(t, "did:example:holder", subject.ID)
+		require.Equal(t, verifiable.CustomFields{"givenName": "Alice", "familyName": "Smith"}, subject.CustomFields)
+	})
+
+	t.Run("claims the template does not declare", func(t *testing.T) {
+		vc := &verifiable.Credential{Subject: []verifiable.Subject{{ID: "did:example:holder",
+			CustomFields: verifiable.CustomFields{"familyName": "Smith"}}}}
+
+		fillCredentialSubject(vc, claims)
+
+		require.Equal(t, verifiable.CustomFields{"familyName": "Smith"}, vc.Subject.([]verifiable.Subject)[0].CustomFields)
+	})
+
+	t.Run("subject ID only", func(t *testing.T) {
+		vc := &verifiable.Credential{Subject: "did:example:holder"}
+
+		fillCredentialSubject(vc, claims)
+
+		require.Equal(t, "did:example:holder", vc.Subject)
+	})
+
+	t.Run("no claims", func(t *testing.T) {
+		vc := &verifiable.Credential{Subject: "did:example:holder"}
+
+		fillCredentialSubject(vc, nil)
+
+		require.Equal(t, "did:example:holder", vc.Subject)
+	})
+}
+
+func TestOfferComment(t *testing.T) {
+	require.Equal(t, "Offer to issue Permanent Resident Card, Driver's License from Example Government",
+		offerComment([]byte(`{
+			"issuer": {"id": "did:example:issuer", "name": "Example Government"},
+			"output_descriptors": [
+				{"id": "prc", "schema": "https://w3id.org/citizenship/v1", "name": "Permanent Resident Card"},
+				{"id": "dl", "schema": "https://w3id.org/dl/v1", "display": {"title": {"text": "Driver's License"}}}
+			]
+		}`)))
+
+	require.Equal(t, "Offer to issue udc", offerComment([]byte(`{"output_descriptors": [{"id": "udc"}]}`)))
+	require.Equal(t, "Offer to issue credentials", offerComment([]byte(`[]`)))
+}
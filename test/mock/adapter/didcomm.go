@@ -10,19 +10,22 @@ import (
 	"crypto"
 	"crypto/ed25519"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 
 	"github.com/google/uuid"
 	"github.com/hyperledger/aries-framework-go-ext/component/vdr/orb"
-	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
 	"github.com/hyperledger/aries-framework-go/pkg/client/didexchange"
 	"github.com/hyperledger/aries-framework-go/pkg/client/issuecredential"
 	"github.com/hyperledger/aries-framework-go/pkg/client/outofband"
 	"github.com/hyperledger/aries-framework-go/pkg/client/outofbandv2"
 	"github.com/hyperledger/aries-framework-go/pkg/client/presentproof"
 	"github.com/hyperledger/aries-framework-go/pkg/common/model"
+	ariescrypto "github.com/hyperledger/aries-framework-go/pkg/crypto"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/transport"
 	arieshttp "github.com/hyperledger/aries-framework-go/pkg/didcomm/transport/http"
 	"github.com/hyperledger/aries-framework-go/pkg/doc/did"
@@ -35,18 +38,36 @@ import (
 	"github.com/hyperledger/aries-framework-go/pkg/framework/aries/api/vdr"
 	"github.com/hyperledger/aries-framework-go/pkg/framework/aries/defaults"
 	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/hyperledger/aries-framework-go/pkg/store/connection"
 	"github.com/hyperledger/aries-framework-go/pkg/vdr/web"
 	"github.com/hyperledger/aries-framework-go/spi/storage"
+	jsonld "github.com/piprate/json-gold/ld"
 	tlsutils "github.com/trustbloc/edge-core/pkg/utils/tls"
 )
 
+// publicDIDV2StoreKey is the key of the orb DID of the agent in the agent store.
+const publicDIDV2StoreKey = "public_did_v2"
+
+// publicDIDV2Data is the orb DID of the agent and the issuer key of its assertion method.
+type publicDIDV2Data struct {
+	DID       string     `json:"did"`
+	IssuerKey *issuerKey `json:"issuer_key"`
+}
+
 type didComm struct {
 	OOBClient             *outofband.Client
 	OOBV2Client           *outofbandv2.Client
 	DIDExchClient         *didexchange.Client
 	PresentProofClient    *presentproof.Client
 	IssueCredentialClient *issuecredential.Client
+	ConnectionLookup      *connection.Lookup
+	Messenger             service.Messenger
+	VDRegistry            vdr.Registry
+	DocumentLoader        jsonld.DocumentLoader
 	OrbDIDV2              string
+	OrbIssuerKey          *issuerKey
+	KMS                   kms.KeyManager
+	Crypto                ariescrypto.Crypto
 }
 
 var (
@@ -70,9 +91,7 @@ var (
 	}
 )
 
-func startAriesAgent() (*didComm, error) {
-	storeProvider := mem.NewProvider()
-
+func startAriesAgent(storeProvider storage.Provider) (*didComm, error) {
 	var opts []aries.Option
 	opts = append(opts, aries.WithStoreProvider(storeProvider))
 
@@ -165,9 +184,14 @@ func startAriesAgent() (*didComm, error) {
 		return nil, fmt.Errorf("failed to create oob-client : %w", err)
 	}
 
-	publicDIDV2, err := createPublicDIDV2(vdri, ctx.KMS(), keyT, keyAgrT)
+	agentStore, err := storeProvider.OpenStore("agent")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create orb DID for OOB V2 invitations: %w", err)
+		return nil, fmt.Errorf("failed to open agent store: %w", err)
+	}
+
+	publicDIDV2, err := agentPublicDIDV2(agentStore, vdri, ctx.KMS(), keyT, keyAgrT)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orb DID for OOB V2 invitations: %w", err)
 	}
 
 	// out-of-band v2 client
@@ -194,39 +218,99 @@ func startAriesAgent() (*didComm, error) {
 		return nil, fmt.Errorf("failed to create issuecredential-client: %w", err)
 	}
 
+	// connection lookup
+	connectionLookup, err := connection.NewLookup(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection lookup: %w", err)
+	}
+
 	return &didComm{
 		OOBClient:             oobClient,
 		OOBV2Client:           oobV2Client,
 		DIDExchClient:         didExClient,
 		PresentProofClient:    presentProofClient,
 		IssueCredentialClient: issueCredentialClient,
-		OrbDIDV2:              publicDIDV2,
+		ConnectionLookup:      connectionLookup,
+		Messenger:             ctx.Messenger(),
+		VDRegistry:            ctx.VDRegistry(),
+		DocumentLoader:        ctx.JSONLDDocumentLoader(),
+		OrbDIDV2:              publicDIDV2.DID,
+		OrbIssuerKey:          publicDIDV2.IssuerKey,
+		KMS:                   ctx.KMS(),
+		Crypto:                ctx.Crypto(),
 	}, nil
 }
 
-func createPublicDIDV2(vdri vdr.VDR, km kms.KeyManager, keyType, keyAgreementType kms.KeyType) (string, error) {
+// agentPublicDIDV2 returns orb DID of the agent saved in the store, the DID is created on the first start.
+func agentPublicDIDV2(store storage.Store, vdri vdr.VDR, km kms.KeyManager, keyType,
+	keyAgreementType kms.KeyType) (*publicDIDV2Data, error) {
+	dataBytes, err := store.Get(publicDIDV2StoreKey)
+	if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		return nil, fmt.Errorf("failed to get saved orb DID: %w", err)
+	}
+
+	data := &publicDIDV2Data{}
+
+	if err == nil {
+		err = json.Unmarshal(dataBytes, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read saved orb DID: %w", err)
+		}
+
+		return data, nil
+	}
+
+	didDoc, err := createPublicDIDV2(vdri, km, keyType, keyAgreementType)
+	if err != nil {
+		return nil, err
+	}
+
+	data.DID = didDoc.ID
+
+	data.IssuerKey, err = orbIssuerKey(didDoc, keyType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read issuer key of orb DID: %w", err)
+	}
+
+	dataBytes, err = json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal orb DID: %w", err)
+	}
+
+	err = store.Put(publicDIDV2StoreKey, dataBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save orb DID: %w", err)
+	}
+
+	return data, nil
+}
+
+// createPublicDIDV2 creates orb DID of the agent, returned document is the one the DID was created from.
+func createPublicDIDV2(vdri vdr.VDR, km kms.KeyManager, keyType, keyAgreementType kms.KeyType) (*did.Doc, error) {
 	didDoc, err := buildDIDDocV2(km, keyType, keyAgreementType)
 	if err != nil {
-		return "", fmt.Errorf("failed to create DID doc: %w", err)
+		return nil, fmt.Errorf("failed to create DID doc: %w", err)
 	}
 
 	updateKey, err := newKey(km)
 	if err != nil {
-		return "", fmt.Errorf("failed to create udpateKey for vdri.Create(): %w", err)
+		return nil, fmt.Errorf("failed to create udpateKey for vdri.Create(): %w", err)
 	}
 
 	recoveryKey, err := newKey(km)
 	if err != nil {
-		return "", fmt.Errorf("failed to create recoveryKey for vdri.Create(): %w", err)
+		return nil, fmt.Errorf("failed to create recoveryKey for vdri.Create(): %w", err)
 	}
 
 	docRes, err := vdri.Create(didDoc, vdr.WithOption(orb.UpdatePublicKeyOpt, updateKey),
 		vdr.WithOption(orb.RecoveryPublicKeyOpt, recoveryKey))
 	if err != nil {
-		return "", fmt.Errorf("failed to create orb DID from VDRI: %w", err)
+		return nil, fmt.Errorf("failed to create orb DID from VDRI: %w", err)
 	}
 
-	return docRes.DIDDocument.ID, nil
+	didDoc.ID = docRes.DIDDocument.ID
+
+	return didDoc, nil
 }
 
 func newKey(km kms.KeyManager) (crypto.PublicKey, error) {
@@ -247,6 +331,9 @@ func buildDIDDocV2(km kms.KeyManager, keyType, keyAgreementType kms.KeyType) (*d
 	}
 
 	didDoc.Authentication = append(didDoc.Authentication, *auth)
+	// the authentication key also signs credentials issued with the orb DID.
+	didDoc.AssertionMethod = append(didDoc.AssertionMethod,
+		*did.NewReferencedVerification(&auth.VerificationMethod, did.AssertionMethod))
 
 	kagr, err := createVerification("#key-2", km, keyAgreementType, did.KeyAgreement)
 	if err != nil {
@@ -0,0 +1,246 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/didexchange"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/issuecredential"
+	presentproofsvc "github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/presentproof"
+)
+
+// event types.
+const (
+	eventInvitationCreated     = "invitation-created"
+	eventDIDExchangeRequest    = "didexchange-request"
+	eventProposalReceived      = "propose-received"
+	eventRequestReceived       = "request-received"
+	eventRequestSent           = "request-sent"
+	eventPresentationReceived  = "presentation-received"
+	eventMessageReceived       = "message-received"
+	eventTokenIssued           = "token-issued"
+	eventCredentialIssued      = "credential-issued"
+	eventVerificationResult    = "verification-result"
+	eventProblemReportReceived = "problem-report-received"
+	eventError                 = "error"
+)
+
+const (
+	// eventBufferSize is the number of events a subscriber can fall behind before further events are dropped.
+	eventBufferSize = 64
+
+	// eventKeepAliveInterval is the interval of comments keeping idle event streams open through proxies.
+	eventKeepAliveInterval = 15 * time.Second
+)
+
+// adapterEvent is an event of an issuance or share session published on the event stream.
+type adapterEvent struct {
+	Type      string `json:"type"`
+	SessionID string `json:"session_id,omitempty"`
+	ThreadID  string `json:"thread_id,omitempty"`
+	// MessageType is the type of the DIDComm message the event is about.
+	MessageType string      `json:"message_type,omitempty"`
+	Data        interface{} `json:"data,omitempty"`
+	Error       string      `json:"error,omitempty"`
+	Time        time.Time   `json:"time"`
+}
+
+// eventFilter selects events of a session or a thread, the zero filter selects all events.
+type eventFilter struct {
+	SessionID string
+	ThreadID  string
+}
+
+func (f *eventFilter) matches(event *adapterEvent) bool {
+	return (f.SessionID == "" || f.SessionID == event.SessionID) && (f.ThreadID == "" || f.ThreadID == event.ThreadID)
+}
+
+// eventBroker delivers published events to subscribers of the event stream.
+type eventBroker struct {
+	subscribers map[chan *adapterEvent]*eventFilter
+	lock        sync.RWMutex
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{subscribers: make(map[chan *adapterEvent]*eventFilter)}
+}
+
+// subscribe returns channel receiving events selected by the filter.
+func (b *eventBroker) subscribe(filter *eventFilter) chan *adapterEvent {
+	events := make(chan *adapterEvent, eventBufferSize)
+
+	b.lock.Lock()
+	b.subscribers[events] = filter
+	b.lock.Unlock()
+
+	return events
+}
+
+func (b *eventBroker) unsubscribe(events chan *adapterEvent) {
+	b.lock.Lock()
+	delete(b.subscribers, events)
+	b.lock.Unlock()
+}
+
+// publish delivers the event to matching subscribers, events are dropped for subscribers which fell behind so that
+// slow readers never block protocol handling.
+func (b *eventBroker) publish(event *adapterEvent) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	for events, filter := range b.subscribers {
+		if !filter.matches(event) {
+			continue
+		}
+
+		select {
+		case events <- event:
+		default:
+			logger.Warnf("event stream subscriber fell behind, dropping %s event", event.Type)
+		}
+	}
+}
+
+// publishEvent publishes the event, events of threads are attributed to the session the thread belongs to.
+func (v *adapterApp) publishEvent(event *adapterEvent) {
+	event.Time = time.Now()
+
+	if event.SessionID == "" {
+		event.SessionID = v.threadSession(event.ThreadID)
+	}
+
+	v.events.publish(event)
+}
+
+// setThreadSession attributes events of the DIDComm thread to given session.
+func (v *adapterApp) setThreadSession(thID, sessionID string) {
+	if thID == "" || sessionID == "" {
+		return
+	}
+
+	err := putWithLifetime(v.store, getThreadSessionKeyPrefix(thID), []byte(sessionID), sessionLifetime)
+	if err != nil {
+		logger.Errorf("failed to save session of thread %s : %s", thID, err)
+	}
+}
+
+// threadSession returns ID of the session the DIDComm thread belongs to, or an empty string.
+func (v *adapterApp) threadSession(thID string) string {
+	if thID == "" {
+		return ""
+	}
+
+	sessionID, err := v.store.Get(getThreadSessionKeyPrefix(thID))
+	if err != nil {
+		return ""
+	}
+
+	return string(sessionID)
+}
+
+// publishActionEvent publishes receipt of the DIDComm action message.
+func (v *adapterApp) publishActionEvent(action service.DIDCommAction) {
+	event := &adapterEvent{Type: actionEventType(action.Message.Type()), MessageType: action.Message.Type()}
+	// messages without thread are published too.
+	event.ThreadID, _ = action.Message.ThreadID()
+
+	// sessions are identified by the OOB invitation which DID exchange requests and proposals answer, threads of
+	// proposals carry the rest of the session. Failures to find the invitation are reported by the action handler.
+	switch action.Message.Type() {
+	case didexchange.RequestMsgType:
+		event.SessionID = action.Message.ParentThreadID()
+	case presentproofsvc.ProposePresentationMsgTypeV2, presentproofsvc.ProposePresentationMsgTypeV3:
+		event.SessionID, _ = v.getInvitationID(action)
+		v.setThreadSession(event.ThreadID, event.SessionID)
+	case issuecredential.ProposeCredentialMsgTypeV2, issuecredential.ProposeCredentialMsgTypeV3:
+		event.SessionID, _ = credentialProposalInvitationID(action.Message)
+		v.setThreadSession(event.ThreadID, event.SessionID)
+	}
+
+	v.publishEvent(event)
+}
+
+func actionEventType(msgType string) string {
+	switch msgType {
+	case didexchange.RequestMsgType:
+		return eventDIDExchangeRequest
+	case presentproofsvc.ProposePresentationMsgTypeV2, presentproofsvc.ProposePresentationMsgTypeV3,
+		issuecredential.ProposeCredentialMsgTypeV2, issuecredential.ProposeCredentialMsgTypeV3:
+		return eventProposalReceived
+	case issuecredential.RequestCredentialMsgTypeV2, issuecredential.RequestCredentialMsgTypeV3:
+		return eventRequestReceived
+	case presentproofsvc.PresentationMsgTypeV2, presentproofsvc.PresentationMsgTypeV3:
+		return eventPresentationReceived
+	default:
+		return eventMessageReceived
+	}
+}
+
+// streamEvents streams events as server-sent events, session and thread query parameters select events of a session
+// or thread.
+func (v *adapterApp) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		handleError(w, http.StatusInternalServerError, "streaming is not supported")
+
+		return
+	}
+
+	events := v.events.subscribe(&eventFilter{
+		SessionID: r.URL.Query().Get("session"),
+		ThreadID:  r.URL.Query().Get("thread"),
+	})
+	defer v.events.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-events:
+			eventBytes, err := json.Marshal(event)
+			if err != nil {
+				logger.Errorf("failed to marshal %s event : %s", event.Type, err)
+
+				continue
+			}
+
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, eventBytes)
+		}
+
+		flusher.Flush()
+	}
+}
+
+// verificationError returns the failed checks of the verification, or an empty string if it succeeded.
+func verificationError(verification *presentationVerification) string {
+	if verification.Verified() {
+		return ""
+	}
+
+	return verification.Error()
+}
+
+func getThreadSessionKeyPrefix(thID string) string {
+	return fmt.Sprintf("thread_session_%s", thID)
+}
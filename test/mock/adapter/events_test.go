@@ -0,0 +1,95 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBroker(t *testing.T) {
+	app := newTestAdapterApp(t)
+
+	all := app.events.subscribe(&eventFilter{})
+	session := app.events.subscribe(&eventFilter{SessionID: "session-1"})
+	thread := app.events.subscribe(&eventFilter{ThreadID: "thread-1"})
+
+	app.setThreadSession("thread-1", "session-1")
+
+	app.publishEvent(&adapterEvent{Type: eventInvitationCreated, SessionID: "session-1"})
+	app.publishEvent(&adapterEvent{Type: eventProposalReceived, ThreadID: "thread-1"})
+	app.publishEvent(&adapterEvent{Type: eventInvitationCreated, SessionID: "session-2"})
+
+	require.Len(t, all, 3)
+	require.Len(t, session, 2)
+	require.Len(t, thread, 1)
+
+	<-session
+
+	// events of threads are attributed to their session.
+	event := <-session
+	require.Equal(t, eventProposalReceived, event.Type)
+	require.Equal(t, "session-1", event.SessionID)
+	require.False(t, event.Time.IsZero())
+
+	app.events.unsubscribe(thread)
+
+	// subscribers which fell behind do not block publishing.
+	for i := 0; i < eventBufferSize; i++ {
+		app.publishEvent(&adapterEvent{Type: eventError})
+	}
+
+	require.Len(t, all, eventBufferSize)
+
+	// unsubscribed channels receive no further events.
+	require.Len(t, thread, 1)
+}
+
+func TestStreamEvents(t *testing.T) {
+	app := newTestAdapterApp(t)
+
+	server := httptest.NewServer(http.HandlerFunc(app.streamEvents))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"?session=session-1", nil)
+	require.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	defer resp.Body.Close() //nolint:errcheck // test stream
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	app.publishEvent(&adapterEvent{Type: eventInvitationCreated, SessionID: "session-2"})
+	app.publishEvent(&adapterEvent{Type: eventTokenIssued, SessionID: "session-1"})
+
+	reader := bufio.NewReader(resp.Body)
+
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "event: "+eventTokenIssued+"\n", line)
+
+	line, err = reader.ReadString('\n')
+	require.NoError(t, err)
+
+	var event adapterEvent
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event))
+	require.Equal(t, eventTokenIssued, event.Type)
+	require.Equal(t, "session-1", event.SessionID)
+}
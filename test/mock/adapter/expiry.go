@@ -0,0 +1,159 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+const (
+	// expiresAtTagName is the tag holding unix time at which a record expires.
+	expiresAtTagName = "expiresAt"
+
+	// sessionLifetime is how long state of WACI and OIDC sessions and of mock issuers is kept.
+	sessionLifetime = 24 * time.Hour
+
+	// sweepInterval is the interval at which expired records are deleted from the store.
+	sweepInterval = time.Minute
+)
+
+// errRecordExpired is returned when an expired record is looked up, callers not interested in the difference can
+// treat it as storage.ErrDataNotFound.
+var errRecordExpired = fmt.Errorf("record expired : %w", storage.ErrDataNotFound)
+
+// expiringStore rejects lookups of records that outlived their lifetime. Records saved without lifetime never expire.
+type expiringStore struct {
+	storage.Store
+}
+
+func newExpiringStore(store storage.Store) *expiringStore {
+	return &expiringStore{Store: store}
+}
+
+// Get returns the value stored under given key, or errRecordExpired if the record expired.
+func (s *expiringStore) Get(key string) ([]byte, error) {
+	value, err := s.Store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := s.Store.GetTags(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if isExpired(tags, time.Now()) {
+		// the sweeper deletes it otherwise.
+		if err := s.Store.Delete(key); err != nil {
+			logger.Warnf("failed to delete expired record %s : %s", key, err)
+		}
+
+		return nil, errRecordExpired
+	}
+
+	return value, nil
+}
+
+// putWithLifetime stores the value under given key, the record expires after given lifetime.
+func putWithLifetime(store storage.Store, key string, value []byte, lifetime time.Duration) error {
+	return store.Put(key, value, storage.Tag{
+		Name:  expiresAtTagName,
+		Value: strconv.FormatInt(time.Now().Add(lifetime).Unix(), 10),
+	})
+}
+
+func isExpired(tags []storage.Tag, now time.Time) bool {
+	for _, tag := range tags {
+		if tag.Name != expiresAtTagName {
+			continue
+		}
+
+		expiresAt, err := strconv.ParseInt(tag.Value, 10, 64)
+
+		return err == nil && !now.Before(time.Unix(expiresAt, 0))
+	}
+
+	return false
+}
+
+// sweepExpiredRecords deletes records expired at given time from the store and returns number of deleted records.
+func sweepExpiredRecords(store storage.Store, now time.Time) (int, error) {
+	expired, err := expiredRecordKeys(store, now)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, key := range expired {
+		err = store.Delete(key)
+		if err != nil {
+			return i, fmt.Errorf("failed to delete expired record %s : %w", key, err)
+		}
+	}
+
+	return len(expired), nil
+}
+
+func expiredRecordKeys(store storage.Store, now time.Time) ([]string, error) {
+	iter, err := store.Query(expiresAtTagName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expiring records : %w", err)
+	}
+
+	defer func() {
+		if e := iter.Close(); e != nil {
+			logger.Warnf("failed to close iterator : %s", e)
+		}
+	}()
+
+	var expired []string
+
+	for {
+		ok, err := iter.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read expiring records : %w", err)
+		}
+
+		if !ok {
+			return expired, nil
+		}
+
+		key, err := iter.Key()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read expiring record key : %w", err)
+		}
+
+		tags, err := iter.Tags()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tags of record %s : %w", key, err)
+		}
+
+		if isExpired(tags, now) {
+			expired = append(expired, key)
+		}
+	}
+}
+
+// sweepExpiredRecordsPeriodically deletes expired records from the store at given interval, it never returns.
+func (v *adapterApp) sweepExpiredRecordsPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		count, err := sweepExpiredRecords(v.store, now)
+		if err != nil {
+			logger.Errorf("failed to sweep expired records : %s", err)
+		}
+
+		if count > 0 {
+			logger.Debugf("deleted %d expired records", count)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiringStore(t *testing.T) {
+	app := newTestAdapterApp(t)
+
+	require.NoError(t, putWithLifetime(app.store, "expired", []byte("v1"), -time.Second))
+	require.NoError(t, putWithLifetime(app.store, "valid", []byte("v2"), time.Minute))
+	require.NoError(t, app.store.Put("permanent", []byte("v3")))
+
+	_, err := app.store.Get("expired")
+	require.ErrorIs(t, err, errRecordExpired)
+	require.ErrorIs(t, err, storage.ErrDataNotFound)
+
+	// expired records are deleted on lookup.
+	_, err = app.store.Get("expired")
+	require.ErrorIs(t, err, storage.ErrDataNotFound)
+	require.NotErrorIs(t, err, errRecordExpired)
+
+	value, err := app.store.Get("valid")
+	require.NoError(t, err)
+	require.Equal(t, []byte("v2"), value)
+
+	value, err = app.store.Get("permanent")
+	require.NoError(t, err)
+	require.Equal(t, []byte("v3"), value)
+}
+
+func TestSweepExpiredRecords(t *testing.T) {
+	app := newTestAdapterApp(t)
+
+	require.NoError(t, putWithLifetime(app.store, "k1", []byte("v1"), time.Minute))
+	require.NoError(t, putWithLifetime(app.store, "k2", []byte("v2"), time.Hour))
+	require.NoError(t, app.store.Put("k3", []byte("v3")))
+
+	count, err := sweepExpiredRecords(app.store, time.Now())
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	count, err = sweepExpiredRecords(app.store, time.Now().Add(2*time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	_, err = app.store.Get("k1")
+	require.ErrorIs(t, err, storage.ErrDataNotFound)
+
+	count, err = sweepExpiredRecords(app.store, time.Now().Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	_, err = app.store.Get("k3")
+	require.NoError(t, err)
+}
+
+func TestExpiredOAuthRecords(t *testing.T) {
+	app, accessToken, _ := newTestIssuer(t, &issuerSettings{})
+
+	t.Run("pre-authorized code", func(t *testing.T) {
+		dataBytes, err := json.Marshal(&preAuthorizedCodeData{IssuerID: "issuer-1"})
+		require.NoError(t, err)
+		require.NoError(t, putWithLifetime(app.store, getPreAuthorizedCodeKeyPrefix("expired"), dataBytes,
+			-time.Second))
+
+		rr := postTokenRequest(app, "issuer-1", url.Values{"grant_type": {preAuthorizedCodeGrantType},
+			"pre-authorized_code": {"expired"}})
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), errInvalidGrant)
+		require.Contains(t, rr.Body.String(), "pre-authorized code expired")
+	})
+
+	t.Run("authorization code", func(t *testing.T) {
+		dataBytes, err := json.Marshal(&authCodeData{AuthState: "state", ExpiresAt: time.Now().Add(time.Minute)})
+		require.NoError(t, err)
+		require.NoError(t, putWithLifetime(app.store, getAuthCodeKeyPrefix("expired"), dataBytes, -time.Second))
+
+		_, oauthErr := redeemAuthCode(app.store, "expired")
+		require.NotNil(t, oauthErr)
+		require.Equal(t, errInvalidGrant, oauthErr.Code)
+		require.Equal(t, "authorization code expired", oauthErr.Description)
+	})
+
+	t.Run("access token", func(t *testing.T) {
+		tokenData, err := readAccessToken(app.store, accessToken)
+		require.NoError(t, err)
+
+		tokenData.ExpiresAt = time.Now().Add(-time.Second)
+		require.NoError(t, saveAccessToken(app.store, accessToken, tokenData))
+
+		rr := postCredentialRequest(t, app, "issuer-1", accessToken, nil)
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+		require.Contains(t, rr.Body.String(), errInvalidToken)
+		require.Contains(t, rr.Body.String(), "access token expired")
+	})
+}
@@ -0,0 +1,491 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/gorilla/mux"
+	ariescrypto "github.com/hyperledger/aries-framework-go/pkg/crypto"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/did"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/jose/jwk"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/jose/jwk/jwksupport"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/jsonld"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/util/jwkkid"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/fingerprint"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/piprate/json-gold/ld"
+)
+
+// DID methods issuer keys can be published in.
+const (
+	didMethodKey = "key"
+	didMethodWeb = "web"
+	didMethodOrb = "orb"
+)
+
+// startupIssuerKeyStoreKey is the key of the issuer key created at startup in the adapter store.
+const startupIssuerKeyStoreKey = "startup_issuer_key"
+
+const (
+	jsonWebKey2020    = "JsonWebKey2020"
+	bls12381G2Key2020 = "Bls12381G2Key2020"
+)
+
+// issuerKeyTypes are types of keys issuers can sign with, named as in keyTypes.
+//
+//nolint:gochecknoglobals // translation table of supported subset of keyTypes
+var issuerKeyTypes = map[string]kms.KeyType{
+	"ed25519":           kms.ED25519Type,
+	"ecdsap256ieee1363": kms.ECDSAP256TypeIEEEP1363,
+	"ecdsap384ieee1363": kms.ECDSAP384TypeIEEEP1363,
+	"bls12381g2":        kms.BLS12381G2Type,
+}
+
+// issuerKey is a signing identity of an issuer, a key published as a verification method of a DID.
+type issuerKey struct {
+	DID     string      `json:"did"`
+	KeyID   string      `json:"key_id"`
+	KeyType kms.KeyType `json:"key_type"`
+	// KMSKeyID is ID of the key in the agent KMS, empty for the built-in did:key.
+	KMSKeyID string `json:"kms_key_id,omitempty"`
+}
+
+// defaultIssuerKey is the built-in did:key identity used when no signing identity is configured.
+func defaultIssuerKey() *issuerKey {
+	return &issuerKey{DID: didKey, KeyID: kid, KeyType: kms.ED25519Type}
+}
+
+// signingKeyType returns type of given issuer key, nil key is the built-in Ed25519 did:key.
+func signingKeyType(key *issuerKey) kms.KeyType {
+	if key == nil {
+		return kms.ED25519Type
+	}
+
+	return key.KeyType
+}
+
+// issuerSigner signs credentials and presentations with a signing identity of an issuer.
+type issuerSigner struct {
+	key    *issuerKey
+	signer verifiable.Signer
+	// proof is format of linked data proofs, nil for the default of the key type.
+	proof *proofFormat
+}
+
+// kmsSigner signs with a key of the agent KMS. BBS+ keys sign each line of the data as a separate message.
+type kmsSigner struct {
+	keyHandle interface{}
+	crypto    ariescrypto.Crypto
+	multiMsg  bool
+	alg       string
+}
+
+func (s *kmsSigner) Sign(data []byte) ([]byte, error) {
+	if s.multiMsg {
+		return s.crypto.SignMulti(textToLines(string(data)), s.keyHandle)
+	}
+
+	return s.crypto.Sign(data, s.keyHandle)
+}
+
+func (s *kmsSigner) Alg() string {
+	return s.alg
+}
+
+// startupIssuerKeyData is the issuer key created at startup with the configuration it was created for.
+type startupIssuerKeyData struct {
+	KeyType   string     `json:"key_type"`
+	DIDMethod string     `json:"did_method"`
+	BaseURL   string     `json:"base_url"`
+	Key       *issuerKey `json:"key,omitempty"`
+}
+
+// startupIssuerKey returns the issuer key saved by an earlier start with the same configuration, otherwise it creates
+// one at the default issuer path and saves it.
+func (v *adapterApp) startupIssuerKey(keyTypeName, didMethod, baseURL string) (*issuerKey, error) {
+	data := &startupIssuerKeyData{KeyType: keyTypeName, DIDMethod: didMethod, BaseURL: baseURL}
+
+	savedBytes, err := v.store.Get(startupIssuerKeyStoreKey)
+	if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		return nil, fmt.Errorf("failed to get saved issuer key : %w", err)
+	}
+
+	if err == nil {
+		var saved startupIssuerKeyData
+
+		err = json.Unmarshal(savedBytes, &saved)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read saved issuer key : %w", err)
+		}
+
+		if saved.KeyType == data.KeyType && saved.DIDMethod == data.DIDMethod && saved.BaseURL == data.BaseURL {
+			return saved.Key, nil
+		}
+	}
+
+	data.Key, err = v.createIssuerKey(keyTypeName, didMethod, baseURL, defaultIssuerPath)
+	if err != nil {
+		return nil, err
+	}
+
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal issuer key : %w", err)
+	}
+
+	err = v.store.Put(startupIssuerKeyStoreKey, dataBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save issuer key : %w", err)
+	}
+
+	return data.Key, nil
+}
+
+// createIssuerKey creates a key of given type in the agent KMS and publishes it in a DID of given method. Keys of
+// did:web DIDs are published at the did.json of given issuer path on the base URL of the adapter. The agent's orb DID
+// is shared by all issuers and only has a key of the agent key type. No key is created without a DID method.
+func (v *adapterApp) createIssuerKey(keyTypeName, didMethod, baseURL, issuerPath string) (*issuerKey, error) {
+	if didMethod == "" {
+		return nil, nil
+	}
+
+	keyType := kms.ED25519Type
+
+	if keyTypeName != "" {
+		kt, ok := issuerKeyTypes[keyTypeName]
+		if !ok {
+			return nil, fmt.Errorf("unsupported issuer key type %s", keyTypeName)
+		}
+
+		keyType = kt
+	}
+
+	if didMethod == didMethodOrb {
+		if v.orbIssuerKey == nil {
+			return nil, fmt.Errorf("orb DID is not available")
+		}
+
+		if keyTypeName != "" && keyType != v.orbIssuerKey.KeyType {
+			return nil, fmt.Errorf("orb DID has no %s key", keyTypeName)
+		}
+
+		return v.orbIssuerKey, nil
+	}
+
+	if didMethod != didMethodKey && didMethod != didMethodWeb {
+		return nil, fmt.Errorf("unsupported issuer DID method %s", didMethod)
+	}
+
+	kmsKeyID, pkBytes, err := v.kms.CreateAndExportPubKeyBytes(keyType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create issuer key : %w", err)
+	}
+
+	key := &issuerKey{KeyType: keyType, KMSKeyID: kmsKeyID}
+
+	if didMethod == didMethodKey {
+		switch keyType { //nolint:exhaustive // other key types are published as JWK
+		case kms.ED25519Type:
+			key.DID, key.KeyID = fingerprint.CreateDIDKey(pkBytes)
+
+			return key, nil
+		case kms.BLS12381G2Type:
+			key.DID, key.KeyID = fingerprint.CreateDIDKeyByCode(fingerprint.BLS12381g2PubKeyMultiCodec, pkBytes)
+
+			return key, nil
+		}
+
+		j, e := buildJWK(pkBytes, keyType)
+		if e != nil {
+			return nil, e
+		}
+
+		key.DID, key.KeyID, err = fingerprint.CreateDIDKeyByJwk(j)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create did:key : %w", err)
+		}
+
+		return key, nil
+	}
+
+	key.DID, err = webDID(baseURL, issuerPath)
+	if err != nil {
+		return nil, err
+	}
+
+	key.KeyID = key.DID + "#key-1"
+
+	var vm *did.VerificationMethod
+
+	if keyType == kms.BLS12381G2Type {
+		vm = did.NewVerificationMethodFromBytes(key.KeyID, bls12381G2Key2020, key.DID, pkBytes)
+	} else {
+		j, e := buildJWK(pkBytes, keyType)
+		if e != nil {
+			return nil, e
+		}
+
+		vm, err = did.NewVerificationMethodFromJWK(key.KeyID, jsonWebKey2020, key.DID, j)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create verification method : %w", err)
+		}
+	}
+
+	doc := did.BuildDoc(
+		did.WithVerificationMethod([]did.VerificationMethod{*vm}),
+		did.WithAuthentication([]did.Verification{*did.NewReferencedVerification(vm, did.Authentication)}),
+		did.WithAssertion([]did.Verification{*did.NewReferencedVerification(vm, did.AssertionMethod)}),
+	)
+	doc.ID = key.DID
+
+	docBytes, err := doc.JSONBytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal did:web document : %w", err)
+	}
+
+	// documents of session keys expire with the session, the default issuer key is kept across restarts.
+	if issuerPath == defaultIssuerPath {
+		err = v.store.Put(getWebDIDDocKeyPrefix(issuerPath), docBytes)
+	} else {
+		err = putWithLifetime(v.store, getWebDIDDocKeyPrefix(issuerPath), docBytes, sessionLifetime)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to save did:web document : %w", err)
+	}
+
+	return key, nil
+}
+
+// sessionIssuerKey creates issuer key of an issuance session chosen by issuerKeyType and issuerDIDMethod form values,
+// sessions choosing neither sign with the default issuer key. did:web DIDs of sessions are published under the
+// session ID on the issuer URL, or the external URL of the adapter.
+func (v *adapterApp) sessionIssuerKey(r *http.Request, sessionID string) (*issuerKey, error) {
+	keyType, didMethod := r.FormValue("issuerKeyType"), r.FormValue("issuerDIDMethod")
+	if keyType == "" && didMethod == "" {
+		return v.issuerKey, nil
+	}
+
+	if didMethod == "" {
+		didMethod = didMethodKey
+	}
+
+	baseURL := r.FormValue("issuerURL")
+	if baseURL == "" {
+		baseURL = os.Getenv(demoExternalURLEnvKey)
+	}
+
+	return v.createIssuerKey(keyType, didMethod, baseURL, sessionID)
+}
+
+// issuerSigner returns signer of given issuer key making proofs of given format, nil key gives the built-in did:key
+// identity.
+func (v *adapterApp) issuerSigner(key *issuerKey, proof *proofFormat) (*issuerSigner, error) {
+	if key == nil || key.KMSKeyID == "" {
+		return &issuerSigner{
+			key:    defaultIssuerKey(),
+			signer: &edd25519Signer{ed25519.PrivateKey(base58.Decode(pkBase58))},
+			proof:  proof,
+		}, nil
+	}
+
+	keyHandle, err := v.kms.Get(key.KMSKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get issuer key : %w", err)
+	}
+
+	return &issuerSigner{key: key, proof: proof, signer: &kmsSigner{
+		keyHandle: keyHandle,
+		crypto:    v.crypto,
+		multiMsg:  key.KeyType == kms.BLS12381G2Type,
+		alg:       jwsAlgorithmName(key.KeyType),
+	}}, nil
+}
+
+// setIssuer makes the signer DID issuer of the credential, replacing the issuer of the template.
+func (s *issuerSigner) setIssuer(vc *verifiable.Credential) {
+	vc.Issuer = verifiable.Issuer{ID: s.key.DID}
+}
+
+// addSuiteContext adds JSON-LD context of the signer suite if it is not part of the document contexts.
+func (s *issuerSigner) addSuiteContext(contexts []string) []string {
+	suiteContext, ok := suiteContexts[s.proof.signatureType(s.key.KeyType)]
+	if !ok {
+		return contexts
+	}
+
+	for _, context := range contexts {
+		if context == suiteContext {
+			return contexts
+		}
+	}
+
+	return append(contexts, suiteContext)
+}
+
+func (s *issuerSigner) proofContext(purpose string) *verifiable.LinkedDataProofContext {
+	signatureType := s.proof.signatureType(s.key.KeyType)
+	created := time.Now()
+
+	representation := verifiable.SignatureProofValue
+	if s.proof != nil && s.proof.DetachedJWS {
+		representation = verifiable.SignatureJWS
+	}
+
+	return &verifiable.LinkedDataProofContext{
+		SignatureType:           signatureType,
+		SignatureRepresentation: representation,
+		Suite:                   newSignatureSuite(signatureType, s.signer),
+		VerificationMethod:      s.key.KeyID,
+		Purpose:                 purpose,
+		Created:                 &created,
+	}
+}
+
+func signCredential(vc *verifiable.Credential, signer *issuerSigner, documentLoader ld.DocumentLoader) error {
+	vc.Context = signer.addSuiteContext(vc.Context)
+
+	return vc.AddLinkedDataProof(signer.proofContext("assertionMethod"), jsonld.WithDocumentLoader(documentLoader))
+}
+
+// signCredentialJWT signs credential as a compact JWS, BBS+ keys can not sign JWTs.
+func signCredentialJWT(vc *verifiable.Credential, signer *issuerSigner) (string, error) {
+	if jwsAlgorithmName(signer.key.KeyType) == "" {
+		return "", fmt.Errorf("%s keys can not sign JWT credentials", signer.key.KeyType)
+	}
+
+	alg, err := verifiable.KeyTypeToJWSAlgo(signer.key.KeyType)
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := vc.JWTClaims(false)
+	if err != nil {
+		return "", err
+	}
+
+	return claims.MarshalJWS(alg, signer.signer, signer.key.KeyID)
+}
+
+func signPresentation(vp *verifiable.Presentation, signer *issuerSigner, documentLoader ld.DocumentLoader) error {
+	vp.Context = signer.addSuiteContext(vp.Context)
+
+	return vp.AddLinkedDataProof(signer.proofContext("authentication"), jsonld.WithDocumentLoader(documentLoader))
+}
+
+// webDIDDocument serves documents of did:web DIDs of issuers.
+func (v *adapterApp) webDIDDocument(w http.ResponseWriter, r *http.Request) {
+	docBytes, err := v.store.Get(getWebDIDDocKeyPrefix(mux.Vars(r)["id"]))
+	if err != nil {
+		handleError(w, http.StatusNotFound, fmt.Sprintf("failed to read DID document : %s", err))
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/did+json")
+	w.Write(docBytes)
+}
+
+// webDID returns did:web DID resolving to did.json at given path of the base URL.
+func webDID(baseURL, path string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid base URL for did:web %q", baseURL)
+	}
+
+	segments := []string{"did:web", strings.ReplaceAll(u.Host, ":", "%3A")}
+
+	for _, segment := range strings.Split(strings.Trim(u.Path+"/"+path, "/"), "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	return strings.Join(segments, ":"), nil
+}
+
+// jwsAlgorithmName returns name of JWS algorithm keys of given type sign JWT credentials with, empty for keys that
+// can not sign JWTs.
+func jwsAlgorithmName(keyType kms.KeyType) string {
+	switch keyType { //nolint:exhaustive // other key types do not sign JWTs
+	case kms.ECDSAP256TypeIEEEP1363, kms.ECDSAP256TypeDER:
+		return "ES256"
+	case kms.ECDSAP384TypeIEEEP1363, kms.ECDSAP384TypeDER:
+		return "ES384"
+	case kms.ECDSAP521TypeIEEEP1363, kms.ECDSAP521TypeDER:
+		return "ES512"
+	case kms.ED25519Type:
+		return "EdDSA"
+	default:
+		return ""
+	}
+}
+
+func textToLines(txt string) [][]byte {
+	lines := strings.Split(txt, "\n")
+	linesBytes := make([][]byte, 0, len(lines))
+
+	for i := range lines {
+		if strings.TrimSpace(lines[i]) != "" {
+			linesBytes = append(linesBytes, []byte(lines[i]))
+		}
+	}
+
+	return linesBytes
+}
+
+func buildJWK(pkBytes []byte, keyType kms.KeyType) (*jwk.JWK, error) {
+	if keyType == kms.ED25519Type {
+		j, err := jwksupport.JWKFromKey(ed25519.PublicKey(pkBytes))
+		if err != nil {
+			return nil, fmt.Errorf("converting ed25519 key to JWK: %w", err)
+		}
+
+		return j, nil
+	}
+
+	j, err := jwkkid.BuildJWK(pkBytes, keyType)
+	if err != nil {
+		return nil, fmt.Errorf("creating JWK: %w", err)
+	}
+
+	return j, nil
+}
+
+// orbIssuerKey returns signing identity of the orb DID, its assertion key is the authentication key of the agent.
+func orbIssuerKey(doc *did.Doc, keyType kms.KeyType) (*issuerKey, error) {
+	if len(doc.AssertionMethod) == 0 {
+		return nil, fmt.Errorf("orb DID has no assertion method")
+	}
+
+	vm := doc.AssertionMethod[0].VerificationMethod
+	fragment := vm.ID[strings.Index(vm.ID, "#")+1:]
+
+	// ed25519 verification methods are identified by KMS key IDs, other keys carry them in JWK.
+	kmsKeyID := fragment
+	if j := vm.JSONWebKey(); keyType != kms.ED25519Type && j != nil {
+		kmsKeyID = j.KeyID
+	}
+
+	return &issuerKey{DID: doc.ID, KeyID: doc.ID + "#" + fragment, KeyType: keyType, KMSKeyID: kmsKeyID}, nil
+}
+
+func getWebDIDDocKeyPrefix(key string) string {
+	return fmt.Sprintf("web_did_doc_%s", key)
+}
@@ -0,0 +1,184 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/did"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/key"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssueCredential_IssuerKeys(t *testing.T) {
+	app, _, _ := newTestIssuer(t, &issuerSettings{})
+	keyFetcher := verifiable.NewVDRKeyResolver(vdr.New(vdr.WithVDR(key.New()))).PublicKeyFetcher()
+
+	for _, keyType := range []string{"ed25519", "ecdsap256ieee1363", "ecdsap384ieee1363", "bls12381g2"} {
+		t.Run(keyType, func(t *testing.T) {
+			issuerKey, err := app.createIssuerKey(keyType, didMethodKey, "", "issuer-1")
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(issuerKey.DID, "did:key:"))
+			require.Equal(t, issuerKeyTypes[keyType], issuerKey.KeyType)
+
+			for _, format := range []string{ldpVCFormat, jwtVCJSONFormat} {
+				credBytes, err := app.issueCredential("issuer-1", "VerifiableCredential", format, didKey, "",
+					&issuerSettings{Key: issuerKey})
+				if !canSignFormat(format, issuerKey.KeyType) {
+					require.Error(t, err)
+
+					continue
+				}
+
+				require.NoError(t, err)
+
+				if format != ldpVCFormat {
+					var jws string
+					require.NoError(t, json.Unmarshal(credBytes, &jws))
+
+					credBytes = []byte(jws)
+				}
+
+				vc, err := verifiable.ParseCredential(credBytes,
+					verifiable.WithJSONLDDocumentLoader(app.documentLoader),
+					verifiable.WithPublicKeyFetcher(keyFetcher))
+				require.NoError(t, err, format)
+				require.Equal(t, issuerKey.DID, vc.Issuer.ID)
+
+				if format == ldpVCFormat {
+					require.Equal(t, linkedDataSignatureType(issuerKey.KeyType), vc.Proofs[0]["type"])
+					require.Equal(t, issuerKey.KeyID, vc.Proofs[0]["verificationMethod"])
+				}
+			}
+		})
+	}
+
+	t.Run("built-in did:key", func(t *testing.T) {
+		credBytes, err := app.issueCredential("issuer-1", "VerifiableCredential", ldpVCFormat, didKey, "",
+			&issuerSettings{})
+		require.NoError(t, err)
+
+		vc, err := verifiable.ParseCredential(credBytes, verifiable.WithJSONLDDocumentLoader(app.documentLoader),
+			verifiable.WithPublicKeyFetcher(keyFetcher))
+		require.NoError(t, err)
+		require.Equal(t, kid, vc.Proofs[0]["verificationMethod"])
+		require.Equal(t, didKey, vc.Issuer.ID)
+	})
+
+	t.Run("template of another issuer", func(t *testing.T) {
+		require.NoError(t, app.store.Put(getCredStoreKeyPrefix("issuer-1", "VerifiableCredential"),
+			[]byte(strings.Replace(testCredential, didKey, "did:example:b34ca6cd37bbf23", 1))))
+
+		kmsKey, err := app.createIssuerKey("ed25519", didMethodKey, "", "issuer-1")
+		require.NoError(t, err)
+
+		for signerDID, signerKey := range map[string]*issuerKey{didKey: nil, kmsKey.DID: kmsKey} {
+			credBytes, err := app.issueCredential("issuer-1", "VerifiableCredential", ldpVCFormat, didKey, "",
+				&issuerSettings{Key: signerKey})
+			require.NoError(t, err)
+
+			vc, err := verifiable.ParseCredential(credBytes, verifiable.WithJSONLDDocumentLoader(app.documentLoader),
+				verifiable.WithPublicKeyFetcher(keyFetcher))
+			require.NoError(t, err)
+			require.Equal(t, signerDID, vc.Issuer.ID)
+		}
+	})
+}
+
+func TestCreateIssuerKey(t *testing.T) {
+	app := newTestAdapterApp(t)
+
+	t.Run("did:web", func(t *testing.T) {
+		issuerKey, err := app.createIssuerKey("ecdsap256ieee1363", didMethodWeb, "https://localhost:8094",
+			"issuer-1")
+		require.NoError(t, err)
+		require.Equal(t, "did:web:localhost%3A8094:issuer-1", issuerKey.DID)
+		require.Equal(t, issuerKey.DID+"#key-1", issuerKey.KeyID)
+
+		rr := httptest.NewRecorder()
+		app.webDIDDocument(rr, mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/issuer-1/did.json", nil),
+			map[string]string{"id": "issuer-1"}))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		doc, err := did.ParseDocument(rr.Body.Bytes())
+		require.NoError(t, err)
+		require.Equal(t, issuerKey.DID, doc.ID)
+		require.Len(t, doc.AssertionMethod, 1)
+		require.Equal(t, issuerKey.KeyID, doc.AssertionMethod[0].VerificationMethod.ID)
+
+		tags, err := app.store.GetTags(getWebDIDDocKeyPrefix("issuer-1"))
+		require.NoError(t, err)
+		require.False(t, isExpired(tags, time.Now()))
+		require.True(t, isExpired(tags, time.Now().Add(sessionLifetime)))
+	})
+
+	t.Run("did:web of the default issuer key", func(t *testing.T) {
+		_, err := app.createIssuerKey("ed25519", didMethodWeb, "https://localhost:8094", defaultIssuerPath)
+		require.NoError(t, err)
+
+		tags, err := app.store.GetTags(getWebDIDDocKeyPrefix(defaultIssuerPath))
+		require.NoError(t, err)
+		require.Empty(t, tags)
+	})
+
+	t.Run("unknown did:web document", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		app.webDIDDocument(rr, mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/unknown/did.json", nil),
+			map[string]string{"id": "unknown"}))
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("orb DID", func(t *testing.T) {
+		_, err := app.createIssuerKey("", didMethodOrb, "", "issuer-1")
+		require.Error(t, err)
+
+		app.orbIssuerKey = &issuerKey{DID: "did:orb:123", KeyID: "did:orb:123#key-1", KeyType: kms.ED25519Type}
+
+		issuerKey, err := app.createIssuerKey("", didMethodOrb, "", "issuer-1")
+		require.NoError(t, err)
+		require.Equal(t, app.orbIssuerKey, issuerKey)
+	})
+
+	t.Run("no DID method", func(t *testing.T) {
+		issuerKey, err := app.createIssuerKey("", "", "", "issuer-1")
+		require.NoError(t, err)
+		require.Nil(t, issuerKey)
+	})
+
+	t.Run("unsupported options", func(t *testing.T) {
+		_, err := app.createIssuerKey("rsa", didMethodKey, "", "issuer-1")
+		require.Error(t, err)
+
+		_, err = app.createIssuerKey("", "ion", "", "issuer-1")
+		require.Error(t, err)
+
+		_, err = app.createIssuerKey("", didMethodWeb, "not a url", "issuer-1")
+		require.Error(t, err)
+	})
+}
+
+func TestJWSAlgorithmName(t *testing.T) {
+	for keyType, alg := range map[kms.KeyType]string{
+		kms.ECDSAP256TypeIEEEP1363: "ES256",
+		kms.ECDSAP384TypeDER:       "ES384",
+		kms.ECDSAP521TypeIEEEP1363: "ES512",
+		kms.ECDSAP521TypeDER:       "ES512",
+		kms.ED25519Type:            "EdDSA",
+		kms.BLS12381G2Type:         "",
+	} {
+		require.Equal(t, alg, jwsAlgorithmName(keyType), keyType)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Login of the user registered when no users file is set, prefilled by the login page.
+const (
+	sampleUsername = "sampleuser"
+	samplePassword = "samplepwd"
+)
+
+// issuerUser is a user account of the mock issuer login.
+type issuerUser struct {
+	Username string `yaml:"username" json:"username"`
+	Password string `yaml:"password" json:"password"`
+	// Claims are attributes of the user set in the credential subject of credentials issued to the user, if the
+	// credential template declares them.
+	Claims map[string]interface{} `yaml:"claims,omitempty" json:"claims,omitempty"`
+}
+
+// authenticate checks the password of the user.
+func (u *issuerUser) authenticate(password string) bool {
+	return subtle.ConstantTimeCompare([]byte(u.Password), []byte(password)) == 1
+}
+
+// loadIssuerUsers reads user directory from given YAML or JSON file. Without a file only the sample user, who has no
+// claims, is registered.
+func loadIssuerUsers(path string) (map[string]*issuerUser, error) {
+	if path == "" {
+		return map[string]*issuerUser{
+			sampleUsername: {Username: sampleUsername, Password: samplePassword},
+		}, nil
+	}
+
+	usersBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file : %w", err)
+	}
+
+	var users []*issuerUser
+
+	// JSON documents are YAML too.
+	err = yaml.Unmarshal(usersBytes, &users)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse users : %w", err)
+	}
+
+	directory := make(map[string]*issuerUser)
+
+	for _, user := range users {
+		if user.Username == "" || user.Password == "" {
+			return nil, fmt.Errorf("user %q : username and password are required", user.Username)
+		}
+
+		if _, ok := directory[user.Username]; ok {
+			return nil, fmt.Errorf("user %s : duplicate username", user.Username)
+		}
+
+		directory[user.Username] = user
+	}
+
+	return directory, nil
+}
+
+// userClaims returns claims of the user of given username, or nil for unknown users and issuance without login.
+func (v *adapterApp) userClaims(username string) map[string]interface{} {
+	user, ok := v.users[username]
+	if !ok {
+		return nil
+	}
+
+	return user.Claims
+}
@@ -0,0 +1,179 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadIssuerUsers(t *testing.T) {
+	writeUsers := func(t *testing.T, name, users string) string {
+		t.Helper()
+
+		path := filepath.Join(t.TempDir(), name)
+		require.NoError(t, os.WriteFile(path, []byte(users), 0o600))
+
+		return path
+	}
+
+	t.Run("sample user without a file", func(t *testing.T) {
+		users, err := loadIssuerUsers("")
+		require.NoError(t, err)
+		require.Len(t, users, 1)
+		require.True(t, users[sampleUsername].authenticate(samplePassword))
+		require.False(t, users[sampleUsername].authenticate("wrong"))
+	})
+
+	t.Run("YAML", func(t *testing.T) {
+		users, err := loadIssuerUsers(writeUsers(t, "users.yaml", `
+- username: alice
+  password: alicepwd
+  claims:
+    givenName: Alice
+    address:
+      locality: Toronto
+- username: bob
+  password: bobpwd
+`))
+		require.NoError(t, err)
+		require.Len(t, users, 2)
+		require.True(t, users["alice"].authenticate("alicepwd"))
+		require.Equal(t, map[string]interface{}{
+			"givenName": "Alice",
+			"address":   map[string]interface{}{"locality": "Toronto"},
+		}, users["alice"].Claims)
+		require.Empty(t, users["bob"].Claims)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		users, err := loadIssuerUsers(writeUsers(t, "users.json",
+			`[{"username": "alice", "password": "alicepwd", "claims": {"givenName": "Alice"}}]`))
+		require.NoError(t, err)
+		require.Equal(t, "Alice", users["alice"].Claims["givenName"])
+	})
+
+	t.Run("demo users", func(t *testing.T) {
+		users, err := loadIssuerUsers("../../fixtures/wallet-web/mock-adapter-config/issuer_users.yaml")
+		require.NoError(t, err)
+		require.True(t, users[sampleUsername].authenticate(samplePassword))
+		require.NotEmpty(t, users["alice"].Claims)
+		require.NotEqual(t, users["alice"].Claims, users["bob"].Claims)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := loadIssuerUsers(filepath.Join(t.TempDir(), "missing.yaml"))
+		require.Contains(t, err.Error(), "failed to read users file")
+
+		_, err = loadIssuerUsers(writeUsers(t, "users.yaml", `{"username": "alice"}`))
+		require.Contains(t, err.Error(), "failed to parse users")
+
+		_, err = loadIssuerUsers(writeUsers(t, "users.yaml", `[{"username": "alice"}]`))
+		require.Contains(t, err.Error(), "username and password are required")
+
+		_, err = loadIssuerUsers(writeUsers(t, "users.yaml",
+			`[{"username": "alice", "password": "a"}, {"username": "alice", "password": "b"}]`))
+		require.Contains(t, err.Error(), "duplicate username")
+	})
+}
+
+func TestIssuerSendAuthorizeResponse_Login(t *testing.T) {
+	t.Run("invalid login", func(t *testing.T) {
+		app := newTestOAuthApp(t)
+
+		for _, login := range [][2]string{{"alice", "wrong"}, {"mallory", "alicepwd"}, {"", ""}} {
+			rr := loginTestUser(app, sendAuthorizeRequest(app, nil), login[0], login[1])
+			require.Equal(t, http.StatusUnauthorized, rr.Code)
+			require.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+			require.Contains(t, rr.Body.String(), "Invalid username or password")
+			require.Empty(t, rr.Header().Get("Location"))
+		}
+	})
+
+	t.Run("token of the logged in user", func(t *testing.T) {
+		app := newTestOAuthApp(t)
+
+		rr := loginTestUser(app, sendAuthorizeRequest(app, nil), "alice", "alicepwd")
+		require.Equal(t, http.StatusFound, rr.Code, rr.Body.String())
+
+		location, err := url.Parse(rr.Header().Get("Location"))
+		require.NoError(t, err)
+
+		rr = postTokenRequest(app, "issuer-1", url.Values{
+			"grant_type":   {authorizationCodeGrantType},
+			"code":         {location.Query().Get("code")},
+			"redirect_uri": {testRedirectURI},
+			"client_id":    {walletClientID},
+		})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var tokenResp map[string]interface{}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tokenResp))
+
+		tokenData, err := readAccessToken(app.store, tokenResp["access_token"].(string))
+		require.NoError(t, err)
+		require.Equal(t, "alice", tokenData.Username)
+	})
+
+	t.Run("login page", func(t *testing.T) {
+		app := newTestOAuthApp(t)
+
+		rr := httptest.NewRecorder()
+		app.oidcIssuerLogin(rr, httptest.NewRequest(http.MethodGet, "/issuer/oidc/login", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Contains(t, rr.Body.String(), `name="username"`)
+		require.NotContains(t, rr.Body.String(), "issuer-login-error")
+	})
+}
+
+func TestIssueCredential_UserClaims(t *testing.T) {
+	app, _, _ := newTestIssuer(t, &issuerSettings{})
+	app.users = map[string]*issuerUser{
+		"alice": {Username: "alice", Password: "alicepwd", Claims: map[string]interface{}{"givenName": "Alice",
+			"degree": map[string]interface{}{"type": "BachelorDegree"}}},
+		"bob": {Username: "bob", Password: "bobpwd", Claims: map[string]interface{}{"givenName": "Bob"}},
+	}
+
+	require.NoError(t, app.store.Put(getCredStoreKeyPrefix("issuer-1", "VerifiableCredential"), []byte(`{
+		"@context": ["https://www.w3.org/2018/credentials/v1", {"givenName": "https://schema.org/givenName"}],
+		"id": "http://example.gov/credentials/3732",
+		"type": ["VerifiableCredential"],
+		"issuer": "did:example:issuer",
+		"issuanceDate": "2020-03-16T22:37:26.544Z",
+		"credentialSubject": {"id": "did:example:holder", "givenName": "John"}
+	}`)))
+
+	givenName := func(t *testing.T, username string) interface{} {
+		t.Helper()
+
+		credBytes, err := app.issueCredential("issuer-1", "VerifiableCredential", ldpVCFormat, didKey, username,
+			&issuerSettings{})
+		require.NoError(t, err)
+
+		vc, err := verifiable.ParseCredential(credBytes, verifiable.WithDisabledProofCheck(),
+			verifiable.WithJSONLDDocumentLoader(app.documentLoader))
+		require.NoError(t, err)
+
+		subject := vc.Subject.([]verifiable.Subject)[0]
+		require.Equal(t, didKey, subject.ID)
+		require.NotContains(t, subject.CustomFields, "degree")
+
+		return subject.CustomFields["givenName"]
+	}
+
+	require.Equal(t, "Alice", givenName(t, "alice"))
+	require.Equal(t, "Bob", givenName(t, "bob"))
+	require.Equal(t, "John", givenName(t, ""))
+}
@@ -27,11 +27,26 @@ const (
 	contextProviderEnvKey     = "CONTEXT_PROVIDER_URL"
 	keyTypeEnvKey             = "KEY_TYPE"
 	keyAgreementTypeEnvKey    = "KEY_AGREEMENT_TYPE"
+	oidcClientsFileEnvKey     = "OIDC_CLIENTS_FILE"
+	issuerUsersFileEnvKey     = "ISSUER_USERS_FILE"
+	issuerKeyTypeEnvKey       = "ISSUER_KEY_TYPE"
+	issuerDIDMethodEnvKey     = "ISSUER_DID_METHOD"
+	adminTokenEnvKey          = "ADMIN_TOKEN"
+	storageTypeEnvKey         = "STORAGE_TYPE"
+	storageURLEnvKey          = "STORAGE_URL"
+	storagePrefixEnvKey       = "STORAGE_PREFIX"
 )
 
 func main() {
+	// agent and adapter share the storage, keeping keys, DIDs and sessions over restarts with persistent storage types
+	storeProvider, err := createStoreProvider(os.Getenv(storageTypeEnvKey), os.Getenv(storageURLEnvKey),
+		os.Getenv(storagePrefixEnvKey))
+	if err != nil {
+		panic(fmt.Errorf("failed to create storage provider : %w", err))
+	}
+
 	// initiate aries framework go options
-	agent, err := startAriesAgent()
+	agent, err := startAriesAgent(storeProvider)
 	if err != nil {
 		panic(fmt.Errorf("failed to start aries-agent : %w", err))
 	}
@@ -43,7 +58,7 @@ func main() {
 	router.Handle("/", fs)
 
 	// host demo sample ui pages
-	err = startAdapterApp(agent, router)
+	err = startAdapterApp(agent, storeProvider, router)
 	if err != nil {
 		panic(fmt.Errorf("failed to get verifier-app : %w", err))
 	}
@@ -0,0 +1,356 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/cm"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/presexch"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
+)
+
+// credentialManifestJSON mirrors cm.CredentialManifest, which is decoded field by field and validated explicitly.
+type credentialManifestJSON struct {
+	ID                     string                           `json:"id"`
+	Issuer                 cm.Issuer                        `json:"issuer"`
+	OutputDescriptors      []*cm.OutputDescriptor           `json:"output_descriptors"`
+	Format                 *presexch.Format                 `json:"format,omitempty"`
+	PresentationDefinition *presexch.PresentationDefinition `json:"presentation_definition,omitempty"`
+}
+
+// credentialApplicationJSON mirrors cm.CredentialApplication, which is decoded field by field and validated
+// explicitly.
+type credentialApplicationJSON struct {
+	ID         string          `json:"id"`
+	ManifestID string          `json:"manifest_id"`
+	Format     presexch.Format `json:"format"`
+}
+
+// parseCredentialManifest parses the credential manifest and validates its issuer, output descriptors, format and
+// presentation definition.
+func parseCredentialManifest(manifestBytes []byte) (*cm.CredentialManifest, error) {
+	var manifestJSON credentialManifestJSON
+
+	err := json.Unmarshal(manifestBytes, &manifestJSON)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential manifest : %w", err)
+	}
+
+	manifest := &cm.CredentialManifest{
+		ID:                     manifestJSON.ID,
+		Issuer:                 manifestJSON.Issuer,
+		OutputDescriptors:      manifestJSON.OutputDescriptors,
+		Format:                 manifestJSON.Format,
+		PresentationDefinition: manifestJSON.PresentationDefinition,
+	}
+
+	err = manifest.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential manifest : %w", err)
+	}
+
+	if manifest.Format != nil && !hasFormatAlgorithmsOrProofTypes(manifest.Format) {
+		return nil, errors.New("invalid credential manifest : format lists no algorithms or proof types")
+	}
+
+	if manifest.PresentationDefinition != nil {
+		err = manifest.PresentationDefinition.ValidateSchema()
+		if err != nil {
+			return nil, fmt.Errorf("invalid credential manifest : invalid presentation definition : %w", err)
+		}
+	}
+
+	return manifest, nil
+}
+
+func hasFormatAlgorithmsOrProofTypes(format *presexch.Format) bool {
+	for _, jwtType := range []*presexch.JwtType{format.Jwt, format.JwtVC, format.JwtVP} {
+		if jwtType != nil && len(jwtType.Alg) > 0 {
+			return true
+		}
+	}
+
+	for _, ldpType := range []*presexch.LdpType{format.Ldp, format.LdpVC, format.LdpVP} {
+		if ldpType != nil && len(ldpType.ProofType) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkManifestProofType checks that the manifest accepts linked data credentials with proofs of given type.
+func checkManifestProofType(manifest *cm.CredentialManifest, proofType string) error {
+	if manifest.Format == nil {
+		return nil
+	}
+
+	for _, ldpType := range []*presexch.LdpType{manifest.Format.Ldp, manifest.Format.LdpVC} {
+		if ldpType == nil {
+			continue
+		}
+
+		for _, t := range ldpType.ProofType {
+			if t == proofType {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("credential manifest format does not accept %s credentials", proofType)
+}
+
+// manifestCredentialResponse returns the credential response of the credential issued for the manifest, mapping it to
+// the output descriptor it matches. Credentials have to match a descriptor and resolve its display.
+func manifestCredentialResponse(manifest *cm.CredentialManifest, vc *verifiable.Credential) (json.RawMessage, error) {
+	descriptor := matchOutputDescriptor(manifest, vc)
+	if descriptor == nil {
+		return nil, fmt.Errorf("credential of types %s matches no output descriptor of the credential manifest",
+			strings.Join(vc.Types, ", "))
+	}
+
+	if descriptor.Display != nil {
+		_, err := resolvableManifest(manifest, descriptor).ResolveCredential(descriptor.ID, cm.CredentialToResolve(vc))
+		if err != nil {
+			return nil, fmt.Errorf("credential does not resolve output descriptor %s : %w", descriptor.ID, err)
+		}
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"credential_response": newCredentialFulfillment(manifest.ID, descriptor.ID, ldpVCFormat,
+			"$.verifiableCredential[0]"),
+	})
+}
+
+// newCredentialFulfillment returns credential fulfillment mapping the credential in given format at given path to
+// the output descriptor of the manifest.
+func newCredentialFulfillment(manifestID, descriptorID, format, path string) *cm.CredentialFulfillment {
+	return &cm.CredentialFulfillment{
+		ID:         uuid.NewString(),
+		ManifestID: manifestID,
+		OutputDescriptorMappingObjects: []cm.OutputDescriptorMap{{
+			ID:     descriptorID,
+			Format: format,
+			Path:   path,
+		}},
+	}
+}
+
+// resolvableManifest returns a manifest with only given output descriptor, whose missing title, subtitle and
+// description are set empty as cm dereferences them when resolving credentials.
+func resolvableManifest(manifest *cm.CredentialManifest, descriptor *cm.OutputDescriptor) *cm.CredentialManifest {
+	display := *descriptor.Display
+
+	for _, object := range []**cm.DisplayMappingObject{&display.Title, &display.Subtitle, &display.Description} {
+		if *object == nil {
+			*object = &cm.DisplayMappingObject{}
+		}
+	}
+
+	resolvable := *descriptor
+	resolvable.Display = &display
+
+	return &cm.CredentialManifest{
+		ID:                manifest.ID,
+		Issuer:            manifest.Issuer,
+		OutputDescriptors: []*cm.OutputDescriptor{&resolvable},
+	}
+}
+
+// matchOutputDescriptor returns the first output descriptor whose schema is a context or type of the credential, or
+// nil if there is none.
+func matchOutputDescriptor(manifest *cm.CredentialManifest, vc *verifiable.Credential) *cm.OutputDescriptor {
+	for _, descriptor := range manifest.OutputDescriptors {
+		for _, ctx := range vc.Context {
+			if descriptor.Schema == ctx {
+				return descriptor
+			}
+		}
+
+		for _, t := range vc.Types {
+			if descriptor.Schema == t || strings.HasSuffix(descriptor.Schema, "#"+t) {
+				return descriptor
+			}
+		}
+	}
+
+	return nil
+}
+
+// applicationOptions are the options of a credential offer the credential application presentation is signed with.
+type applicationOptions struct {
+	Challenge string `json:"challenge"`
+	Domain    string `json:"domain"`
+}
+
+// verifyApplication verifies the credential application presentation of a holder against the credential manifest:
+// presentation and credential proofs, the challenge and domain the holder was given, statuses of the credentials, the
+// embedded credential application and the presentation definition of the manifest.
+func (pv *presentationVerifier) verifyApplication(vpBytes []byte, manifest *cm.CredentialManifest,
+	challenge, domain string) (*verifiable.Presentation, *presentationVerification) {
+	result := &presentationVerification{}
+	req := &presentationRequest{Definition: manifest.PresentationDefinition, Challenge: challenge, Domain: domain}
+
+	vpBytes, jws := readPresentationJWS(vpBytes)
+
+	vp, err := pv.parsePresentation(vpBytes)
+	if !result.add(presentationProofCheck, err) {
+		return nil, result
+	}
+
+	result.add(challengeAndDomainCheck, checkChallengeAndDomain(vp, jws, req.Challenge, req.Domain))
+	result.add(credentialApplicationCheck, checkCredentialApplication(vp, manifest))
+	result.add(credentialProofsCheck, pv.checkCredentialProofs(vp, acceptedProofTypes(req.Definition)))
+	result.add(credentialStatusCheck, pv.checkCredentialStatuses(vp))
+	result.add(presentationDefinitionCheck, pv.matchDefinition(vp, req))
+
+	return vp, result
+}
+
+// checkCredentialApplication checks that the credential application embedded in the presentation applies for the
+// manifest in one of its formats.
+func checkCredentialApplication(vp *verifiable.Presentation, manifest *cm.CredentialManifest) error {
+	raw, ok := vp.CustomFields["credential_application"]
+	if !ok {
+		return errors.New("presentation has no credential_application")
+	}
+
+	applicationBytes, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("failed to marshal credential application : %w", err)
+	}
+
+	var applicationJSON credentialApplicationJSON
+
+	err = json.Unmarshal(applicationBytes, &applicationJSON)
+	if err != nil {
+		return fmt.Errorf("invalid credential application : %w", err)
+	}
+
+	if applicationJSON.ID == "" || applicationJSON.ManifestID == "" {
+		return errors.New("invalid credential application : missing ID or manifest ID")
+	}
+
+	application := &cm.CredentialApplication{
+		ID:         applicationJSON.ID,
+		ManifestID: applicationJSON.ManifestID,
+		Format:     applicationJSON.Format,
+	}
+
+	return application.ValidateAgainstCredentialManifest(manifest)
+}
+
+// findCredentialManifest returns the credential manifest of given ID out of the manifests of an issuer.
+func findCredentialManifest(manifests json.RawMessage, id string) (*cm.CredentialManifest, error) {
+	var manifestsJSON []json.RawMessage
+
+	if len(manifests) > 0 {
+		err := json.Unmarshal(manifests, &manifestsJSON)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read credential manifests : %w", err)
+		}
+	}
+
+	for _, manifestJSON := range manifestsJSON {
+		var header struct {
+			ID string `json:"id"`
+		}
+
+		if json.Unmarshal(manifestJSON, &header) != nil || header.ID != id {
+			continue
+		}
+
+		return parseCredentialManifest(manifestJSON)
+	}
+
+	return nil, fmt.Errorf("unknown credential manifest %s", id)
+}
+
+// applicationHolder is the holder proving possession of the key of a credential request, its credential application
+// must be signed by the same DID over the c_nonce of the proof.
+type applicationHolder struct {
+	DID    string
+	CNonce string
+}
+
+// applicationOutput is the output descriptor of a credential manifest a credential application is fulfilled with.
+type applicationOutput struct {
+	ManifestID     string `json:"manifest_id"`
+	DescriptorID   string `json:"descriptor_id"`
+	CredentialType string `json:"credential_type"`
+}
+
+// readCredentialApplication verifies the credential application sent to the credential endpoint of an issuer against
+// the manifest it applies for and returns the output descriptor of the credential of given type issued for it, or of
+// the first credential the issuer has if the type is not set. Applications for manifests with a presentation
+// definition are verified as presentations signed over the c_nonce by the holder proving possession of the key,
+// others only need to apply for the manifest in one of its formats.
+func (v *adapterApp) readCredentialApplication(applicationBytes []byte, credentialType string,
+	issuerConf *issuerConfiguration, holder *applicationHolder) (*applicationOutput, error) {
+	var envelope struct {
+		Application credentialApplicationJSON `json:"credential_application"`
+	}
+
+	err := json.Unmarshal(applicationBytes, &envelope)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential application : %w", err)
+	}
+
+	if envelope.Application.ManifestID == "" {
+		return nil, errors.New("invalid credential application : missing manifest ID")
+	}
+
+	manifest, err := findCredentialManifest(issuerConf.CredentialManifests, envelope.Application.ManifestID)
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest.PresentationDefinition != nil {
+		vp, verification := v.presVerifier.verifyApplication(applicationBytes, manifest, holder.CNonce, "")
+		if !verification.Verified() {
+			return nil, fmt.Errorf("credential application verification failed : %s", verification.Error())
+		}
+
+		if holderDID := presentationHolderDID(vp); holderDID != holder.DID {
+			return nil, fmt.Errorf("credential application is held by %q, not by %s proving possession of the key",
+				holderDID, holder.DID)
+		}
+	} else {
+		vp, e := verifiable.ParsePresentation(applicationBytes, verifiable.WithPresDisabledProofCheck(),
+			verifiable.WithPresJSONLDDocumentLoader(v.documentLoader))
+		if e != nil {
+			return nil, fmt.Errorf("invalid credential application : %w", e)
+		}
+
+		err = checkCredentialApplication(vp, manifest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, descriptor := range manifest.OutputDescriptors {
+		if _, ok := issuerConf.CredentialsSupported[descriptor.Schema]; !ok {
+			continue
+		}
+
+		if credentialType == "" || descriptor.Schema == credentialType {
+			return &applicationOutput{
+				ManifestID:     manifest.ID,
+				DescriptorID:   descriptor.ID,
+				CredentialType: descriptor.Schema,
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("credential manifest %s has no output descriptor of a credential issued by the issuer",
+		manifest.ID)
+}
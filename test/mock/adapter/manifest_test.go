@@ -0,0 +1,486 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/issuecredential"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/cm"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/jsonld"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/key"
+	"github.com/piprate/json-gold/ld"
+	"github.com/stretchr/testify/require"
+)
+
+const testCredentialManifest = `{
+	"id": "manifest-1",
+	"issuer": {"id": "did:example:issuer", "name": "Example Issuer"},
+	"output_descriptors": [{
+		"id": "vc_output",
+		"schema": "https://www.w3.org/2018/credentials#VerifiableCredential",
+		"display": {
+			"title": {"path": ["$.name"], "fallback": "Verifiable Credential", "schema": {"type": "string"}},
+			"properties": [{
+				"path": ["$.credentialSubject.id"], "schema": {"type": "string"}, "label": "Holder"
+			}]
+		}
+	}]
+}`
+
+func TestParseCredentialManifest(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		manifest, err := parseCredentialManifest([]byte(testCredentialManifest))
+		require.NoError(t, err)
+		require.Equal(t, "manifest-1", manifest.ID)
+		require.Len(t, manifest.OutputDescriptors, 1)
+		require.NoError(t, checkManifestProofType(manifest, ed25519Signature2018))
+	})
+
+	t.Run("format", func(t *testing.T) {
+		manifest, err := parseCredentialManifest(withManifestField(t, "format",
+			`{"ldp_vc": {"proof_type": ["JsonWebSignature2020"]}}`))
+		require.NoError(t, err)
+		require.NoError(t, checkManifestProofType(manifest, jsonWebSignature2020))
+		require.ErrorContains(t, checkManifestProofType(manifest, ed25519Signature2018),
+			"does not accept Ed25519Signature2018 credentials")
+
+		_, err = parseCredentialManifest(withManifestField(t, "format", `{"ldp_vc": {}}`))
+		require.ErrorContains(t, err, "format lists no algorithms or proof types")
+	})
+
+	t.Run("invalid manifests", func(t *testing.T) {
+		for name, manifest := range map[string][]byte{
+			"not JSON":                 []byte(`{`),
+			"missing ID":               withManifestField(t, "id", `""`),
+			"missing issuer":           withManifestField(t, "issuer", `{}`),
+			"no output descriptors":    withManifestField(t, "output_descriptors", `[]`),
+			"presentation definition":  withManifestField(t, "presentation_definition", `{"id": "pd"}`),
+			"output descriptor schema": withManifestField(t, "output_descriptors", `[{"id": "vc_output"}]`),
+		} {
+			_, err := parseCredentialManifest(manifest)
+			require.ErrorContains(t, err, "invalid credential manifest", name)
+		}
+	})
+}
+
+func TestManifestCredentialResponse(t *testing.T) {
+	manifest, err := parseCredentialManifest([]byte(testCredentialManifest))
+	require.NoError(t, err)
+
+	vc, err := verifiable.ParseCredential([]byte(testCredential), verifiable.WithDisabledProofCheck(),
+		verifiable.WithJSONLDDocumentLoader(testDocumentLoader(t)))
+	require.NoError(t, err)
+
+	t.Run("descriptor mapping", func(t *testing.T) {
+		responseBytes, err := manifestCredentialResponse(manifest, vc)
+		require.NoError(t, err)
+
+		var response struct {
+			CredentialResponse struct {
+				ManifestID    string `json:"manifest_id"`
+				DescriptorMap []struct {
+					ID     string `json:"id"`
+					Format string `json:"format"`
+					Path   string `json:"path"`
+				} `json:"descriptor_map"`
+			} `json:"credential_response"`
+		}
+
+		require.NoError(t, json.Unmarshal(responseBytes, &response))
+		require.Equal(t, "manifest-1", response.CredentialResponse.ManifestID)
+		require.Len(t, response.CredentialResponse.DescriptorMap, 1)
+		require.Equal(t, "vc_output", response.CredentialResponse.DescriptorMap[0].ID)
+		require.Equal(t, ldpVCFormat, response.CredentialResponse.DescriptorMap[0].Format)
+		require.Equal(t, "$.verifiableCredential[0]", response.CredentialResponse.DescriptorMap[0].Path)
+	})
+
+	t.Run("no matching output descriptor", func(t *testing.T) {
+		other, err := parseCredentialManifest(withManifestField(t, "output_descriptors",
+			`[{"id": "prc_output", "schema": "https://w3id.org/citizenship/v1"}]`))
+		require.NoError(t, err)
+
+		_, err = manifestCredentialResponse(other, vc)
+		require.ErrorContains(t, err, "matches no output descriptor")
+	})
+}
+
+func TestPrepareWACIIssuance(t *testing.T) {
+	app := newTestAdapterApp(t)
+	app.documentLoader = testDocumentLoader(t)
+
+	t.Run("success", func(t *testing.T) {
+		manifest, response, err := app.prepareWACIIssuance(newFormRequest(url.Values{
+			"credManifest": {testCredentialManifest},
+			"credToIssue":  {testCredential},
+		}))
+		require.NoError(t, err)
+		require.Equal(t, "manifest-1", manifest.ID)
+		require.Contains(t, string(response), "vc_output")
+	})
+
+	t.Run("invalid credential", func(t *testing.T) {
+		_, _, err := app.prepareWACIIssuance(newFormRequest(url.Values{
+			"credManifest": {testCredentialManifest},
+			"credToIssue":  {`{}`},
+		}))
+		require.ErrorContains(t, err, "invalid credential to issue")
+	})
+}
+
+func TestWACIIssuance_Form(t *testing.T) {
+	app := newTestAdapterApp(t)
+	app.documentLoader = testDocumentLoader(t)
+
+	manifest := string(withManifestField(t, "output_descriptors",
+		`[{"id": "prc_output", "schema": "https://w3id.org/citizenship/v1"}]`))
+
+	rr := httptest.NewRecorder()
+	app.waciIssuance(rr, newFormRequest(url.Values{
+		"walletURL":     {"https://wallet.example.com"},
+		"credManifest":  {manifest},
+		"credToIssue":   {testCredential},
+		"issuerKeyType": {"ecdsap256ieee1363"},
+	}))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+
+	body := rr.Body.String()
+	require.Contains(t, body, "ERROR: credential to issue does not fit the credential manifest")
+	require.Contains(t, body, "prc_output")
+	require.Contains(t, body, "http://example.gov/credentials/3732")
+	require.Contains(t, body, "ecdsap256ieee1363")
+}
+
+func TestPresentationVerifier_VerifyApplication(t *testing.T) {
+	loader := testDocumentLoader(t)
+	pv := newPresentationVerifier(vdr.New(vdr.WithVDR(key.New())), loader)
+
+	manifest, err := parseCredentialManifest(withManifestField(t, "presentation_definition", testApplicationDefinition))
+	require.NoError(t, err)
+
+	t.Run("success", func(t *testing.T) {
+		vp, result := pv.verifyApplication(createTestApplication(t, loader, manifest, true, "challenge-1", "domain-1"),
+			manifest, "challenge-1", "domain-1")
+		require.True(t, result.Verified(), result.Error())
+		require.Len(t, result.Checks, 6)
+		require.Equal(t, didKey, presentationHolderDID(vp))
+	})
+
+	t.Run("application without challenge", func(t *testing.T) {
+		_, result := pv.verifyApplication(createTestApplication(t, loader, manifest, true, "", ""), manifest,
+			"challenge-1", "")
+		require.False(t, result.Verified())
+		require.Contains(t, result.Error(), challengeAndDomainCheck)
+	})
+
+	t.Run("application replayed from another offer", func(t *testing.T) {
+		_, result := pv.verifyApplication(createTestApplication(t, loader, manifest, true, "challenge-1", "domain-1"),
+			manifest, "challenge-2", "domain-2")
+		require.False(t, result.Verified())
+		require.Contains(t, result.Error(), challengeAndDomainCheck)
+	})
+
+	t.Run("application for other manifest", func(t *testing.T) {
+		other := *manifest
+		other.ID = "manifest-2"
+
+		_, result := pv.verifyApplication(createTestApplication(t, loader, &other, true, "challenge-1", "domain-1"),
+			manifest, "challenge-1", "domain-1")
+		require.False(t, result.Verified())
+		require.Contains(t, result.Error(), credentialApplicationCheck)
+	})
+
+	t.Run("presentation definition not satisfied", func(t *testing.T) {
+		other, err := parseCredentialManifest(withManifestField(t, "presentation_definition", `{
+			"id": "pd-2",
+			"input_descriptors": [{"id": "prc", "schema": [{"uri": "https://w3id.org/citizenship#PermanentResidentCard"}]}]
+		}`))
+		require.NoError(t, err)
+
+		_, result := pv.verifyApplication(createTestApplication(t, loader, manifest, true, "challenge-1", "domain-1"),
+			other, "challenge-1", "domain-1")
+		require.False(t, result.Verified())
+		require.Contains(t, result.Error(), presentationDefinitionCheck)
+	})
+
+	t.Run("unsigned credential", func(t *testing.T) {
+		_, result := pv.verifyApplication(createTestApplication(t, loader, manifest, false, "challenge-1", "domain-1"),
+			manifest, "challenge-1", "domain-1")
+		require.False(t, result.Verified())
+		require.Contains(t, result.Error(), credentialProofsCheck)
+	})
+}
+
+func TestHandleRequestCredential_Application(t *testing.T) {
+	loader := testDocumentLoader(t)
+
+	manifestBytes := withManifestField(t, "presentation_definition", testApplicationDefinition)
+
+	manifest, err := parseCredentialManifest(manifestBytes)
+	require.NoError(t, err)
+
+	newApp := func(t *testing.T) *adapterApp {
+		t.Helper()
+
+		app := newTestAdapterApp(t)
+		app.presVerifier = newPresentationVerifier(vdr.New(vdr.WithVDR(key.New())), loader)
+
+		require.NoError(t, saveWACIIssuanceData(app.store, "thread-1", &waciIssuanceData{
+			CredentialManifest: manifestBytes,
+			SessionID:          "session-1",
+			Challenge:          "challenge-1",
+			Domain:             "domain-1",
+		}))
+
+		saveTestSession(t, app, "session-1", "thread-1")
+
+		return app
+	}
+
+	t.Run("missing credential application", func(t *testing.T) {
+		stops := runTestAction(t, newApp(t), service.DIDCommMsgMap{
+			"@id":     "request-1",
+			"@type":   issuecredential.RequestCredentialMsgTypeV2,
+			"~thread": map[string]interface{}{"thid": "thread-1"},
+		})
+
+		require.Len(t, stops, 1)
+		require.Equal(t, problemCodeInvalidMessage, stops[0].Code)
+		require.Contains(t, stops[0].Description, "failed to get credential application")
+	})
+
+	requestMsg := func(t *testing.T, applicationBytes []byte) service.DIDCommMsgMap {
+		t.Helper()
+
+		var application map[string]interface{}
+		require.NoError(t, json.Unmarshal(applicationBytes, &application))
+
+		return service.DIDCommMsgMap{
+			"@id":     "request-1",
+			"@type":   issuecredential.RequestCredentialMsgTypeV2,
+			"~thread": map[string]interface{}{"thid": "thread-1"},
+			"formats": []interface{}{map[string]interface{}{
+				"attach_id": "application", "format": cm.CredentialApplicationAttachmentFormat,
+			}},
+			"requests~attach": []interface{}{
+				map[string]interface{}{"@id": "other", "data": map[string]interface{}{"json": map[string]interface{}{}}},
+				map[string]interface{}{"@id": "application", "data": map[string]interface{}{"json": application}},
+			},
+		}
+	}
+
+	t.Run("credential application not satisfying the manifest", func(t *testing.T) {
+		app := newApp(t)
+		events := app.events.subscribe(&eventFilter{SessionID: "session-1"})
+
+		stops := runTestAction(t, app,
+			requestMsg(t, createTestApplication(t, loader, manifest, false, "challenge-1", "domain-1")))
+
+		require.Len(t, stops, 1)
+		require.Equal(t, problemCodeVerificationFailed, stops[0].Code)
+		require.Contains(t, stops[0].Description, credentialProofsCheck)
+
+		require.Equal(t, eventRequestReceived, (<-events).Type)
+
+		event := <-events
+		require.Equal(t, eventVerificationResult, event.Type)
+		require.NotEmpty(t, event.Error)
+
+		require.Equal(t, sessionStatusFailed, getTestSession(t, app, "session-1").Status)
+	})
+
+	t.Run("credential application of another offer", func(t *testing.T) {
+		stops := runTestAction(t, newApp(t),
+			requestMsg(t, createTestApplication(t, loader, manifest, true, "challenge-2", "domain-2")))
+
+		require.Len(t, stops, 1)
+		require.Equal(t, problemCodeVerificationFailed, stops[0].Code)
+		require.Contains(t, stops[0].Description, challengeAndDomainCheck)
+	})
+}
+
+func TestIssuerCredentialEndpoint_Application(t *testing.T) {
+	app, accessToken, nonce := newTestIssuer(t, &issuerSettings{})
+
+	manifests := `[{
+		"id": "manifest-1",
+		"issuer": {"id": "did:example:issuer"},
+		"output_descriptors": [{"id": "vc_output", "schema": "VerifiableCredential"}]
+	}, {
+		"id": "manifest-2",
+		"issuer": {"id": "did:example:issuer"},
+		"output_descriptors": [{"id": "vc_output", "schema": "VerifiableCredential"}],
+		"presentation_definition": ` + testApplicationDefinition + `
+	}]`
+
+	issuerConf, err := json.Marshal(&issuerConfiguration{
+		Issuer:               "https://issuer.example.com/issuer-1",
+		CredentialManifests:  []byte(manifests),
+		CredentialsSupported: map[string]*supportedCredential{"VerifiableCredential": {}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, app.store.Put("issuer-1", issuerConf))
+
+	application := func(t *testing.T, id string) json.RawMessage {
+		t.Helper()
+
+		manifest, err := findCredentialManifest([]byte(manifests), id)
+		require.NoError(t, err)
+
+		vp, err := cm.PresentCredentialApplication(manifest)
+		require.NoError(t, err)
+
+		vpBytes, err := vp.MarshalJSON()
+		require.NoError(t, err)
+
+		return vpBytes
+	}
+
+	signedApplication := func(t *testing.T, challenge string) json.RawMessage {
+		t.Helper()
+
+		manifest, err := findCredentialManifest([]byte(manifests), "manifest-2")
+		require.NoError(t, err)
+
+		return createTestApplication(t, app.documentLoader, manifest, true, challenge, "")
+	}
+
+	proof := createTestProof(t, "https://issuer.example.com/issuer-1", nonce)
+
+	rr := postBatchCredentialRequest(t, app, "issuer-1", accessToken, []*credentialRequest{
+		{Format: ldpVCFormat, Proof: proof, CredentialApplication: application(t, "manifest-1")},
+		{Proof: proof, CredentialApplication: application(t, "manifest-2")},
+		{Proof: proof, CredentialApplication: []byte(`{"credential_application": {"id": "1", "manifest_id": "other"}}`)},
+		{Proof: proof, Type: "OtherCredential", CredentialApplication: application(t, "manifest-1")},
+		{Format: ldpVCFormat, Proof: proof, CredentialApplication: signedApplication(t, nonce)},
+		{Proof: proof, CredentialApplication: signedApplication(t, "nonce-of-another-request")},
+	})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// fulfillments are decoded field by field, cm.CredentialFulfillment can not be unmarshalled.
+	var resp struct {
+		CredentialResponses []struct {
+			Credential            json.RawMessage `json:"credential"`
+			Error                 string          `json:"error"`
+			ErrorDescription      string          `json:"error_description"`
+			CredentialFulfillment *struct {
+				ManifestID    string                   `json:"manifest_id"`
+				DescriptorMap []cm.OutputDescriptorMap `json:"descriptor_map"`
+			} `json:"credential_fulfillment"`
+		} `json:"credential_responses"`
+	}
+
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	require.Len(t, resp.CredentialResponses, 6)
+
+	issued := resp.CredentialResponses[0]
+	require.Empty(t, issued.Error, issued.ErrorDescription)
+	require.Contains(t, string(issued.Credential), didKey)
+	require.NotNil(t, issued.CredentialFulfillment)
+	require.Equal(t, "manifest-1", issued.CredentialFulfillment.ManifestID)
+	require.Equal(t, []cm.OutputDescriptorMap{{ID: "vc_output", Format: ldpVCFormat, Path: "$.credential"}},
+		issued.CredentialFulfillment.DescriptorMap)
+
+	applied := resp.CredentialResponses[4]
+	require.Empty(t, applied.Error, applied.ErrorDescription)
+	require.Equal(t, "manifest-2", applied.CredentialFulfillment.ManifestID)
+
+	for i, expected := range map[int]string{
+		1: "credential application verification failed",
+		2: "unknown credential manifest other",
+		3: "has no output descriptor of a credential issued by the issuer",
+		5: challengeAndDomainCheck,
+	} {
+		require.Equal(t, errInvalidRequest, resp.CredentialResponses[i].Error)
+		require.Contains(t, resp.CredentialResponses[i].ErrorDescription, expected)
+	}
+}
+
+func TestReadCredentialApplication_Holder(t *testing.T) {
+	app, _, nonce := newTestIssuer(t, &issuerSettings{})
+
+	manifestBytes := withManifestField(t, "presentation_definition", testApplicationDefinition)
+
+	manifest, err := parseCredentialManifest(manifestBytes)
+	require.NoError(t, err)
+
+	issuerConf := &issuerConfiguration{
+		CredentialManifests:  []byte("[" + string(manifestBytes) + "]"),
+		CredentialsSupported: map[string]*supportedCredential{manifest.OutputDescriptors[0].Schema: {}},
+	}
+	application := createTestApplication(t, app.documentLoader, manifest, true, nonce, "")
+
+	t.Run("holder proving possession", func(t *testing.T) {
+		output, err := app.readCredentialApplication(application, "", issuerConf,
+			&applicationHolder{DID: didKey, CNonce: nonce})
+		require.NoError(t, err)
+		require.Equal(t, manifest.ID, output.ManifestID)
+	})
+
+	t.Run("application of another holder", func(t *testing.T) {
+		_, err := app.readCredentialApplication(application, "", issuerConf,
+			&applicationHolder{DID: "did:example:other", CNonce: nonce})
+		require.ErrorContains(t, err, "not by did:example:other proving possession")
+	})
+}
+
+const testApplicationDefinition = `{
+	"id": "pd-1",
+	"input_descriptors": [{"id": "vc", "schema": [{"uri": "https://www.w3.org/2018/credentials#VerifiableCredential"}]}]
+}`
+
+// createTestApplication returns a credential application for the manifest presenting the test credential, signed
+// with given challenge and domain.
+func createTestApplication(t *testing.T, loader ld.DocumentLoader, manifest *cm.CredentialManifest,
+	signCredential bool, challenge, domain string) []byte {
+	t.Helper()
+
+	vc, err := verifiable.ParseCredential([]byte(testCredential), verifiable.WithJSONLDDocumentLoader(loader))
+	require.NoError(t, err)
+
+	if signCredential {
+		require.NoError(t, vc.AddLinkedDataProof(testProofContext("assertionMethod", "", ""),
+			jsonld.WithDocumentLoader(loader)))
+	}
+
+	vp, err := verifiable.NewPresentation(verifiable.WithCredentials(vc))
+	require.NoError(t, err)
+
+	vp, err = cm.PresentCredentialApplication(manifest, cm.WithExistingPresentationForPresentCredentialApplication(vp))
+	require.NoError(t, err)
+
+	require.NoError(t, vp.AddLinkedDataProof(testProofContext("authentication", challenge, domain),
+		jsonld.WithDocumentLoader(loader)))
+
+	vpBytes, err := vp.MarshalJSON()
+	require.NoError(t, err)
+
+	return vpBytes
+}
+
+// withManifestField returns the test credential manifest with given field replaced.
+func withManifestField(t *testing.T, name, value string) []byte {
+	t.Helper()
+
+	var manifest map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal([]byte(testCredentialManifest), &manifest))
+
+	manifest[name] = json.RawMessage(value)
+
+	manifestBytes, err := json.Marshal(manifest)
+	require.NoError(t, err)
+
+	return manifestBytes
+}
@@ -0,0 +1,372 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// Client authentication methods at the token endpoint,
+// https://openid.net/specs/openid-connect-core-1_0.html#ClientAuthentication.
+const (
+	clientAuthNone          = "none"
+	clientAuthSecretBasic   = "client_secret_basic"
+	clientAuthSecretPost    = "client_secret_post"
+	clientAuthPrivateKeyJWT = "private_key_jwt"
+
+	clientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+// PKCE code challenge methods, https://datatracker.ietf.org/doc/html/rfc7636#section-4.2.
+const (
+	pkceMethodS256  = "S256"
+	pkceMethodPlain = "plain"
+)
+
+const (
+	// authCodeLifetime is how long an authorization code can be redeemed at the token endpoint.
+	authCodeLifetime = 5 * time.Minute
+
+	// authRequestLifetime is how long the user has to log in after the authorization request.
+	authRequestLifetime = 5 * time.Minute
+
+	// authStateLifetime is how long state of an authorization request is kept, it is read again when the
+	// authorization code is redeemed.
+	authStateLifetime = authRequestLifetime + authCodeLifetime
+
+	// walletClientID is ID of the public client the wallet uses.
+	walletClientID = "m1CppYUvt7"
+)
+
+// oauthClient is a client registered with the mock issuer.
+type oauthClient struct {
+	ID                      string   `json:"client_id"`
+	Secret                  string   `json:"client_secret,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"`
+	RedirectURIs            []string `json:"redirect_uris,omitempty"`
+	// DID is the DID of keys assertions of private_key_jwt clients are signed with.
+	DID string `json:"did,omitempty"`
+}
+
+// allowsRedirectURI checks whether redirect URI is registered for the client, clients registered without redirect
+// URIs accept any.
+func (c *oauthClient) allowsRedirectURI(redirectURI string) bool {
+	if len(c.RedirectURIs) == 0 {
+		return true
+	}
+
+	for _, uri := range c.RedirectURIs {
+		if uri == redirectURI {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadOAuthClients reads client registry from given JSON file. Without a file only the public wallet client is
+// registered.
+func loadOAuthClients(path string) (map[string]*oauthClient, error) {
+	if path == "" {
+		return map[string]*oauthClient{
+			walletClientID: {ID: walletClientID, TokenEndpointAuthMethod: clientAuthNone},
+		}, nil
+	}
+
+	clientsBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read clients file : %w", err)
+	}
+
+	var clients []*oauthClient
+
+	err = json.Unmarshal(clientsBytes, &clients)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse clients : %w", err)
+	}
+
+	registry := make(map[string]*oauthClient)
+
+	for _, client := range clients {
+		if client.TokenEndpointAuthMethod == "" {
+			client.TokenEndpointAuthMethod = clientAuthSecretBasic
+		}
+
+		switch client.TokenEndpointAuthMethod {
+		case clientAuthNone, clientAuthSecretBasic, clientAuthSecretPost:
+		case clientAuthPrivateKeyJWT:
+			if client.DID == "" {
+				return nil, fmt.Errorf("client %s : did is required for %s", client.ID, clientAuthPrivateKeyJWT)
+			}
+		default:
+			return nil, fmt.Errorf("client %s : unsupported token endpoint auth method %s", client.ID,
+				client.TokenEndpointAuthMethod)
+		}
+
+		registry[client.ID] = client
+	}
+
+	return registry, nil
+}
+
+// clientAssertionClaims are claims of a private_key_jwt client assertion,
+// https://datatracker.ietf.org/doc/html/rfc7523#section-3.
+type clientAssertionClaims struct {
+	Issuer   string      `json:"iss"`
+	Subject  string      `json:"sub"`
+	Audience interface{} `json:"aud"`
+	Expiry   int64       `json:"exp"`
+	JTI      string      `json:"jti"`
+
+	signerDID string
+}
+
+// authenticateClient authenticates client sending request to the token endpoint. Requests without client
+// authentication or client_id are from the public client of given ID. Assertions of private_key_jwt clients must be
+// intended for one of given audiences.
+func (v *adapterApp) authenticateClient(r *http.Request, publicClientID string,
+	audiences ...string) (*oauthClient, *oauthError) {
+	var (
+		clientID, secret, method string
+		assertion                *clientAssertionClaims
+	)
+
+	if id, s, ok := r.BasicAuth(); ok {
+		method = clientAuthSecretBasic
+		// credentials are form-urlencoded before being put in the header, RFC 6749 section 2.3.1.
+		clientID, secret = unescapeBasicAuth(id), unescapeBasicAuth(s)
+	} else if assertionType := r.FormValue("client_assertion_type"); assertionType != "" {
+		if assertionType != clientAssertionTypeJWTBearer {
+			return nil, newOAuthError(errInvalidClient, "unsupported client_assertion_type", http.StatusUnauthorized)
+		}
+
+		method = clientAuthPrivateKeyJWT
+
+		var err error
+
+		assertion, err = v.checkClientAssertion(r.FormValue("client_assertion"), audiences)
+		if err != nil {
+			return nil, newOAuthError(errInvalidClient, err.Error(), http.StatusUnauthorized)
+		}
+
+		clientID = assertion.Issuer
+	} else if s := r.FormValue("client_secret"); s != "" {
+		method = clientAuthSecretPost
+		clientID, secret = r.FormValue("client_id"), s
+	} else {
+		method = clientAuthNone
+		clientID = r.FormValue("client_id")
+
+		if clientID == "" {
+			clientID = publicClientID
+		}
+	}
+
+	client, ok := v.clients[clientID]
+	if !ok {
+		return nil, newOAuthError(errInvalidClient, "unknown client", http.StatusUnauthorized)
+	}
+
+	if client.TokenEndpointAuthMethod != method {
+		return nil, newOAuthError(errInvalidClient,
+			fmt.Sprintf("client must authenticate with %s", client.TokenEndpointAuthMethod), http.StatusUnauthorized)
+	}
+
+	switch method {
+	case clientAuthSecretBasic, clientAuthSecretPost:
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(client.Secret)) != 1 {
+			return nil, newOAuthError(errInvalidClient, "invalid client secret", http.StatusUnauthorized)
+		}
+	case clientAuthPrivateKeyJWT:
+		if assertion.signerDID != client.DID {
+			return nil, newOAuthError(errInvalidClient, "client assertion is not signed with client key",
+				http.StatusUnauthorized)
+		}
+	}
+
+	return client, nil
+}
+
+func unescapeBasicAuth(value string) string {
+	unescaped, err := url.QueryUnescape(value)
+	if err != nil {
+		return value
+	}
+
+	return unescaped
+}
+
+// checkClientAssertion verifies private_key_jwt client assertion. Assertions can be used only once.
+func (v *adapterApp) checkClientAssertion(assertion string, audiences []string) (*clientAssertionClaims, error) {
+	if assertion == "" {
+		return nil, errors.New("client_assertion is required")
+	}
+
+	jwt, err := v.presVerifier.verifyJWT(assertion)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &clientAssertionClaims{}
+
+	err = jwt.DecodeClaims(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode client assertion : %w", err)
+	}
+
+	if claims.Issuer == "" || claims.Issuer != claims.Subject {
+		return nil, errors.New("client assertion iss and sub must be the client ID")
+	}
+
+	if time.Now().After(time.Unix(claims.Expiry, 0)) {
+		return nil, errors.New("client assertion expired")
+	}
+
+	var audienceOK bool
+
+	for _, audience := range audiences {
+		audienceOK = audienceOK || audienceContains(claims.Audience, audience)
+	}
+
+	if !audienceOK {
+		return nil, errors.New("client assertion is not intended for this server")
+	}
+
+	if claims.JTI == "" {
+		return nil, errors.New("client assertion jti is required")
+	}
+
+	_, err = v.store.Get(getClientAssertionKeyPrefix(claims.JTI))
+	if err == nil {
+		return nil, errors.New("client assertion was already used")
+	}
+
+	// used assertions are remembered until they expire.
+	err = putWithLifetime(v.store, getClientAssertionKeyPrefix(claims.JTI), []byte(claims.Issuer),
+		time.Until(time.Unix(claims.Expiry, 0)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save client assertion : %w", err)
+	}
+
+	kid, _ := jwt.Headers.KeyID()
+	claims.signerDID = strings.SplitN(kid, "#", 2)[0]
+
+	return claims, nil
+}
+
+// authCodeData is state of an authorization code.
+type authCodeData struct {
+	AuthState string    `json:"auth_state"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func saveAuthCode(store storage.Store, code, authState string) error {
+	dataBytes, err := json.Marshal(&authCodeData{AuthState: authState, ExpiresAt: time.Now().Add(authCodeLifetime)})
+	if err != nil {
+		return err
+	}
+
+	return putWithLifetime(store, getAuthCodeKeyPrefix(code), dataBytes, authCodeLifetime)
+}
+
+// redeemAuthCode returns authorization state of the code. Codes can be redeemed only once.
+func redeemAuthCode(store storage.Store, code string) (string, *oauthError) {
+	if code == "" {
+		return "", newOAuthError(errInvalidRequest, "code is required", http.StatusBadRequest)
+	}
+
+	dataBytes, err := store.Get(getAuthCodeKeyPrefix(code))
+	if errors.Is(err, errRecordExpired) {
+		return "", newOAuthError(errInvalidGrant, "authorization code expired", http.StatusBadRequest)
+	} else if err != nil {
+		return "", newOAuthError(errInvalidGrant, "invalid authorization code", http.StatusBadRequest)
+	}
+
+	err = store.Delete(getAuthCodeKeyPrefix(code))
+	if err != nil {
+		return "", newOAuthError(errServerError, "failed to redeem authorization code", http.StatusInternalServerError)
+	}
+
+	var data authCodeData
+
+	err = json.Unmarshal(dataBytes, &data)
+	if err != nil {
+		return "", newOAuthError(errServerError, "failed to read authorization code", http.StatusInternalServerError)
+	}
+
+	if time.Now().After(data.ExpiresAt) {
+		return "", newOAuthError(errInvalidGrant, "authorization code expired", http.StatusBadRequest)
+	}
+
+	return data.AuthState, nil
+}
+
+func isSupportedPKCEMethod(method string) bool {
+	return method == pkceMethodS256 || method == pkceMethodPlain
+}
+
+// verifyPKCE checks code verifier sent to the token endpoint against code challenge of the authorization request.
+func verifyPKCE(challenge, method, verifier string) *oauthError {
+	if challenge == "" {
+		return nil
+	}
+
+	if verifier == "" {
+		return newOAuthError(errInvalidRequest, "code_verifier is required", http.StatusBadRequest)
+	}
+
+	expected := verifier
+
+	if method == pkceMethodS256 {
+		hash := sha256.Sum256([]byte(verifier))
+		expected = base64.RawURLEncoding.EncodeToString(hash[:])
+	}
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) != 1 {
+		return newOAuthError(errInvalidGrant, "code_verifier does not match code_challenge", http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+// redirectOAuthError sends authorization error response to the redirect URI of the client.
+func redirectOAuthError(w http.ResponseWriter, r *http.Request, redirectURI, state string, e *oauthError) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		handleError(w, http.StatusBadRequest, e.Error())
+
+		return
+	}
+
+	q := u.Query()
+	q.Set("error", e.Code)
+	q.Set("error_description", e.Description)
+
+	if state != "" {
+		q.Set("state", state)
+	}
+
+	u.RawQuery = q.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func getClientAssertionKeyPrefix(key string) string {
+	return fmt.Sprintf("client_assertion_%s", key)
+}
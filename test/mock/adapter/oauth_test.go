@@ -0,0 +1,414 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	afjwt "github.com/hyperledger/aries-framework-go/pkg/doc/jwt"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/key"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRedirectURI   = "https://wallet.example.com/oidc/save"
+	testTokenEndpoint = "https://issuer.example.com/issuer-1/issuer/oidc/token"
+)
+
+func TestIssuerAuthorize(t *testing.T) {
+	app := newTestOAuthApp(t)
+
+	t.Run("unknown client", func(t *testing.T) {
+		rr := sendAuthorizeRequest(app, url.Values{"client_id": {"unknown"}})
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), errInvalidClient)
+	})
+
+	t.Run("redirect URI not registered", func(t *testing.T) {
+		rr := sendAuthorizeRequest(app, url.Values{"client_id": {"basic"}, "redirect_uri": {"https://evil.example.com"}})
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Empty(t, rr.Header().Get("Location"))
+	})
+
+	t.Run("unsupported code challenge method", func(t *testing.T) {
+		rr := sendAuthorizeRequest(app, url.Values{"code_challenge": {"challenge"}, "code_challenge_method": {"S512"}})
+		require.Equal(t, http.StatusFound, rr.Code)
+
+		location, err := url.Parse(rr.Header().Get("Location"))
+		require.NoError(t, err)
+		require.Equal(t, errInvalidRequest, location.Query().Get("error"))
+		require.Equal(t, "state", location.Query().Get("state"))
+	})
+
+	t.Run("unsupported response type", func(t *testing.T) {
+		rr := sendAuthorizeRequest(app, url.Values{"response_type": {"token"}})
+		require.Equal(t, http.StatusFound, rr.Code)
+		require.Contains(t, rr.Header().Get("Location"), errUnsupportedResponse)
+	})
+
+	t.Run("authorize URL of the wallet", func(t *testing.T) {
+		// encodeURI of the URL template in cmd/wallet-web/src/mixins/oidc/oidc.js.
+		query := strings.NewReplacer("%", "%25", "\n", "%0A", " ", "%20").Replace(
+			"claims=" + url.QueryEscape(`[{"type":"VerifiableCredential","format":"ldp_vc"}]`) +
+				"&response_type=code\n  &client_id=" + walletClientID + "&scope=openid&state=state&redirect_uri=" +
+				url.QueryEscape(testRedirectURI))
+
+		r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/issuer-1/issuer/oidc/authorize?"+query, nil),
+			map[string]string{"id": "issuer-1"})
+
+		rr := httptest.NewRecorder()
+		app.issuerAuthorize(rr, r)
+		require.Equal(t, http.StatusFound, rr.Code, rr.Body.String())
+		require.Equal(t, "/issuer/oidc/login", rr.Header().Get("Location"))
+	})
+
+	t.Run("credential type not issued", func(t *testing.T) {
+		rr := sendAuthorizeRequest(app, url.Values{"claims": {`[{"type":"UnknownCredential","format":"ldp_vc"}]`}})
+		require.Equal(t, http.StatusFound, rr.Code)
+
+		location, err := url.Parse(rr.Header().Get("Location"))
+		require.NoError(t, err)
+		require.Equal(t, errInvalidRequest, location.Query().Get("error"))
+		require.Contains(t, location.Query().Get("error_description"), "UnknownCredential is not issued")
+	})
+}
+
+func TestIssuerTokenEndpoint_AuthorizationCode(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	hash := sha256.Sum256([]byte(verifier))
+	s256Challenge := base64.RawURLEncoding.EncodeToString(hash[:])
+
+	tests := []struct {
+		name      string
+		authorize url.Values
+		token     url.Values
+		basicAuth []string
+		assertion map[string]interface{}
+		status    int
+		errCode   string
+	}{
+		{
+			name:   "public client",
+			status: http.StatusOK,
+		},
+		{
+			name:      "PKCE S256",
+			authorize: url.Values{"code_challenge": {s256Challenge}, "code_challenge_method": {pkceMethodS256}},
+			token:     url.Values{"code_verifier": {verifier}},
+			status:    http.StatusOK,
+		},
+		{
+			name:      "PKCE plain",
+			authorize: url.Values{"code_challenge": {verifier}},
+			token:     url.Values{"code_verifier": {verifier}},
+			status:    http.StatusOK,
+		},
+		{
+			name:      "PKCE wrong verifier",
+			authorize: url.Values{"code_challenge": {s256Challenge}, "code_challenge_method": {pkceMethodS256}},
+			token:     url.Values{"code_verifier": {"wrong"}},
+			status:    http.StatusBadRequest,
+			errCode:   errInvalidGrant,
+		},
+		{
+			name:      "PKCE missing verifier",
+			authorize: url.Values{"code_challenge": {s256Challenge}, "code_challenge_method": {pkceMethodS256}},
+			status:    http.StatusBadRequest,
+			errCode:   errInvalidRequest,
+		},
+		{
+			name:      "client_secret_basic",
+			authorize: url.Values{"client_id": {"basic"}},
+			basicAuth: []string{"basic", "secret"},
+			status:    http.StatusOK,
+		},
+		{
+			name:      "client_secret_basic wrong secret",
+			authorize: url.Values{"client_id": {"basic"}},
+			basicAuth: []string{"basic", "wrong"},
+			status:    http.StatusUnauthorized,
+			errCode:   errInvalidClient,
+		},
+		{
+			name:      "client_secret_basic sent in body",
+			authorize: url.Values{"client_id": {"basic"}},
+			token:     url.Values{"client_id": {"basic"}, "client_secret": {"secret"}},
+			status:    http.StatusUnauthorized,
+			errCode:   errInvalidClient,
+		},
+		{
+			name:      "client_secret_post",
+			authorize: url.Values{"client_id": {"post"}},
+			token:     url.Values{"client_id": {"post"}, "client_secret": {"secret"}},
+			status:    http.StatusOK,
+		},
+		{
+			name:      "private_key_jwt",
+			authorize: url.Values{"client_id": {"jwt"}},
+			assertion: map[string]interface{}{"iss": "jwt", "sub": "jwt", "aud": testTokenEndpoint},
+			status:    http.StatusOK,
+		},
+		{
+			name:      "private_key_jwt wrong audience",
+			authorize: url.Values{"client_id": {"jwt"}},
+			assertion: map[string]interface{}{"iss": "jwt", "sub": "jwt", "aud": "https://other.example.com"},
+			status:    http.StatusUnauthorized,
+			errCode:   errInvalidClient,
+		},
+		{
+			name:      "code issued to another client",
+			authorize: url.Values{"client_id": {"basic"}},
+			token:     url.Values{"client_id": {"post"}, "client_secret": {"secret"}},
+			status:    http.StatusBadRequest,
+			errCode:   errInvalidGrant,
+		},
+	}
+
+	for _, test := range tests {
+		tc := test
+		t.Run(tc.name, func(t *testing.T) {
+			app := newTestOAuthApp(t)
+
+			code := authorizeTestRequest(t, app, tc.authorize)
+
+			form := url.Values{
+				"grant_type":   {authorizationCodeGrantType},
+				"code":         {code},
+				"redirect_uri": {testRedirectURI},
+				"client_id":    {walletClientID},
+			}
+
+			for k, v := range tc.token {
+				form[k] = v
+			}
+
+			if tc.basicAuth != nil || tc.assertion != nil {
+				form.Del("client_id")
+			}
+
+			if tc.assertion != nil {
+				tc.assertion["exp"] = time.Now().Add(time.Minute).Unix()
+				tc.assertion["jti"] = tc.name
+
+				token, err := afjwt.NewSigned(tc.assertion, nil, &testJWTSigner{kid: kid})
+				require.NoError(t, err)
+
+				jws, err := token.Serialize(false)
+				require.NoError(t, err)
+
+				form.Set("client_assertion_type", clientAssertionTypeJWTBearer)
+				form.Set("client_assertion", jws)
+			}
+
+			r := newTokenRequest("issuer-1", form)
+			if tc.basicAuth != nil {
+				r.SetBasicAuth(tc.basicAuth[0], tc.basicAuth[1])
+			}
+
+			rr := httptest.NewRecorder()
+			app.issuerTokenEndpoint(rr, r)
+			require.Equal(t, tc.status, rr.Code, rr.Body.String())
+
+			var resp map[string]interface{}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+			if tc.errCode != "" {
+				require.Equal(t, tc.errCode, resp["error"])
+				return
+			}
+
+			require.NotEmpty(t, resp["access_token"])
+
+			// codes are one-time.
+			r = newTokenRequest("issuer-1", form)
+			if tc.basicAuth != nil {
+				r.SetBasicAuth(tc.basicAuth[0], tc.basicAuth[1])
+			}
+
+			rr = httptest.NewRecorder()
+			app.issuerTokenEndpoint(rr, r)
+			require.NotEqual(t, http.StatusOK, rr.Code)
+		})
+	}
+}
+
+func TestIssuerTokenEndpoint_WalletTokenRequest(t *testing.T) {
+	// the wallet posts FormData with redirect_uri, code and grant_type only, see requestToken of the OIDC mixin.
+	postWalletTokenRequest := func(t *testing.T, app *adapterApp, code string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		var body bytes.Buffer
+
+		form := multipart.NewWriter(&body)
+		require.NoError(t, form.WriteField("redirect_uri", testRedirectURI))
+		require.NoError(t, form.WriteField("code", code))
+		require.NoError(t, form.WriteField("grant_type", authorizationCodeGrantType))
+		require.NoError(t, form.Close())
+
+		r := httptest.NewRequest(http.MethodPost, "/issuer-1/issuer/oidc/token", &body)
+		r.Header.Set("Content-Type", form.FormDataContentType())
+
+		rr := httptest.NewRecorder()
+		app.issuerTokenEndpoint(rr, mux.SetURLVars(r, map[string]string{"id": "issuer-1"}))
+
+		return rr
+	}
+
+	t.Run("public client", func(t *testing.T) {
+		app := newTestOAuthApp(t)
+
+		rr := postWalletTokenRequest(t, app, authorizeTestRequest(t, app, nil))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Contains(t, rr.Body.String(), "access_token")
+	})
+
+	t.Run("confidential client has to authenticate", func(t *testing.T) {
+		app := newTestOAuthApp(t)
+
+		rr := postWalletTokenRequest(t, app, authorizeTestRequest(t, app, url.Values{"client_id": {"basic"}}))
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+		require.Contains(t, rr.Body.String(), errInvalidClient)
+	})
+}
+
+func TestRedeemAuthCode(t *testing.T) {
+	app := newTestAdapterApp(t)
+
+	dataBytes, err := json.Marshal(&authCodeData{AuthState: "state", ExpiresAt: time.Now().Add(-time.Second)})
+	require.NoError(t, err)
+	require.NoError(t, app.store.Put(getAuthCodeKeyPrefix("expired"), dataBytes))
+
+	_, oauthErr := redeemAuthCode(app.store, "expired")
+	require.NotNil(t, oauthErr)
+	require.Equal(t, errInvalidGrant, oauthErr.Code)
+	require.Contains(t, oauthErr.Description, "expired")
+
+	_, oauthErr = redeemAuthCode(app.store, "")
+	require.NotNil(t, oauthErr)
+	require.Equal(t, errInvalidRequest, oauthErr.Code)
+}
+
+func TestLoadOAuthClients(t *testing.T) {
+	clients, err := loadOAuthClients("")
+	require.NoError(t, err)
+	require.Equal(t, clientAuthNone, clients[walletClientID].TokenEndpointAuthMethod)
+
+	path := filepath.Join(t.TempDir(), "clients.json")
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"client_id": "basic", "client_secret": "secret"}]`), 0o600))
+	clients, err = loadOAuthClients(path)
+	require.NoError(t, err)
+	require.Equal(t, clientAuthSecretBasic, clients["basic"].TokenEndpointAuthMethod)
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"client_id": "jwt", "token_endpoint_auth_method": "private_key_jwt"}]`),
+		0o600))
+	_, err = loadOAuthClients(path)
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"client_id": "tls", "token_endpoint_auth_method": "tls_client_auth"}]`),
+		0o600))
+	_, err = loadOAuthClients(path)
+	require.Error(t, err)
+}
+
+func newTestOAuthApp(t *testing.T) *adapterApp {
+	t.Helper()
+
+	app := newTestAdapterApp(t)
+	app.presVerifier = newPresentationVerifier(vdr.New(vdr.WithVDR(key.New())), testDocumentLoader(t))
+	app.users = map[string]*issuerUser{
+		sampleUsername: {Username: sampleUsername, Password: samplePassword},
+		"alice": {Username: "alice", Password: "alicepwd",
+			Claims: map[string]interface{}{"givenName": "Alice", "familyName": "Smith"}},
+	}
+	app.clients = map[string]*oauthClient{
+		walletClientID: {ID: walletClientID, TokenEndpointAuthMethod: clientAuthNone},
+		"basic": {ID: "basic", Secret: "secret", TokenEndpointAuthMethod: clientAuthSecretBasic,
+			RedirectURIs: []string{testRedirectURI}},
+		"post": {ID: "post", Secret: "secret", TokenEndpointAuthMethod: clientAuthSecretPost},
+		"jwt":  {ID: "jwt", DID: didKey, TokenEndpointAuthMethod: clientAuthPrivateKeyJWT},
+	}
+
+	issuerConf, err := json.Marshal(&issuerConfiguration{
+		Issuer:               "https://issuer.example.com/issuer-1",
+		TokenEndpoint:        testTokenEndpoint,
+		CredentialsSupported: map[string]*supportedCredential{"VerifiableCredential": {}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, app.store.Put("issuer-1", issuerConf))
+
+	return app
+}
+
+func sendAuthorizeRequest(app *adapterApp, params url.Values) *httptest.ResponseRecorder {
+	query := url.Values{
+		"claims":        {`[{"type":"VerifiableCredential","format":"ldp_vc"}]`},
+		"response_type": {"code"},
+		"client_id":     {walletClientID},
+		"scope":         {"openid"},
+		"state":         {"state"},
+		"redirect_uri":  {testRedirectURI},
+	}
+
+	for k, v := range params {
+		query[k] = v
+	}
+
+	r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/issuer-1/issuer/oidc/authorize?"+query.Encode(), nil),
+		map[string]string{"id": "issuer-1"})
+
+	rr := httptest.NewRecorder()
+	app.issuerAuthorize(rr, r)
+
+	return rr
+}
+
+// authorizeTestRequest sends authorization request with given parameters, consents to it and returns the code.
+func authorizeTestRequest(t *testing.T, app *adapterApp, params url.Values) string {
+	t.Helper()
+
+	rr := sendAuthorizeRequest(app, params)
+	require.Equal(t, http.StatusFound, rr.Code, rr.Body.String())
+	require.Equal(t, "/issuer/oidc/login", rr.Header().Get("Location"))
+
+	rr = loginTestUser(app, rr, sampleUsername, samplePassword)
+	require.Equal(t, http.StatusFound, rr.Code, rr.Body.String())
+
+	location, err := url.Parse(rr.Header().Get("Location"))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(location.String(), testRedirectURI))
+
+	return location.Query().Get("code")
+}
+
+// loginTestUser logs in to the authorization request whose state cookie is set in the authorize response.
+func loginTestUser(app *adapterApp, authorizeResponse *httptest.ResponseRecorder,
+	username, password string) *httptest.ResponseRecorder {
+	r := newFormRequest(url.Values{"username": {username}, "password": {password}})
+	for _, cookie := range authorizeResponse.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+
+	rr := httptest.NewRecorder()
+	app.issuerSendAuthorizeResponse(rr, r)
+
+	return rr
+}
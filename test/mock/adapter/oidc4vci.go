@@ -0,0 +1,759 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/cm"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// OIDC4VCI grant types.
+const (
+	authorizationCodeGrantType = "authorization_code"
+	preAuthorizedCodeGrantType = "urn:ietf:params:oauth:grant-type:pre-authorized_code"
+)
+
+// Credential formats supported by the mock issuer.
+const (
+	ldpVCFormat       = "ldp_vc"
+	jwtVCJSONFormat   = "jwt_vc_json"
+	jwtVCJSONLDFormat = "jwt_vc_json-ld"
+)
+
+// OAuth2 error codes, https://datatracker.ietf.org/doc/html/rfc6749#section-5.2.
+const (
+	errInvalidRequest        = "invalid_request"
+	errInvalidGrant          = "invalid_grant"
+	errUnsupportedGrantType  = "unsupported_grant_type"
+	errServerError           = "server_error"
+	errInvalidToken          = "invalid_token"
+	errInvalidClient         = "invalid_client"
+	errUnsupportedResponse   = "unsupported_response_type"
+	errInvalidOrMissingProof = "invalid_or_missing_proof"
+	errIssuancePending       = "issuance_pending"
+
+	errUnsupportedCredentialFormat = "unsupported_credential_format"
+	errUnsupportedCredentialType   = "unsupported_credential_type"
+)
+
+const (
+	// cNonceLifetime is how long a c_nonce can be used to prove possession of holder key.
+	cNonceLifetime = 5 * time.Minute
+
+	// accessTokenLifetime is how long an access token can be used at the credential endpoints.
+	accessTokenLifetime = time.Hour
+
+	// preAuthorizedCodeLifetime is how long a pre-authorized code of a credential offer can be redeemed.
+	preAuthorizedCodeLifetime = 30 * time.Minute
+
+	jwtProofType = "jwt"
+
+	// deferredPollInterval is the interval in seconds wallet is asked to wait before polling for deferred credential.
+	deferredPollInterval = 5
+)
+
+// oauthError is an OAuth2 error response.
+type oauthError struct {
+	Code            string `json:"error"`
+	Description     string `json:"error_description,omitempty"`
+	CNonce          string `json:"c_nonce,omitempty"`
+	CNonceExpiresIn int    `json:"c_nonce_expires_in,omitempty"`
+	status          int
+}
+
+func (e *oauthError) Error() string {
+	return fmt.Sprintf("%s : %s", e.Code, e.Description)
+}
+
+func newOAuthError(code, description string, status int) *oauthError {
+	return &oauthError{Code: code, Description: description, status: status}
+}
+
+func sendOAuthErrorResponse(w http.ResponseWriter, e *oauthError) {
+	w.WriteHeader(e.status)
+
+	err := json.NewEncoder(w).Encode(e)
+	if err != nil {
+		logger.Errorf("Unable to send error response, %s", err)
+	}
+}
+
+// preAuthorizedCodeData is state of a pre-authorized code issued in a credential offer.
+type preAuthorizedCodeData struct {
+	IssuerID string `json:"issuer_id"`
+	UserPIN  string `json:"user_pin,omitempty"`
+	// CredentialTypes are the credential types of the offer the code authorizes.
+	CredentialTypes []string `json:"credential_types,omitempty"`
+}
+
+func savePreAuthorizedCode(store storage.Store, code string, data *preAuthorizedCodeData) error {
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return putWithLifetime(store, getPreAuthorizedCodeKeyPrefix(code), dataBytes, preAuthorizedCodeLifetime)
+}
+
+// redeemPreAuthorizedCode validates pre-authorized code and user PIN sent to the token endpoint of given issuer and
+// returns the credential types it authorizes. Codes can be redeemed only once.
+func redeemPreAuthorizedCode(store storage.Store, issuerID, code, userPIN string) ([]string, *oauthError) {
+	if code == "" {
+		return nil, newOAuthError(errInvalidRequest, "pre-authorized_code is required", http.StatusBadRequest)
+	}
+
+	dataBytes, err := store.Get(getPreAuthorizedCodeKeyPrefix(code))
+	if errors.Is(err, errRecordExpired) {
+		return nil, newOAuthError(errInvalidGrant, "pre-authorized code expired", http.StatusBadRequest)
+	} else if err != nil {
+		return nil, newOAuthError(errInvalidGrant, "unknown pre-authorized code", http.StatusBadRequest)
+	}
+
+	var data preAuthorizedCodeData
+
+	err = json.Unmarshal(dataBytes, &data)
+	if err != nil {
+		return nil, newOAuthError(errServerError, "failed to read pre-authorized code", http.StatusInternalServerError)
+	}
+
+	if data.IssuerID != issuerID {
+		return nil, newOAuthError(errInvalidGrant, "pre-authorized code was issued by another issuer",
+			http.StatusBadRequest)
+	}
+
+	if data.UserPIN != "" {
+		if userPIN == "" {
+			return nil, newOAuthError(errInvalidRequest, "user_pin is required", http.StatusBadRequest)
+		}
+
+		if userPIN != data.UserPIN {
+			return nil, newOAuthError(errInvalidGrant, "invalid user_pin", http.StatusBadRequest)
+		}
+	}
+
+	err = store.Delete(getPreAuthorizedCodeKeyPrefix(code))
+	if err != nil {
+		return nil, newOAuthError(errServerError, "failed to redeem pre-authorized code",
+			http.StatusInternalServerError)
+	}
+
+	return data.CredentialTypes, nil
+}
+
+// authorizationClaim is an entry of the claims of an authorization request, it requests a credential type or the
+// credentials of a credential manifest.
+type authorizationClaim struct {
+	Type       string `json:"type,omitempty"`
+	ManifestID string `json:"manifest_id,omitempty"`
+	Format     string `json:"format,omitempty"`
+}
+
+// offerClaims returns claims requesting the credential types and manifests of a credential offer.
+func offerClaims(credentialTypes, manifestIDs []string) []*authorizationClaim {
+	var claims []*authorizationClaim
+
+	for _, credentialType := range credentialTypes {
+		if credentialType != "" {
+			claims = append(claims, &authorizationClaim{Type: credentialType})
+		}
+	}
+
+	for _, manifestID := range manifestIDs {
+		if manifestID != "" {
+			claims = append(claims, &authorizationClaim{ManifestID: manifestID})
+		}
+	}
+
+	return claims
+}
+
+// authorizedCredentialTypes returns the credential types requested by the claims of an authorization request.
+// Manifests give the types of their output descriptors the issuer has credentials of, claims of credentials the
+// issuer does not issue are rejected.
+func authorizedCredentialTypes(claimsJSON string, issuerConf *issuerConfiguration) ([]string, error) {
+	var claims []*authorizationClaim
+
+	err := json.Unmarshal([]byte(claimsJSON), &claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse claims : %w", err)
+	}
+
+	return resolveClaims(claims, issuerConf)
+}
+
+func resolveClaims(claims []*authorizationClaim, issuerConf *issuerConfiguration) ([]string, error) {
+	var types []string
+
+	authorize := func(credentialType string) {
+		if !contains(types, credentialType) {
+			types = append(types, credentialType)
+		}
+	}
+
+	for _, claim := range claims {
+		if claim.Format != "" && !isSupportedFormat(claim.Format) {
+			return nil, fmt.Errorf("unsupported format %q claimed", claim.Format)
+		}
+
+		switch {
+		case claim.Type != "":
+			if _, ok := issuerConf.CredentialsSupported[claim.Type]; !ok {
+				return nil, fmt.Errorf("credential type %s is not issued by the issuer", claim.Type)
+			}
+
+			authorize(claim.Type)
+		case claim.ManifestID != "":
+			manifest, err := findCredentialManifest(issuerConf.CredentialManifests, claim.ManifestID)
+			if err != nil {
+				return nil, err
+			}
+
+			var found bool
+
+			for _, descriptor := range manifest.OutputDescriptors {
+				if _, ok := issuerConf.CredentialsSupported[descriptor.Schema]; ok {
+					authorize(descriptor.Schema)
+
+					found = true
+				}
+			}
+
+			if !found {
+				return nil, fmt.Errorf("credential manifest %s has no credentials issued by the issuer", manifest.ID)
+			}
+		default:
+			return nil, errors.New("claim requests neither a credential type nor a manifest")
+		}
+	}
+
+	if len(types) == 0 {
+		return nil, errors.New("claims request no credentials")
+	}
+
+	return types, nil
+}
+
+// defaultDisplayLocale is locale of display data taken from credential manifests which do not specify one.
+const defaultDisplayLocale = "en-US"
+
+// credentialIssuerMetadata is served at /.well-known/openid-credential-issuer of a mock issuer.
+type credentialIssuerMetadata struct {
+	CredentialIssuer           string                          `json:"credential_issuer"`
+	AuthorizationServer        string                          `json:"authorization_server,omitempty"`
+	CredentialEndpoint         string                          `json:"credential_endpoint"`
+	BatchCredentialEndpoint    string                          `json:"batch_credential_endpoint,omitempty"`
+	DeferredCredentialEndpoint string                          `json:"deferred_credential_endpoint,omitempty"`
+	CredentialsSupported       map[string]*supportedCredential `json:"credentials_supported"`
+	Display                    []*issuerDisplay                `json:"display,omitempty"`
+}
+
+// supportedCredential describes formats a credential type can be issued in and how wallets display it.
+type supportedCredential struct {
+	Formats map[string]*supportedCredentialFormat `json:"formats"`
+	Display []*credentialDisplay                  `json:"display,omitempty"`
+}
+
+// supportedCredentialFormat describes a credential type issued in a given format.
+type supportedCredentialFormat struct {
+	Types                                []string `json:"types"`
+	CryptographicBindingMethodsSupported []string `json:"cryptographic_binding_methods_supported,omitempty"`
+	CryptographicSuitesSupported         []string `json:"cryptographic_suites_supported,omitempty"`
+}
+
+// credentialDisplay is display data of a credential type in a given locale.
+type credentialDisplay struct {
+	Name            string        `json:"name"`
+	Locale          string        `json:"locale,omitempty"`
+	Description     string        `json:"description,omitempty"`
+	Logo            *displayImage `json:"logo,omitempty"`
+	BackgroundColor string        `json:"background_color,omitempty"`
+	TextColor       string        `json:"text_color,omitempty"`
+}
+
+// displayImage is an image shown by wallets.
+type displayImage struct {
+	URL     string `json:"url"`
+	AltText string `json:"alt_text,omitempty"`
+}
+
+// issuerDisplay is display data of the issuer in a given locale.
+type issuerDisplay struct {
+	Name   string `json:"name"`
+	Locale string `json:"locale,omitempty"`
+}
+
+// manifestDisplay is display data of a credential manifest. Manifests may carry a "locale" of their display data,
+// manifests submitted for several locales give localized display.
+type manifestDisplay struct {
+	Locale            string                 `json:"locale,omitempty"`
+	Issuer            cm.Issuer              `json:"issuer,omitempty"`
+	OutputDescriptors []*cm.OutputDescriptor `json:"output_descriptors,omitempty"`
+}
+
+// newSupportedCredential creates metadata of a credential type issued in all formats the issuer key of the settings
+// can sign.
+func newSupportedCredential(credential json.RawMessage, settings *issuerSettings) (*supportedCredential, error) {
+	var vc struct {
+		Type interface{} `json:"type"`
+	}
+
+	err := json.Unmarshal(credential, &vc)
+	if err != nil {
+		return nil, err
+	}
+
+	var types []string
+
+	switch t := vc.Type.(type) {
+	case string:
+		types = []string{t}
+	case []interface{}:
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+	}
+
+	formats := make(map[string]*supportedCredentialFormat)
+	for _, format := range []string{ldpVCFormat, jwtVCJSONFormat, jwtVCJSONLDFormat} {
+		if !canSignFormat(format, signingKeyType(settings.Key)) {
+			continue
+		}
+
+		formats[format] = &supportedCredentialFormat{
+			Types:                                types,
+			CryptographicBindingMethodsSupported: []string{"did"},
+			CryptographicSuitesSupported:         cryptographicSuites(format, settings),
+		}
+	}
+
+	return &supportedCredential{Formats: formats}, nil
+}
+
+// canSignFormat checks whether keys of given type can sign credentials in given format, BBS+ keys only sign linked
+// data proofs.
+func canSignFormat(format string, keyType kms.KeyType) bool {
+	return format == ldpVCFormat || jwsAlgorithmName(keyType) != ""
+}
+
+// cryptographicSuites returns suites credentials are signed with in given format by the issuer of the settings.
+func cryptographicSuites(format string, settings *issuerSettings) []string {
+	keyType := signingKeyType(settings.Key)
+
+	if format == ldpVCFormat {
+		return []string{settings.Proof.signatureType(keyType)}
+	}
+
+	return []string{jwsAlgorithmName(keyType)}
+}
+
+// addManifestDisplay adds display data of output descriptors in credential manifests to credential types matching
+// their schema, and returns display data of the issuers.
+func addManifestDisplay(credentialsSupported map[string]*supportedCredential,
+	credManifests string) ([]*issuerDisplay, error) {
+	if credManifests == "" {
+		return nil, nil
+	}
+
+	var manifests []*manifestDisplay
+
+	err := json.Unmarshal([]byte(credManifests), &manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	var issuers []*issuerDisplay
+
+	for _, manifest := range manifests {
+		locale := manifest.Locale
+		if locale == "" {
+			locale = defaultDisplayLocale
+		}
+
+		if manifest.Issuer.Name != "" {
+			issuers = append(issuers, &issuerDisplay{Name: manifest.Issuer.Name, Locale: locale})
+		}
+
+		for _, descriptor := range manifest.OutputDescriptors {
+			supported, ok := credentialsSupported[descriptor.Schema]
+			if !ok {
+				continue
+			}
+
+			supported.Display = append(supported.Display, newCredentialDisplay(descriptor, locale))
+		}
+	}
+
+	return issuers, nil
+}
+
+func newCredentialDisplay(descriptor *cm.OutputDescriptor, locale string) *credentialDisplay {
+	display := &credentialDisplay{Name: descriptor.Name, Locale: locale, Description: descriptor.Description}
+
+	if descriptor.Display != nil {
+		if name := displayMappingText(descriptor.Display.Title); name != "" {
+			display.Name = name
+		}
+
+		if description := displayMappingText(descriptor.Display.Description); description != "" {
+			display.Description = description
+		}
+	}
+
+	if display.Name == "" {
+		display.Name = descriptor.ID
+	}
+
+	if styles := descriptor.Styles; styles != nil {
+		if styles.Thumbnail != nil {
+			display.Logo = &displayImage{URL: styles.Thumbnail.URI, AltText: styles.Thumbnail.Alt}
+		}
+
+		if styles.Background != nil {
+			display.BackgroundColor = styles.Background.Color
+		}
+
+		if styles.Text != nil {
+			display.TextColor = styles.Text.Color
+		}
+	}
+
+	return display
+}
+
+// displayMappingText returns static text of a display mapping object, path mappings give their fallback.
+func displayMappingText(mapping *cm.DisplayMappingObject) string {
+	if mapping == nil {
+		return ""
+	}
+
+	if mapping.Text != "" {
+		return mapping.Text
+	}
+
+	return mapping.Fallback
+}
+
+// isSupportedFormat checks whether credential can be issued in given format.
+func isSupportedFormat(format string) bool {
+	switch format {
+	case ldpVCFormat, jwtVCJSONFormat, jwtVCJSONLDFormat:
+		return true
+	default:
+		return false
+	}
+}
+
+// accessTokenData is state of an access token issued by the token endpoint.
+type accessTokenData struct {
+	IssuerID        string    `json:"issuer_id"`
+	CNonce          string    `json:"c_nonce"`
+	CNonceExpiresAt time.Time `json:"c_nonce_expires_at"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	// CredentialTypes are the credential types the token authorizes to request.
+	CredentialTypes []string `json:"credential_types,omitempty"`
+	// Username is the user who logged in to authorize the token, empty for pre-authorized codes.
+	Username string `json:"username,omitempty"`
+}
+
+// authorizes checks whether the access token authorizes requests for credentials of given type.
+func (t *accessTokenData) authorizes(credentialType string) bool {
+	return contains(t.CredentialTypes, credentialType)
+}
+
+// rotateCNonce replaces the c_nonce of the access token with a fresh one.
+func (t *accessTokenData) rotateCNonce() {
+	t.CNonce = uuid.NewString()
+	t.CNonceExpiresAt = time.Now().Add(cNonceLifetime)
+}
+
+func saveAccessToken(store storage.Store, token string, data *accessTokenData) error {
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	// c_nonce rotation saves the token again, it keeps expiry of the token.
+	return putWithLifetime(store, getAccessTokenKeyPrefix(token), dataBytes, time.Until(data.ExpiresAt))
+}
+
+func readAccessToken(store storage.Store, token string) (*accessTokenData, error) {
+	dataBytes, err := store.Get(getAccessTokenKeyPrefix(token))
+	if err != nil {
+		return nil, err
+	}
+
+	var data accessTokenData
+
+	err = json.Unmarshal(dataBytes, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+// credentialRequest is a request sent to the credential endpoint, either as JSON or as form values with the proof
+// encoded as JSON.
+type credentialRequest struct {
+	Format string                  `json:"format,omitempty"`
+	Type   string                  `json:"type,omitempty"`
+	Proof  *credentialRequestProof `json:"proof,omitempty"`
+	// CredentialApplication applies for a credential of a credential manifest of the issuer, the credential is
+	// returned with its credential fulfillment.
+	CredentialApplication json.RawMessage `json:"credential_application,omitempty"`
+}
+
+// credentialRequestProof is proof of possession of the key credential is to be bound to.
+type credentialRequestProof struct {
+	ProofType string `json:"proof_type"`
+	JWT       string `json:"jwt"`
+}
+
+// batchCredentialRequest is a request sent to the batch credential endpoint.
+type batchCredentialRequest struct {
+	CredentialRequests []*credentialRequest `json:"credential_requests"`
+}
+
+// credentialResponse is a response of the credential endpoint, or an entry of the batch credential response.
+// Entries of requests that failed carry an error instead of the credential.
+type credentialResponse struct {
+	Format           string          `json:"format,omitempty"`
+	Credential       json.RawMessage `json:"credential,omitempty"`
+	AcceptanceToken  string          `json:"acceptance_token,omitempty"`
+	Error            string          `json:"error,omitempty"`
+	ErrorDescription string          `json:"error_description,omitempty"`
+	CNonce           string          `json:"c_nonce,omitempty"`
+	CNonceExpiresIn  int             `json:"c_nonce_expires_in,omitempty"`
+	// CredentialFulfillment maps the credential to the output descriptor of the applied for credential manifest.
+	CredentialFulfillment *cm.CredentialFulfillment `json:"credential_fulfillment,omitempty"`
+}
+
+// batchCredentialResponse is a response of the batch credential endpoint.
+type batchCredentialResponse struct {
+	CredentialResponses []*credentialResponse `json:"credential_responses"`
+	CNonce              string                `json:"c_nonce,omitempty"`
+	CNonceExpiresIn     int                   `json:"c_nonce_expires_in,omitempty"`
+}
+
+// proofClaims are claims of a JWT proof.
+type proofClaims struct {
+	Issuer   string      `json:"iss,omitempty"`
+	Audience interface{} `json:"aud,omitempty"`
+	IssuedAt int64       `json:"iat,omitempty"`
+	Nonce    string      `json:"nonce"`
+}
+
+func parseCredentialRequest(r *http.Request) (*credentialRequest, error) {
+	req := &credentialRequest{}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		err := json.NewDecoder(r.Body).Decode(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode credential request : %w", err)
+		}
+
+		return req, nil
+	}
+
+	req.Format = r.FormValue("format")
+	req.Type = r.FormValue("type")
+
+	if application := r.FormValue("credential_application"); application != "" {
+		req.CredentialApplication = json.RawMessage(application)
+	}
+
+	if proof := r.FormValue("proof"); proof != "" {
+		req.Proof = &credentialRequestProof{}
+
+		err := json.Unmarshal([]byte(proof), req.Proof)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode proof : %w", err)
+		}
+	}
+
+	return req, nil
+}
+
+// checkProof verifies JWT proof of possession of the holder key over the current c_nonce of the access token and
+// returns the holder DID.
+func (v *adapterApp) checkProof(proof *credentialRequestProof, token *accessTokenData, issuer string) (string, error) {
+	if proof == nil || proof.ProofType != jwtProofType || proof.JWT == "" {
+		return "", errors.New("jwt proof is required")
+	}
+
+	jwtProof, err := v.presVerifier.verifyJWT(proof.JWT)
+	if err != nil {
+		return "", err
+	}
+
+	claims := &proofClaims{}
+
+	err = jwtProof.DecodeClaims(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode proof claims : %w", err)
+	}
+
+	if claims.Nonce != token.CNonce {
+		return "", errors.New("proof is not signed over current c_nonce")
+	}
+
+	if time.Now().After(token.CNonceExpiresAt) {
+		return "", errors.New("c_nonce expired")
+	}
+
+	if !audienceContains(claims.Audience, issuer) {
+		return "", fmt.Errorf("proof audience does not contain issuer %s", issuer)
+	}
+
+	kid, _ := jwtProof.Headers.KeyID()
+
+	holderDID := strings.SplitN(kid, "#", 2)[0]
+	if !strings.HasPrefix(holderDID, "did:") {
+		return "", errors.New("proof kid must be a DID URL")
+	}
+
+	return holderDID, nil
+}
+
+func audienceContains(aud interface{}, issuer string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == issuer
+	case []interface{}:
+		for _, v := range a {
+			if v == issuer {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// setCredentialSubjectID binds credential to the holder by setting the ID of its subjects.
+func setCredentialSubjectID(vc *verifiable.Credential, id string) {
+	switch subject := vc.Subject.(type) {
+	case []verifiable.Subject:
+		for i := range subject {
+			subject[i].ID = id
+		}
+	case verifiable.Subject:
+		subject.ID = id
+		vc.Subject = subject
+	case map[string]interface{}:
+		subject["id"] = id
+	case []map[string]interface{}:
+		for i := range subject {
+			subject[i]["id"] = id
+		}
+	default:
+		vc.Subject = id
+	}
+}
+
+// issuerSettings are options of a mock issuer chosen when issuance is initiated.
+type issuerSettings struct {
+	DeferredIssuance bool `json:"deferred_issuance,omitempty"`
+	PendingCount     int  `json:"pending_count,omitempty"`
+	// Key is the signing identity of the issuer, issuers without one sign with the built-in did:key.
+	Key *issuerKey `json:"key,omitempty"`
+	// Proof is format of linked data proofs, issuers without one make the default proofs of the key type.
+	Proof *proofFormat `json:"proof,omitempty"`
+	// StatusPurpose is purpose of status list entries of issued credentials, revocation if not set.
+	StatusPurpose string `json:"status_purpose,omitempty"`
+}
+
+func saveIssuerSettings(store storage.Store, issuerID string, settings *issuerSettings) error {
+	settingsBytes, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	return putWithLifetime(store, getIssuerSettingsKeyPrefix(issuerID), settingsBytes, sessionLifetime)
+}
+
+// readIssuerSettings returns settings of given issuer, issuers initiated without settings get defaults.
+func readIssuerSettings(store storage.Store, issuerID string) (*issuerSettings, error) {
+	settingsBytes, err := store.Get(getIssuerSettingsKeyPrefix(issuerID))
+	if errors.Is(err, storage.ErrDataNotFound) {
+		return &issuerSettings{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var settings issuerSettings
+
+	err = json.Unmarshal(settingsBytes, &settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+// deferredCredentialData is state of a credential request accepted for deferred issuance.
+type deferredCredentialData struct {
+	IssuerID       string `json:"issuer_id"`
+	Format         string `json:"format,omitempty"`
+	CredentialType string `json:"credential_type"`
+	HolderDID      string `json:"holder_did"`
+	Username       string `json:"username,omitempty"`
+	PendingCount   int    `json:"pending_count"`
+	// Output is the output descriptor of the credential application the request was sent with, if any.
+	Output *applicationOutput `json:"output,omitempty"`
+}
+
+func saveDeferredCredential(store storage.Store, acceptanceToken string, data *deferredCredentialData) error {
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return putWithLifetime(store, getAcceptanceTokenKeyPrefix(acceptanceToken), dataBytes, sessionLifetime)
+}
+
+func readDeferredCredential(store storage.Store, acceptanceToken string) (*deferredCredentialData, error) {
+	dataBytes, err := store.Get(getAcceptanceTokenKeyPrefix(acceptanceToken))
+	if err != nil {
+		return nil, err
+	}
+
+	var data deferredCredentialData
+
+	err = json.Unmarshal(dataBytes, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+func getIssuerSettingsKeyPrefix(key string) string {
+	return fmt.Sprintf("issuer_settings_%s", key)
+}
+
+func getAcceptanceTokenKeyPrefix(key string) string {
+	return fmt.Sprintf("acceptance_token_%s", key)
+}
+
+func getPreAuthorizedCodeKeyPrefix(key string) string {
+	return fmt.Sprintf("preauth_code_%s", key)
+}
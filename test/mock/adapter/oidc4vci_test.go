@@ -0,0 +1,586 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/pkg/crypto/tinkcrypto"
+	afjwt "github.com/hyperledger/aries-framework-go/pkg/doc/jwt"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/hyperledger/aries-framework-go/pkg/kms/localkms"
+	mockkms "github.com/hyperledger/aries-framework-go/pkg/mock/kms"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock/noop"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/key"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssuerTokenEndpoint_PreAuthorizedCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		issuerID string
+		userPIN  string
+		form     url.Values
+		status   int
+		errCode  string
+	}{
+		{
+			name:     "without user PIN",
+			issuerID: "issuer-1",
+			form:     url.Values{"pre-authorized_code": {"code"}},
+			status:   http.StatusOK,
+		},
+		{
+			name:     "with user PIN",
+			issuerID: "issuer-1",
+			userPIN:  "1234",
+			form:     url.Values{"pre-authorized_code": {"code"}, "user_pin": {"1234"}},
+			status:   http.StatusOK,
+		},
+		{
+			name:     "missing user PIN",
+			issuerID: "issuer-1",
+			userPIN:  "1234",
+			form:     url.Values{"pre-authorized_code": {"code"}},
+			status:   http.StatusBadRequest,
+			errCode:  errInvalidRequest,
+		},
+		{
+			name:     "wrong user PIN",
+			issuerID: "issuer-1",
+			userPIN:  "1234",
+			form:     url.Values{"pre-authorized_code": {"code"}, "user_pin": {"0000"}},
+			status:   http.StatusBadRequest,
+			errCode:  errInvalidGrant,
+		},
+		{
+			name:     "unknown code",
+			issuerID: "issuer-1",
+			form:     url.Values{"pre-authorized_code": {"other"}},
+			status:   http.StatusBadRequest,
+			errCode:  errInvalidGrant,
+		},
+		{
+			name:     "code of another issuer",
+			issuerID: "issuer-2",
+			form:     url.Values{"pre-authorized_code": {"code"}},
+			status:   http.StatusBadRequest,
+			errCode:  errInvalidGrant,
+		},
+		{
+			name:     "missing code",
+			issuerID: "issuer-1",
+			form:     url.Values{},
+			status:   http.StatusBadRequest,
+			errCode:  errInvalidRequest,
+		},
+	}
+
+	for _, test := range tests {
+		tc := test
+		t.Run(tc.name, func(t *testing.T) {
+			app := newTestAdapterApp(t)
+
+			require.NoError(t, savePreAuthorizedCode(app.store, "code",
+				&preAuthorizedCodeData{IssuerID: "issuer-1", UserPIN: tc.userPIN}))
+
+			tc.form.Set("grant_type", preAuthorizedCodeGrantType)
+
+			rr := postTokenRequest(app, tc.issuerID, tc.form)
+			require.Equal(t, tc.status, rr.Code, rr.Body.String())
+
+			var resp map[string]interface{}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+			if tc.errCode != "" {
+				require.Equal(t, tc.errCode, resp["error"])
+				return
+			}
+
+			require.NotEmpty(t, resp["access_token"])
+
+			// codes are one-time.
+			rr = postTokenRequest(app, tc.issuerID, tc.form)
+			require.Equal(t, http.StatusBadRequest, rr.Code)
+		})
+	}
+
+	t.Run("unsupported grant type", func(t *testing.T) {
+		rr := postTokenRequest(newTestAdapterApp(t), "issuer-1", url.Values{"grant_type": {"password"}})
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), errUnsupportedGrantType)
+	})
+}
+
+func TestIssuerCredentialEndpoint_Proof(t *testing.T) {
+	app, accessToken, nonce := newTestIssuer(t, &issuerSettings{})
+
+	t.Run("missing proof", func(t *testing.T) {
+		rr := postCredentialRequest(t, app, "issuer-1", accessToken, nil)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		require.Equal(t, errInvalidOrMissingProof, resp["error"])
+		require.NotEmpty(t, resp["c_nonce"])
+
+		nonce = resp["c_nonce"].(string)
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		rr := postCredentialRequest(t, app, "issuer-1", accessToken,
+			createTestProof(t, "https://other.example.com", nonce))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), errInvalidOrMissingProof)
+
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+		nonce = resp["c_nonce"].(string)
+	})
+
+	t.Run("stale nonce", func(t *testing.T) {
+		rr := postCredentialRequest(t, app, "issuer-1", accessToken,
+			createTestProof(t, "https://issuer.example.com/issuer-1", "stale"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		require.Equal(t, errInvalidOrMissingProof, resp["error"])
+		require.NotEqual(t, nonce, resp["c_nonce"])
+
+		nonce = resp["c_nonce"].(string)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		rr := postCredentialRequest(t, app, "issuer-1", accessToken,
+			createTestProof(t, "https://issuer.example.com/issuer-1", nonce))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var resp struct {
+			Credential struct {
+				CredentialSubject struct {
+					ID string `json:"id"`
+				} `json:"credentialSubject"`
+			} `json:"credential"`
+			CNonce string `json:"c_nonce"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		require.Equal(t, didKey, resp.Credential.CredentialSubject.ID)
+		require.NotEqual(t, nonce, resp.CNonce)
+
+		// used nonce can not be replayed.
+		rr = postCredentialRequest(t, app, "issuer-1", accessToken,
+			createTestProof(t, "https://issuer.example.com/issuer-1", nonce))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), errInvalidOrMissingProof)
+	})
+
+	t.Run("unknown access token", func(t *testing.T) {
+		rr := postCredentialRequest(t, app, "issuer-1", "unknown", nil)
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func TestIssuerCredentialEndpoint_Formats(t *testing.T) {
+	app, accessToken, nonce := newTestIssuer(t, &issuerSettings{})
+
+	for _, format := range []string{jwtVCJSONFormat, jwtVCJSONLDFormat} {
+		rr := postCredentialRequestWithFormat(t, app, "issuer-1", accessToken, format,
+			createTestProof(t, "https://issuer.example.com/issuer-1", nonce))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var resp struct {
+			Format     string `json:"format"`
+			Credential string `json:"credential"`
+			CNonce     string `json:"c_nonce"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		require.Equal(t, format, resp.Format)
+
+		vc, err := verifiable.ParseCredential([]byte(resp.Credential),
+			verifiable.WithJSONLDDocumentLoader(app.documentLoader),
+			verifiable.WithPublicKeyFetcher(verifiable.NewVDRKeyResolver(app.presVerifier.vdr).PublicKeyFetcher()))
+		require.NoError(t, err)
+		require.True(t, isJWS([]byte(resp.Credential)))
+		require.Equal(t, didKey, vc.Subject.([]verifiable.Subject)[0].ID)
+
+		nonce = resp.CNonce
+	}
+
+	t.Run("unsupported format", func(t *testing.T) {
+		rr := postCredentialRequestWithFormat(t, app, "issuer-1", accessToken, "mso_mdoc",
+			createTestProof(t, "https://issuer.example.com/issuer-1", nonce))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestIssuerCredentialEndpoint_NotStaged(t *testing.T) {
+	for _, settings := range []*issuerSettings{{}, {DeferredIssuance: true}} {
+		app, accessToken, nonce := newTestIssuer(t, settings)
+		require.NoError(t, app.store.Delete(getCredStoreKeyPrefix("issuer-1", "VerifiableCredential")))
+
+		rr := postCredentialRequest(t, app, "issuer-1", accessToken,
+			createTestProof(t, "https://issuer.example.com/issuer-1", nonce))
+		require.Equal(t, http.StatusBadRequest, rr.Code, rr.Body.String())
+		require.Contains(t, rr.Body.String(), errUnsupportedCredentialType)
+		require.Contains(t, rr.Body.String(), "no credential of type")
+	}
+}
+
+func TestIssuerBatchCredentialEndpoint(t *testing.T) {
+	app, accessToken, nonce := newTestIssuer(t, &issuerSettings{})
+	proof := createTestProof(t, "https://issuer.example.com/issuer-1", nonce)
+
+	rr := postBatchCredentialRequest(t, app, "issuer-1", accessToken, []*credentialRequest{
+		{Format: ldpVCFormat, Type: "VerifiableCredential", Proof: proof},
+		{Format: jwtVCJSONFormat, Type: "VerifiableCredential", Proof: proof},
+		{Format: ldpVCFormat, Type: "UnknownCredential", Proof: proof},
+		{Format: "mso_mdoc", Type: "VerifiableCredential", Proof: proof},
+		{Format: ldpVCFormat, Type: "VerifiableCredential"},
+	})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var resp batchCredentialResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	require.Len(t, resp.CredentialResponses, 5)
+	require.NotEmpty(t, resp.CNonce)
+	require.NotEqual(t, nonce, resp.CNonce)
+
+	require.Empty(t, resp.CredentialResponses[0].Error)
+	require.Contains(t, string(resp.CredentialResponses[0].Credential), didKey)
+	require.Empty(t, resp.CredentialResponses[1].Error)
+	require.True(t, isJWS(resp.CredentialResponses[1].Credential))
+	require.Equal(t, errUnsupportedCredentialType, resp.CredentialResponses[2].Error)
+	require.Equal(t, errUnsupportedCredentialFormat, resp.CredentialResponses[3].Error)
+	require.Equal(t, errInvalidOrMissingProof, resp.CredentialResponses[4].Error)
+
+	t.Run("empty batch", func(t *testing.T) {
+		rr := postBatchCredentialRequest(t, app, "issuer-1", accessToken, nil)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), errInvalidRequest)
+	})
+
+	t.Run("unknown access token", func(t *testing.T) {
+		rr := postBatchCredentialRequest(t, app, "issuer-1", "unknown", []*credentialRequest{{Proof: proof}})
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func TestAuthorizedCredentialTypes(t *testing.T) {
+	issuerConf := &issuerConfiguration{
+		CredentialsSupported: map[string]*supportedCredential{
+			"VerifiableCredential":            {},
+			"https://w3id.org/citizenship/v1": {},
+		},
+		CredentialManifests: []byte(`[{
+			"id": "PRC",
+			"issuer": {"id": "did:example:123"},
+			"output_descriptors": [{"id": "prc_output", "schema": "https://w3id.org/citizenship/v1"}]
+		}, {
+			"id": "DL",
+			"issuer": {"id": "did:example:123"},
+			"output_descriptors": [{"id": "dl_output", "schema": "https://w3id.org/dl/v1"}]
+		}]`),
+	}
+
+	types, err := authorizedCredentialTypes(`[{"type":"VerifiableCredential","format":"ldp_vc"},
+		{"manifest_id":"PRC","format":"ldp_vc"},{"type":"https://w3id.org/citizenship/v1"}]`, issuerConf)
+	require.NoError(t, err)
+	require.Equal(t, []string{"VerifiableCredential", "https://w3id.org/citizenship/v1"}, types)
+
+	for claims, expected := range map[string]string{
+		`{`:                              "failed to parse claims",
+		`[]`:                             "claims request no credentials",
+		`[{"format":"ldp_vc"}]`:          "neither a credential type nor a manifest",
+		`[{"type":"UnknownCredential"}]`: "UnknownCredential is not issued by the issuer",
+		`[{"manifest_id":"unknown"}]`:    "unknown credential manifest unknown",
+		`[{"manifest_id":"DL"}]`:         "DL has no credentials issued by the issuer",
+		`[{"type":"VerifiableCredential","format":"mso_mdoc"}]`: "unsupported format",
+	} {
+		_, err = authorizedCredentialTypes(claims, issuerConf)
+		require.ErrorContains(t, err, expected, claims)
+	}
+}
+
+func TestNewSupportedCredential(t *testing.T) {
+	supported, err := newSupportedCredential([]byte(testCredential), &issuerSettings{})
+	require.NoError(t, err)
+	require.Len(t, supported.Formats, 3)
+	require.Equal(t, []string{"VerifiableCredential"}, supported.Formats[jwtVCJSONFormat].Types)
+	require.Equal(t, []string{"Ed25519Signature2018"}, supported.Formats[ldpVCFormat].CryptographicSuitesSupported)
+	require.Equal(t, []string{"EdDSA"}, supported.Formats[jwtVCJSONFormat].CryptographicSuitesSupported)
+
+	supported, err = newSupportedCredential([]byte(testCredential),
+		&issuerSettings{Key: &issuerKey{KeyType: kms.ECDSAP384TypeIEEEP1363}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"JsonWebSignature2020"}, supported.Formats[ldpVCFormat].CryptographicSuitesSupported)
+	require.Equal(t, []string{"ES384"}, supported.Formats[jwtVCJSONLDFormat].CryptographicSuitesSupported)
+
+	supported, err = newSupportedCredential([]byte(testCredential),
+		&issuerSettings{Key: &issuerKey{KeyType: kms.BLS12381G2Type}})
+	require.NoError(t, err)
+	require.Len(t, supported.Formats, 1)
+	require.Equal(t, []string{"BbsBlsSignature2020"}, supported.Formats[ldpVCFormat].CryptographicSuitesSupported)
+
+	_, err = newSupportedCredential([]byte("{"), &issuerSettings{})
+	require.Error(t, err)
+}
+
+func TestWellKnownCredentialIssuer(t *testing.T) {
+	app := newTestAdapterApp(t)
+
+	manifests := `[{
+		"id": "PRC",
+		"locale": "fr-CA",
+		"issuer": {"id": "did:example:123", "name": "Gouvernement"},
+		"output_descriptors": [{
+			"id": "prc_output",
+			"schema": "https://w3id.org/citizenship/v1",
+			"display": {
+				"title": {"path": ["$.name"], "schema": {"type": "string"}, "fallback": "Carte de résident"},
+				"description": {"text": "Carte de résident permanent"}
+			},
+			"styles": {
+				"thumbnail": {"uri": "https://example.com/logo.svg", "alt": "Logo"},
+				"background": {"color": "#2b5283"},
+				"text": {"color": "#fff"}
+			}
+		}]
+	}, {
+		"id": "PRC",
+		"issuer": {"id": "did:example:123", "name": "Government"},
+		"output_descriptors": [{"id": "prc_output", "schema": "https://w3id.org/citizenship/v1"}]
+	}]`
+
+	form := url.Values{
+		"walletInitIssuanceURL": {"https://wallet.example.com/initiate"},
+		"issuerURL":             {"https://issuer.example.com"},
+		"credentialTypes":       {"https://w3id.org/citizenship/v1"},
+		"credManifest":          {manifests},
+		"credsToIssue":          {`{"https://w3id.org/citizenship/v1": ` + testCredential + `}`},
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/issuer/oidc/issuance", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	app.initiateIssuance(rr, r)
+	require.Equal(t, http.StatusFound, rr.Code, rr.Body.String())
+
+	redirect, err := url.Parse(rr.Header().Get("Location"))
+	require.NoError(t, err)
+
+	issuer := redirect.Query().Get("issuer")
+	issuerID := strings.TrimPrefix(issuer, "https://issuer.example.com/")
+
+	r = mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/"+issuerID+"/.well-known/openid-credential-issuer", nil),
+		map[string]string{"id": issuerID})
+
+	rr = httptest.NewRecorder()
+	app.wellKnownCredentialIssuer(rr, r)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var metadata credentialIssuerMetadata
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &metadata))
+	require.Equal(t, issuer, metadata.CredentialIssuer)
+	require.Equal(t, issuer+"/issuer/oidc/batch_credential", metadata.BatchCredentialEndpoint)
+	require.Equal(t, []*issuerDisplay{{Name: "Gouvernement", Locale: "fr-CA"}, {Name: "Government", Locale: "en-US"}},
+		metadata.Display)
+
+	supported := metadata.CredentialsSupported["https://w3id.org/citizenship/v1"]
+	require.NotNil(t, supported)
+	require.Equal(t, []string{"did"}, supported.Formats[ldpVCFormat].CryptographicBindingMethodsSupported)
+	require.Equal(t, []string{"EdDSA"}, supported.Formats[jwtVCJSONFormat].CryptographicSuitesSupported)
+	require.Equal(t, []*credentialDisplay{
+		{
+			Name:            "Carte de résident",
+			Locale:          "fr-CA",
+			Description:     "Carte de résident permanent",
+			Logo:            &displayImage{URL: "https://example.com/logo.svg", AltText: "Logo"},
+			BackgroundColor: "#2b5283",
+			TextColor:       "#fff",
+		},
+		{Name: "prc_output", Locale: "en-US"},
+	}, supported.Display)
+}
+
+func TestIssuerDeferredCredentialEndpoint(t *testing.T) {
+	app, accessToken, nonce := newTestIssuer(t, &issuerSettings{DeferredIssuance: true, PendingCount: 2})
+
+	rr := postCredentialRequest(t, app, "issuer-1", accessToken,
+		createTestProof(t, "https://issuer.example.com/issuer-1", nonce))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	require.NotContains(t, resp, "credential")
+	require.NotEmpty(t, resp["acceptance_token"])
+
+	acceptanceToken := resp["acceptance_token"].(string)
+
+	for i := 0; i < 2; i++ {
+		rr = postDeferredCredentialRequest(app, "issuer-1", acceptanceToken)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), errIssuancePending)
+	}
+
+	t.Run("acceptance token of another issuer", func(t *testing.T) {
+		rr := postDeferredCredentialRequest(app, "issuer-2", acceptanceToken)
+		require.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	rr = postDeferredCredentialRequest(app, "issuer-1", acceptanceToken)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Contains(t, rr.Body.String(), didKey)
+
+	// acceptance tokens are one-time.
+	rr = postDeferredCredentialRequest(app, "issuer-1", acceptanceToken)
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+// newTestIssuer creates adapter with an issuer of VerifiableCredential and returns access token and c_nonce issued
+// for it.
+func newTestIssuer(t *testing.T, settings *issuerSettings) (*adapterApp, string, string) {
+	t.Helper()
+
+	app := newTestAdapterApp(t)
+	app.documentLoader = testDocumentLoader(t)
+	app.presVerifier = newPresentationVerifier(vdr.New(vdr.WithVDR(key.New())), app.documentLoader)
+
+	issuerConf, err := json.Marshal(&issuerConfiguration{Issuer: "https://issuer.example.com/issuer-1"})
+	require.NoError(t, err)
+	require.NoError(t, app.store.Put("issuer-1", issuerConf))
+	require.NoError(t, app.store.Put(getCredStoreKeyPrefix("issuer-1", "VerifiableCredential"),
+		[]byte(testCredential)))
+	require.NoError(t, saveIssuerSettings(app.store, "issuer-1", settings))
+	require.NoError(t, savePreAuthorizedCode(app.store, "code", &preAuthorizedCodeData{IssuerID: "issuer-1",
+		CredentialTypes: []string{"VerifiableCredential"}}))
+
+	rr := postTokenRequest(app, "issuer-1", url.Values{"grant_type": {preAuthorizedCodeGrantType},
+		"pre-authorized_code": {"code"}})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var tokenResp map[string]interface{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tokenResp))
+	require.NotEmpty(t, tokenResp["access_token"])
+	require.NotEmpty(t, tokenResp["c_nonce"])
+	require.NotEmpty(t, tokenResp["c_nonce_expires_in"])
+	require.Equal(t, accessTokenLifetime.Seconds(), tokenResp["expires_in"])
+
+	return app, tokenResp["access_token"].(string), tokenResp["c_nonce"].(string)
+}
+
+func newTestAdapterApp(t *testing.T) *adapterApp {
+	t.Helper()
+
+	// status lists of issued credentials are hosted at the external URL.
+	t.Setenv(demoExternalURLEnvKey, "https://adapter.example.com")
+
+	store, err := mem.NewProvider().OpenStore("verifier")
+	require.NoError(t, err)
+
+	km, err := localkms.New("local-lock://test", mockkms.NewProviderForKMS(mem.NewProvider(), &noop.NoLock{}))
+	require.NoError(t, err)
+
+	crypto, err := tinkcrypto.New()
+	require.NoError(t, err)
+
+	return &adapterApp{store: newExpiringStore(store), kms: km, crypto: crypto, events: newEventBroker()}
+}
+
+func postTokenRequest(app *adapterApp, issuerID string, form url.Values) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	app.issuerTokenEndpoint(rr, newTokenRequest(issuerID, form))
+
+	return rr
+}
+
+func newTokenRequest(issuerID string, form url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/"+issuerID+"/issuer/oidc/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return mux.SetURLVars(r, map[string]string{"id": issuerID})
+}
+
+func postCredentialRequest(t *testing.T, app *adapterApp, issuerID, accessToken string,
+	proof *credentialRequestProof) *httptest.ResponseRecorder {
+	t.Helper()
+
+	return postCredentialRequestWithFormat(t, app, issuerID, accessToken, ldpVCFormat, proof)
+}
+
+func postCredentialRequestWithFormat(t *testing.T, app *adapterApp, issuerID, accessToken, format string,
+	proof *credentialRequestProof) *httptest.ResponseRecorder {
+	t.Helper()
+
+	reqBytes, err := json.Marshal(&credentialRequest{Format: format, Type: "VerifiableCredential", Proof: proof})
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/"+issuerID+"/issuer/oidc/credential", bytes.NewReader(reqBytes))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer "+accessToken)
+	r = mux.SetURLVars(r, map[string]string{"id": issuerID})
+
+	rr := httptest.NewRecorder()
+	app.issuerCredentialEndpoint(rr, r)
+
+	return rr
+}
+
+func postBatchCredentialRequest(t *testing.T, app *adapterApp, issuerID, accessToken string,
+	requests []*credentialRequest) *httptest.ResponseRecorder {
+	t.Helper()
+
+	reqBytes, err := json.Marshal(&batchCredentialRequest{CredentialRequests: requests})
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/"+issuerID+"/issuer/oidc/batch_credential", bytes.NewReader(reqBytes))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer "+accessToken)
+	r = mux.SetURLVars(r, map[string]string{"id": issuerID})
+
+	rr := httptest.NewRecorder()
+	app.issuerBatchCredentialEndpoint(rr, r)
+
+	return rr
+}
+
+func postDeferredCredentialRequest(app *adapterApp, issuerID, acceptanceToken string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/"+issuerID+"/issuer/oidc/deferred_credential", nil)
+	r.Header.Set("Authorization", "Bearer "+acceptanceToken)
+	r = mux.SetURLVars(r, map[string]string{"id": issuerID})
+
+	rr := httptest.NewRecorder()
+	app.issuerDeferredCredentialEndpoint(rr, r)
+
+	return rr
+}
+
+func createTestProof(t *testing.T, audience, nonce string) *credentialRequestProof {
+	t.Helper()
+
+	token, err := afjwt.NewSigned(&proofClaims{Issuer: didKey, Audience: audience, IssuedAt: time.Now().Unix(), Nonce: nonce},
+		nil, &testJWTSigner{kid: kid})
+	require.NoError(t, err)
+
+	jws, err := token.Serialize(false)
+	require.NoError(t, err)
+
+	return &credentialRequestProof{ProofType: jwtProofType, JWT: jws}
+}
@@ -0,0 +1,217 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/decorator"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/issuecredential"
+	presentproofsvc "github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/presentproof"
+)
+
+// problem codes of DIDComm actions stopped by the adapter.
+const (
+	// problemCodeInvalidMessage is the code of messages missing data the adapter needs, e.g. thread or invitation.
+	problemCodeInvalidMessage = "invalid-message"
+	// problemCodeUnknownSession is the code of messages of threads or invitations the adapter has no session of.
+	problemCodeUnknownSession = "unknown-session"
+	// problemCodeInternalError is the code of failures of the adapter itself.
+	problemCodeInternalError = "internal-error"
+	// problemCodeVerificationFailed is the code of presentations failing verification.
+	problemCodeVerificationFailed = "verification-failed"
+	// problemCodeUnsupportedMessage is the code of messages the adapter does not handle.
+	problemCodeUnsupportedMessage = "unsupported-message"
+)
+
+// actionProblem is the reason a DIDComm action is stopped with, it is sent to the holder in the problem-report.
+type actionProblem struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+func newActionProblem(code, msg string, err error) *actionProblem {
+	if err == nil {
+		return &actionProblem{Code: code, Description: msg}
+	}
+
+	return &actionProblem{Code: code, Description: fmt.Sprintf("%s : %s", msg, err)}
+}
+
+func (p *actionProblem) Error() string {
+	return fmt.Sprintf("%s : %s", p.Code, p.Description)
+}
+
+// stopAction stops the DIDComm action with a problem-report and fails the session of its thread. Aries reports
+// stopped actions with code "rejected" only, so the adapter replies with the problem-report of the protocol itself,
+// holding the problem code and description, and leaves the action unanswered. The problem is also passed to the result
+// page the holder is redirected to. Actions that can not be reported on are stopped.
+func (v *adapterApp) stopAction(action service.DIDCommAction, problem *actionProblem) {
+	logger.Errorf("failed to handle %s message : %s", action.Message.Type(), problem)
+
+	// messages without thread are stopped too.
+	thID, _ := action.Message.ThreadID()
+
+	v.failSession(v.threadSession(thID), problem.Error())
+	v.publishEvent(&adapterEvent{Type: eventError, ThreadID: thID, MessageType: action.Message.Type(),
+		Data: problem, Error: problem.Error()})
+
+	err := v.sendProblemReport(action, thID, problem)
+	if err != nil {
+		logger.Warnf("failed to send problem-report of %s message, stopping it : %s", action.Message.Type(), err)
+
+		action.Stop(problem)
+	}
+}
+
+// sendProblemReport replies to the action message with the problem-report of its protocol holding the problem code
+// and description, and redirecting the holder to the result page.
+func (v *adapterApp) sendProblemReport(action service.DIDCommAction, thID string, problem *actionProblem) error {
+	var myDID, theirDID string
+
+	if action.Properties != nil {
+		myDID, _ = action.Properties.All()["myDID"].(string)
+		theirDID, _ = action.Properties.All()["theirDID"].(string)
+	}
+
+	msg, ok := action.Message.(service.DIDCommMsgMap)
+	if !ok || myDID == "" || theirDID == "" {
+		return fmt.Errorf("no connection to report the problem on")
+	}
+
+	reportType := problemReportMsgType(msg.Type())
+	if reportType == "" {
+		return fmt.Errorf("messages of type %s can not be reported on", msg.Type())
+	}
+
+	redirect := &decorator.WebRedirect{
+		Status: "FAIL",
+		URL: actionRedirectURL(msg.Type(), thID) + "?" +
+			url.Values{"code": {problem.Code}, "description": {problem.Description}}.Encode(),
+	}
+
+	// holders of both protocols and DIDComm versions read the redirect of a problem-report from "~web-redirect".
+	if isV2, _ := service.IsDIDCommV2(&msg); isV2 {
+		return v.agent.Messenger.ReplyToMsg(msg, service.DIDCommMsgMap{
+			"type":          reportType,
+			"body":          map[string]interface{}{"code": problem.Code, "comment": problem.Description},
+			"~web-redirect": redirect,
+		}, myDID, theirDID, service.WithVersion(service.V2))
+	}
+
+	return v.agent.Messenger.ReplyToMsg(msg, service.DIDCommMsgMap{
+		"@type":         reportType,
+		"description":   map[string]interface{}{"code": problem.Code, "en": problem.Description},
+		"~web-redirect": redirect,
+	}, myDID, theirDID, service.WithVersion(service.V1))
+}
+
+// problemReportMsgType returns the problem-report message type of the protocol of the message, or an empty string for
+// messages of other protocols.
+func problemReportMsgType(msgType string) string {
+	switch msgType {
+	case presentproofsvc.ProposePresentationMsgTypeV2, presentproofsvc.PresentationMsgTypeV2:
+		return presentproofsvc.ProblemReportMsgTypeV2
+	case presentproofsvc.ProposePresentationMsgTypeV3, presentproofsvc.PresentationMsgTypeV3:
+		return presentproofsvc.ProblemReportMsgTypeV3
+	case issuecredential.ProposeCredentialMsgTypeV2, issuecredential.RequestCredentialMsgTypeV2:
+		return issuecredential.ProblemReportMsgTypeV2
+	case issuecredential.ProposeCredentialMsgTypeV3, issuecredential.RequestCredentialMsgTypeV3:
+		return issuecredential.ProblemReportMsgTypeV3
+	default:
+		return ""
+	}
+}
+
+// actionRedirectURL returns the result page of the thread the holder is redirected to, or an empty string for
+// messages of protocols without result page.
+func actionRedirectURL(msgType, thID string) string {
+	switch msgType {
+	case presentproofsvc.ProposePresentationMsgTypeV2, presentproofsvc.ProposePresentationMsgTypeV3,
+		presentproofsvc.PresentationMsgTypeV2, presentproofsvc.PresentationMsgTypeV3:
+		return os.Getenv(demoExternalURLEnvKey) + "/verifier/waci-share/" + thID
+	case issuecredential.ProposeCredentialMsgTypeV2, issuecredential.ProposeCredentialMsgTypeV3,
+		issuecredential.RequestCredentialMsgTypeV2, issuecredential.RequestCredentialMsgTypeV3:
+		return os.Getenv(demoExternalURLEnvKey) + "/issuer/waci-issuance/" + thID
+	default:
+		return ""
+	}
+}
+
+// problemReport holds the code and comment of both DIDComm V1 and V2 problem-reports.
+type problemReport struct {
+	Description struct {
+		Code string `json:"code"`
+	} `json:"description"`
+	Body struct {
+		Code    string `json:"code"`
+		Comment string `json:"comment"`
+	} `json:"body"`
+}
+
+func (r *problemReport) problem() *actionProblem {
+	if r.Body.Code != "" {
+		return &actionProblem{Code: r.Body.Code, Description: r.Body.Comment}
+	}
+
+	return &actionProblem{Code: r.Description.Code}
+}
+
+// listenForProblemReports fails sessions of threads the holder sent a problem-report on, e.g. when declining a
+// credential offer or presentation request.
+func (v *adapterApp) listenForProblemReports(stateCh chan service.StateMsg) {
+	for msg := range stateCh {
+		if msg.Type != service.PostState || !isProblemReport(msg.Msg.Type()) {
+			continue
+		}
+
+		v.handleProblemReport(msg.Msg)
+	}
+}
+
+func (v *adapterApp) handleProblemReport(msg service.DIDCommMsg) {
+	var report problemReport
+
+	err := msg.Decode(&report)
+	if err != nil {
+		logger.Errorf("failed to decode problem-report : %s", err)
+
+		return
+	}
+
+	problem := report.problem()
+	// reports without thread are published too.
+	thID, _ := msg.ThreadID()
+
+	logger.Warnf("received problem-report : thID=%s problem=%s", thID, problem)
+
+	v.failSession(v.threadSession(thID), problem.Error())
+	v.publishEvent(&adapterEvent{Type: eventProblemReportReceived, ThreadID: thID, MessageType: msg.Type(),
+		Data: problem, Error: problem.Error()})
+}
+
+func isProblemReport(msgType string) bool {
+	switch msgType {
+	case presentproofsvc.ProblemReportMsgTypeV2, presentproofsvc.ProblemReportMsgTypeV3,
+		issuecredential.ProblemReportMsgTypeV2, issuecredential.ProblemReportMsgTypeV3:
+		return true
+	default:
+		return false
+	}
+}
+
+// problemFromQuery returns the problem passed to result pages by declined actions, or an empty string.
+func problemFromQuery(query url.Values) string {
+	if query.Get("code") == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("ERROR: %s", (&actionProblem{Code: query.Get("code"), Description: query.Get("description")}))
+}
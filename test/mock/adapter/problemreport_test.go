@@ -0,0 +1,278 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/decorator"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/issuecredential"
+	presentproofsvc "github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/presentproof"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenForDIDCommMsg_Problems(t *testing.T) {
+	t.Run("unsupported message", func(t *testing.T) {
+		app := newTestAdapterApp(t)
+
+		stops := runTestAction(t, app, service.DIDCommMsgMap{
+			"@type": "https://didcomm.org/basicmessage/1.0/message",
+		})
+
+		require.Len(t, stops, 1)
+		require.Equal(t, problemCodeUnsupportedMessage, stops[0].Code)
+	})
+
+	t.Run("unknown session", func(t *testing.T) {
+		app := newTestAdapterApp(t)
+		saveTestSession(t, app, "session-1", "thread-1")
+
+		events := app.events.subscribe(&eventFilter{SessionID: "session-1"})
+
+		stops := runTestAction(t, app, service.DIDCommMsgMap{
+			"@id":     "request-1",
+			"@type":   issuecredential.RequestCredentialMsgTypeV2,
+			"~thread": map[string]interface{}{"thid": "thread-1"},
+		})
+
+		require.Len(t, stops, 1)
+		require.Equal(t, problemCodeUnknownSession, stops[0].Code)
+
+		session := getTestSession(t, app, "session-1")
+		require.Equal(t, sessionStatusFailed, session.Status)
+		require.Contains(t, session.Error, problemCodeUnknownSession)
+
+		require.Equal(t, eventRequestReceived, (<-events).Type)
+
+		event := <-events
+		require.Equal(t, eventError, event.Type)
+		require.Equal(t, "thread-1", event.ThreadID)
+		require.Equal(t, stops[0], event.Data)
+	})
+
+	t.Run("invalid message", func(t *testing.T) {
+		app := newTestAdapterApp(t)
+
+		stops := runTestAction(t, app, service.DIDCommMsgMap{
+			"@type": presentproofsvc.PresentationMsgTypeV2,
+		})
+
+		require.Len(t, stops, 1)
+		require.Equal(t, problemCodeInvalidMessage, stops[0].Code)
+	})
+}
+
+func TestHandleProblemReport(t *testing.T) {
+	t.Run("DIDComm V1", func(t *testing.T) {
+		app := newTestAdapterApp(t)
+		saveTestSession(t, app, "session-1", "thread-1")
+
+		app.handleProblemReport(service.DIDCommMsgMap{
+			"@id":         "report-1",
+			"@type":       presentproofsvc.ProblemReportMsgTypeV2,
+			"~thread":     map[string]interface{}{"thid": "thread-1"},
+			"description": map[string]interface{}{"code": "rejected"},
+		})
+
+		session := getTestSession(t, app, "session-1")
+		require.Equal(t, sessionStatusFailed, session.Status)
+		require.Contains(t, session.Error, "rejected")
+	})
+
+	t.Run("DIDComm V2", func(t *testing.T) {
+		app := newTestAdapterApp(t)
+		saveTestSession(t, app, "session-1", "thread-1")
+
+		events := app.events.subscribe(&eventFilter{ThreadID: "thread-1"})
+
+		app.handleProblemReport(service.DIDCommMsgMap{
+			"id":   "report-1",
+			"type": issuecredential.ProblemReportMsgTypeV3,
+			"thid": "thread-1",
+			"body": map[string]interface{}{"code": "e.p.xfer.cant-use-endpoint", "comment": "offer declined"},
+		})
+
+		session := getTestSession(t, app, "session-1")
+		require.Equal(t, sessionStatusFailed, session.Status)
+		require.Equal(t, "e.p.xfer.cant-use-endpoint : offer declined", session.Error)
+
+		event := <-events
+		require.Equal(t, eventProblemReportReceived, event.Type)
+		require.Equal(t, "session-1", event.SessionID)
+	})
+}
+
+func TestWACICallback_Problem(t *testing.T) {
+	app := newTestAdapterApp(t)
+
+	query := url.Values{"code": {problemCodeUnknownSession}, "description": {"failed to get WACI issuance data"}}
+
+	for path, handler := range map[string]http.HandlerFunc{
+		"/issuer/waci-issuance/thread-1": app.waciIssuanceCallback,
+		"/verifier/waci-share/thread-1":  app.waciShareCallback,
+	} {
+		r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, path+"?"+query.Encode(), nil),
+			map[string]string{"id": "thread-1"})
+
+		rr := httptest.NewRecorder()
+		handler(rr, r)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Contains(t, rr.Body.String(), "ERROR: unknown-session : failed to get WACI issuance data")
+	}
+}
+
+func TestStopAction_ProblemReport(t *testing.T) {
+	props := testEventProperties{"myDID": "did:example:adapter", "theirDID": "did:example:holder"}
+
+	t.Run("DIDComm V1", func(t *testing.T) {
+		app := newTestAdapterApp(t)
+		messenger := &testMessenger{}
+		app.agent = &didComm{Messenger: messenger}
+
+		stops := runTestActionWithProperties(t, app, service.DIDCommMsgMap{
+			"@id":     "request-1",
+			"@type":   issuecredential.RequestCredentialMsgTypeV2,
+			"~thread": map[string]interface{}{"thid": "thread-1"},
+		}, props)
+		require.Empty(t, stops)
+
+		require.Len(t, messenger.replies, 1)
+		require.Equal(t, "did:example:adapter", messenger.replies[0].myDID)
+		require.Equal(t, "did:example:holder", messenger.replies[0].theirDID)
+
+		reply := messenger.replies[0].msg
+		require.Equal(t, issuecredential.ProblemReportMsgTypeV2, reply.Type())
+		require.Equal(t, problemCodeUnknownSession, reply["description"].(map[string]interface{})["code"])
+		require.Contains(t, reply["description"].(map[string]interface{})["en"], "failed to get WACI issuance data")
+
+		redirect := reply["~web-redirect"].(*decorator.WebRedirect)
+		require.Equal(t, "FAIL", redirect.Status)
+		require.True(t, strings.HasPrefix(redirect.URL,
+			"https://adapter.example.com/issuer/waci-issuance/thread-1?code="+problemCodeUnknownSession))
+	})
+
+	t.Run("DIDComm V2", func(t *testing.T) {
+		app := newTestAdapterApp(t)
+		messenger := &testMessenger{}
+		app.agent = &didComm{Messenger: messenger}
+
+		stops := runTestActionWithProperties(t, app, service.DIDCommMsgMap{
+			"id":   "message-1",
+			"type": presentproofsvc.PresentationMsgTypeV3,
+			"thid": "thread-1",
+			"body": map[string]interface{}{},
+		}, props)
+		require.Empty(t, stops)
+
+		require.Len(t, messenger.replies, 1)
+
+		reply := messenger.replies[0].msg
+		require.Equal(t, presentproofsvc.ProblemReportMsgTypeV3, reply.Type())
+		require.Equal(t, problemCodeUnknownSession, reply["body"].(map[string]interface{})["code"])
+		require.Contains(t, reply["body"].(map[string]interface{})["comment"], "failed to get WACI share data")
+	})
+
+	t.Run("message of another protocol", func(t *testing.T) {
+		app := newTestAdapterApp(t)
+		messenger := &testMessenger{}
+		app.agent = &didComm{Messenger: messenger}
+
+		stops := runTestActionWithProperties(t, app, service.DIDCommMsgMap{
+			"@id":     "message-1",
+			"@type":   "https://didcomm.org/basicmessage/1.0/message",
+			"~thread": map[string]interface{}{"thid": "thread-1"},
+		}, props)
+		require.Len(t, stops, 1)
+		require.Empty(t, messenger.replies)
+	})
+
+	t.Run("no connection", func(t *testing.T) {
+		app := newTestAdapterApp(t)
+		messenger := &testMessenger{}
+		app.agent = &didComm{Messenger: messenger}
+
+		stops := runTestAction(t, app, service.DIDCommMsgMap{
+			"@id":     "request-1",
+			"@type":   issuecredential.RequestCredentialMsgTypeV2,
+			"~thread": map[string]interface{}{"thid": "thread-1"},
+		})
+		require.Len(t, stops, 1)
+		require.Empty(t, messenger.replies)
+	})
+}
+
+// runTestAction handles the action message and returns the problems it was stopped with, continuing the action
+// fails the test.
+func runTestAction(t *testing.T, app *adapterApp, msg service.DIDCommMsgMap) []*actionProblem {
+	t.Helper()
+
+	return runTestActionWithProperties(t, app, msg, nil)
+}
+
+func runTestActionWithProperties(t *testing.T, app *adapterApp, msg service.DIDCommMsgMap,
+	props service.EventProperties) []*actionProblem {
+	t.Helper()
+
+	var stops []*actionProblem
+
+	actionCh := make(chan service.DIDCommAction, 1)
+	actionCh <- service.DIDCommAction{
+		Message:    msg,
+		Properties: props,
+		Continue: func(args interface{}) {
+			t.Fatalf("action continued with %v", args)
+		},
+		Stop: func(err error) {
+			problem, ok := err.(*actionProblem)
+			require.True(t, ok)
+
+			stops = append(stops, problem)
+		},
+	}
+	close(actionCh)
+
+	app.listenForDIDCommMsg(actionCh)
+
+	return stops
+}
+
+func saveTestSession(t *testing.T, app *adapterApp, id, thID string) {
+	t.Helper()
+
+	require.NoError(t, saveSession(app.store, &sessionData{ID: id, Type: sessionTypeWACIIssuance,
+		Status: sessionStatusInProgress}))
+	app.setThreadSession(thID, id)
+}
+
+type testEventProperties map[string]interface{}
+
+func (p testEventProperties) All() map[string]interface{} {
+	return p
+}
+
+// testMessenger records replies, other messenger functions are not used by the adapter.
+type testMessenger struct {
+	service.Messenger
+	replies []*testReply
+}
+
+type testReply struct {
+	msg             service.DIDCommMsgMap
+	myDID, theirDID string
+}
+
+func (m *testMessenger) ReplyToMsg(_, out service.DIDCommMsgMap, myDID, theirDID string, _ ...service.Opt) error {
+	m.replies = append(m.replies, &testReply{msg: out, myDID: myDID, theirDID: theirDID})
+
+	return nil
+}
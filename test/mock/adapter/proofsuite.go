@@ -0,0 +1,190 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/hyperledger/aries-framework-go/pkg/doc/presexch"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/signer"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite/bbsblssignature2020"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite/ed25519signature2018"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite/ed25519signature2020"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite/jsonwebsignature2020"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+)
+
+// Linked data proof types.
+const (
+	ed25519Signature2018     = "Ed25519Signature2018"
+	ed25519Signature2020     = "Ed25519Signature2020"
+	jsonWebSignature2020     = "JsonWebSignature2020"
+	bbsBlsSignature2020      = "BbsBlsSignature2020"
+	bbsBlsSignatureProof2020 = "BbsBlsSignatureProof2020"
+)
+
+// proofRepresentationJWS is the form value selecting detached JWS linked data proofs.
+const proofRepresentationJWS = "jws"
+
+// suiteContexts are JSON-LD contexts signature suites need in signed documents.
+//
+//nolint:gochecknoglobals // translation table
+var suiteContexts = map[string]string{
+	ed25519Signature2020: "https://w3id.org/security/suites/ed25519-2020/v1",
+	jsonWebSignature2020: "https://w3id.org/security/suites/jws-2020/v1",
+	bbsBlsSignature2020:  "https://w3id.org/security/bbs/v1",
+}
+
+// supportedProofTypes are linked data proof types the adapter signs and accepts.
+//
+//nolint:gochecknoglobals // list of supported proof types
+var supportedProofTypes = []string{
+	ed25519Signature2018, ed25519Signature2020, jsonWebSignature2020, bbsBlsSignature2020, bbsBlsSignatureProof2020,
+}
+
+// supportedJWSAlgorithms are algorithms of JWT credentials and presentations the adapter signs and accepts.
+//
+//nolint:gochecknoglobals // list of supported algorithms
+var supportedJWSAlgorithms = []string{"EdDSA", "ES256", "ES384"}
+
+// proofFormat is format of linked data proofs chosen for an issuance session.
+type proofFormat struct {
+	SignatureType string `json:"signature_type"`
+	DetachedJWS   bool   `json:"detached_jws,omitempty"`
+}
+
+// signatureType returns type of linked data proofs made with keys of given type, nil format gives the default of
+// the key type.
+func (p *proofFormat) signatureType(keyType kms.KeyType) string {
+	if p == nil {
+		return linkedDataSignatureType(keyType)
+	}
+
+	return p.SignatureType
+}
+
+// newProofFormat creates proof format of given signature type and representation made with keys of given type.
+// Signature type defaults to the one of the key type, representation to proofValue.
+func newProofFormat(signatureType, representation string, keyType kms.KeyType) (*proofFormat, error) {
+	if signatureType == "" && representation == "" {
+		return nil, nil
+	}
+
+	if signatureType == "" {
+		signatureType = linkedDataSignatureType(keyType)
+	}
+
+	if !contains(keySignatureTypes(keyType), signatureType) {
+		return nil, fmt.Errorf("%s keys can not sign %s proofs", keyType, signatureType)
+	}
+
+	proof := &proofFormat{SignatureType: signatureType}
+
+	switch representation {
+	case "", "proofValue":
+	case proofRepresentationJWS:
+		if signatureType != ed25519Signature2018 && signatureType != jsonWebSignature2020 {
+			return nil, fmt.Errorf("%s proofs can not be detached JWS", signatureType)
+		}
+
+		proof.DetachedJWS = true
+	default:
+		return nil, fmt.Errorf("unsupported proof representation %s", representation)
+	}
+
+	return proof, nil
+}
+
+// sessionProofFormat reads proof format of an issuance session signing with given key from proofSuite and
+// proofRepresentation form values.
+func sessionProofFormat(r *http.Request, key *issuerKey) (*proofFormat, error) {
+	return newProofFormat(r.FormValue("proofSuite"), r.FormValue("proofRepresentation"), signingKeyType(key))
+}
+
+// linkedDataSignatureType returns type of linked data signatures made with keys of given type by default,
+// Ed25519Signature2018 for Ed25519 keys, BbsBlsSignature2020 for BLS12-381 G2 keys and JsonWebSignature2020 for
+// others.
+func linkedDataSignatureType(keyType kms.KeyType) string {
+	return keySignatureTypes(keyType)[0]
+}
+
+// keySignatureTypes returns types of linked data signatures keys of given type can make.
+func keySignatureTypes(keyType kms.KeyType) []string {
+	switch keyType { //nolint:exhaustive // other key types sign JsonWebSignature2020
+	case kms.ED25519Type:
+		return []string{ed25519Signature2018, ed25519Signature2020}
+	case kms.BLS12381G2Type:
+		return []string{bbsBlsSignature2020}
+	default:
+		return []string{jsonWebSignature2020}
+	}
+}
+
+func newSignatureSuite(signatureType string, s verifiable.Signer) signer.SignatureSuite {
+	switch signatureType {
+	case ed25519Signature2018:
+		return ed25519signature2018.New(suite.WithSigner(s))
+	case ed25519Signature2020:
+		return ed25519signature2020.New(suite.WithSigner(s))
+	case bbsBlsSignature2020:
+		return bbsblssignature2020.New(suite.WithSigner(s))
+	default:
+		return jsonwebsignature2020.New(suite.WithSigner(s))
+	}
+}
+
+// requestProofFormat makes presentation definition request credentials with proofs chosen by selectiveDisclosure and
+// proofSuite form values of a presentation request.
+func requestProofFormat(r *http.Request, pd *presexch.PresentationDefinition) error {
+	if r.FormValue("selectiveDisclosure") == "true" {
+		requestSelectiveDisclosure(pd)
+
+		return nil
+	}
+
+	proofType := r.FormValue("proofSuite")
+	if proofType == "" {
+		return nil
+	}
+
+	if !contains(supportedProofTypes, proofType) {
+		return fmt.Errorf("unsupported proof suite %s", proofType)
+	}
+
+	requestProofTypes(pd, proofType)
+
+	return nil
+}
+
+// requestProofTypes makes presentation definition request linked data credentials with proofs of given type.
+func requestProofTypes(pd *presexch.PresentationDefinition, proofType string) {
+	if pd.Format == nil {
+		pd.Format = &presexch.Format{}
+	}
+
+	// wallets select credentials by ldp_vp proof types.
+	pd.Format.LdpVP = &presexch.LdpType{ProofType: []string{proofType}}
+	pd.Format.LdpVC = &presexch.LdpType{ProofType: []string{proofType}}
+}
+
+// verifierFormats returns credential and presentation formats the verifier accepts for the presentation definition,
+// advertised to wallets in OIDC client metadata.
+func verifierFormats(pd *presexch.PresentationDefinition) *presexch.Format {
+	if pd != nil && pd.Format != nil {
+		return pd.Format
+	}
+
+	return &presexch.Format{
+		LdpVP: &presexch.LdpType{ProofType: supportedProofTypes},
+		LdpVC: &presexch.LdpType{ProofType: supportedProofTypes},
+		JwtVP: &presexch.JwtType{Alg: supportedJWSAlgorithms},
+		JwtVC: &presexch.JwtType{Alg: supportedJWSAlgorithms},
+	}
+}
@@ -0,0 +1,169 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/pkg/doc/presexch"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/key"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProofFormat(t *testing.T) {
+	tests := []struct {
+		name           string
+		signatureType  string
+		representation string
+		keyType        kms.KeyType
+		expected       *proofFormat
+		err            string
+	}{
+		{name: "default", keyType: kms.ED25519Type},
+		{
+			name: "JsonWebSignature2020 with Ed25519", signatureType: jsonWebSignature2020, keyType: kms.ED25519Type,
+			err: "can not sign",
+		},
+		{
+			name: "Ed25519Signature2020", signatureType: ed25519Signature2020, keyType: kms.ED25519Type,
+			expected: &proofFormat{SignatureType: ed25519Signature2020},
+		},
+		{
+			name: "detached JWS of key type default", representation: proofRepresentationJWS,
+			keyType:  kms.ECDSAP256TypeIEEEP1363,
+			expected: &proofFormat{SignatureType: jsonWebSignature2020, DetachedJWS: true},
+		},
+		{
+			name: "suite of other key type", signatureType: ed25519Signature2018, keyType: kms.ECDSAP256TypeIEEEP1363,
+			err: "can not sign",
+		},
+		{
+			name: "detached JWS of BBS+", representation: proofRepresentationJWS, keyType: kms.BLS12381G2Type,
+			err: "can not be detached JWS",
+		},
+		{
+			name: "unknown representation", representation: "multibase", keyType: kms.ED25519Type,
+			err: "unsupported proof representation",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			proof, err := newProofFormat(tc.signatureType, tc.representation, tc.keyType)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, proof)
+		})
+	}
+}
+
+func TestIssueCredential_ProofFormats(t *testing.T) {
+	app, _, _ := newTestIssuer(t, &issuerSettings{})
+	pv := newPresentationVerifier(vdr.New(vdr.WithVDR(key.New())), app.documentLoader)
+
+	p256Key, err := app.createIssuerKey("ecdsap256ieee1363", didMethodKey, "", "issuer-1")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		key   *issuerKey
+		proof *proofFormat
+	}{
+		{name: "Ed25519Signature2018 JWS", proof: &proofFormat{SignatureType: ed25519Signature2018, DetachedJWS: true}},
+		{name: "Ed25519Signature2020", proof: &proofFormat{SignatureType: ed25519Signature2020}},
+		{
+			name: "JsonWebSignature2020 with P-256", key: p256Key,
+			proof: &proofFormat{SignatureType: jsonWebSignature2020},
+		},
+		{
+			name: "JsonWebSignature2020 JWS with P-256", key: p256Key,
+			proof: &proofFormat{SignatureType: jsonWebSignature2020, DetachedJWS: true},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			credBytes, err := app.issueCredential("issuer-1", "VerifiableCredential", ldpVCFormat, didKey, "",
+				&issuerSettings{Key: tc.key, Proof: tc.proof})
+			require.NoError(t, err)
+
+			vc, err := verifiable.ParseCredential(credBytes, verifiable.WithJSONLDDocumentLoader(app.documentLoader),
+				verifiable.WithPublicKeyFetcher(verifiable.NewVDRKeyResolver(pv.vdr).PublicKeyFetcher()))
+			require.NoError(t, err)
+			require.Len(t, vc.Proofs, 1)
+			require.Equal(t, tc.proof.SignatureType, vc.Proofs[0]["type"])
+
+			if tc.proof.DetachedJWS {
+				require.NotEmpty(t, vc.Proofs[0]["jws"])
+			} else {
+				require.NotEmpty(t, vc.Proofs[0]["proofValue"])
+			}
+
+			vp, err := verifiable.NewPresentation(verifiable.WithCredentials(vc))
+			require.NoError(t, err)
+
+			require.NoError(t, pv.checkCredentialProofs(vp, supportedProofTypes))
+			require.Error(t, pv.checkCredentialProofs(vp, []string{bbsBlsSignatureProof2020}))
+		})
+	}
+}
+
+func TestRequestProofFormat(t *testing.T) {
+	newPresentationRequest := func(form url.Values) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/verifier/waci-share", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		return r
+	}
+
+	t.Run("any supported proof", func(t *testing.T) {
+		pd := &presexch.PresentationDefinition{ID: "pd-1"}
+
+		require.NoError(t, requestProofFormat(newPresentationRequest(url.Values{}), pd))
+		require.Nil(t, pd.Format)
+		require.Equal(t, supportedProofTypes, acceptedProofTypes(pd))
+		require.Equal(t, supportedJWSAlgorithms, verifierFormats(pd).JwtVP.Alg)
+	})
+
+	t.Run("proof suite", func(t *testing.T) {
+		pd := &presexch.PresentationDefinition{ID: "pd-1"}
+
+		require.NoError(t, requestProofFormat(newPresentationRequest(url.Values{
+			"proofSuite": {ed25519Signature2020},
+		}), pd))
+		require.Equal(t, []string{ed25519Signature2020}, acceptedProofTypes(pd))
+		require.Equal(t, pd.Format, verifierFormats(pd))
+	})
+
+	t.Run("selective disclosure", func(t *testing.T) {
+		pd := &presexch.PresentationDefinition{ID: "pd-1"}
+
+		require.NoError(t, requestProofFormat(newPresentationRequest(url.Values{
+			"selectiveDisclosure": {"true"},
+			"proofSuite":          {ed25519Signature2020},
+		}), pd))
+		require.Equal(t, []string{bbsBlsSignatureProof2020}, acceptedProofTypes(pd))
+	})
+
+	t.Run("unsupported proof suite", func(t *testing.T) {
+		require.Error(t, requestProofFormat(newPresentationRequest(url.Values{
+			"proofSuite": {"RsaSignature2018"},
+		}), &presexch.PresentationDefinition{ID: "pd-1"}))
+	})
+}
@@ -0,0 +1,360 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// session types of the control API.
+const (
+	sessionTypeWACIIssuance = "waci-issuance"
+	sessionTypeWACIShare    = "waci-share"
+	sessionTypeOIDCIssuance = "oidc-issuance"
+	sessionTypeOIDCShare    = "oidc-share"
+)
+
+// session statuses.
+const (
+	// sessionStatusCreated is the status of sessions the wallet did not interact with yet.
+	sessionStatusCreated = "created"
+	// sessionStatusInProgress is the status of sessions the wallet started, e.g. by accepting the invitation.
+	sessionStatusInProgress = "in-progress"
+	// sessionStatusCompleted is the status of sessions which issued a credential or received a valid presentation.
+	sessionStatusCompleted = "completed"
+	// sessionStatusFailed is the status of sessions which received a presentation failing verification, were stopped
+	// with a problem-report or received one from the wallet.
+	sessionStatusFailed = "failed"
+)
+
+// sessionData is state of a session of the mock issuer or verifier reported by the control API. Sessions are
+// identified by the invitation ID for WACI, the issuer ID for OIDC issuance and the state for OIDC share.
+type sessionData struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Status     string          `json:"status"`
+	URL        string          `json:"url"`
+	Invitation json.RawMessage `json:"invitation,omitempty"`
+	// Presentation and Verification are the presentation received by share sessions and the outcome of its checks.
+	Presentation json.RawMessage           `json:"presentation,omitempty"`
+	Verification *presentationVerification `json:"verification,omitempty"`
+	// Credentials are the credentials issued by issuance sessions.
+	Credentials []json.RawMessage `json:"credentials,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// sessionRequest is the request of the control API creating a session. Fields carry the same names as form values
+// of the issuer and verifier pages, JSON documents are sent as they are rather than as strings.
+type sessionRequest struct {
+	Type      string `json:"type"`
+	DIDCommV2 bool   `json:"didcommV2,omitempty"`
+
+	WalletURL             string `json:"walletURL,omitempty"`
+	WalletInitIssuanceURL string `json:"walletInitIssuanceURL,omitempty"`
+	WalletAuthURL         string `json:"walletAuthURL,omitempty"`
+
+	CredManifest json.RawMessage `json:"credManifest,omitempty"`
+	CredToIssue  json.RawMessage `json:"credToIssue,omitempty"`
+	CredsToIssue json.RawMessage `json:"credsToIssue,omitempty"`
+	PEx          json.RawMessage `json:"pEx,omitempty"`
+	RequestFirst bool            `json:"requestFirst,omitempty"`
+
+	CredentialTypes []string `json:"credentialTypes,omitempty"`
+	ManifestIDs     []string `json:"manifestIDs,omitempty"`
+	IssuerURL       string   `json:"issuerURL,omitempty"`
+	PreAuthorize    bool     `json:"preAuthorize,omitempty"`
+	UserPIN         string   `json:"userPIN,omitempty"`
+	DeferIssuance   bool     `json:"deferIssuance,omitempty"`
+	PendingCount    int      `json:"pendingCount,omitempty"`
+
+	IssuerKeyType       string `json:"issuerKeyType,omitempty"`
+	IssuerDIDMethod     string `json:"issuerDIDMethod,omitempty"`
+	ProofSuite          string `json:"proofSuite,omitempty"`
+	ProofRepresentation string `json:"proofRepresentation,omitempty"`
+	SelectiveDisclosure bool   `json:"selectiveDisclosure,omitempty"`
+	StatusPurpose       string `json:"statusPurpose,omitempty"`
+}
+
+// form returns the request as form values of the issuer and verifier pages.
+func (s *sessionRequest) form() url.Values {
+	form := url.Values{}
+
+	set := func(name, value string) {
+		if value != "" {
+			form.Set(name, value)
+		}
+	}
+
+	set("walletURL", s.WalletURL)
+	set("walletInitIssuanceURL", s.WalletInitIssuanceURL)
+	set("walletAuthURL", s.WalletAuthURL)
+	set("credManifest", string(s.CredManifest))
+	set("credToIssue", string(s.CredToIssue))
+	set("credsToIssue", string(s.CredsToIssue))
+	set("pEx", string(s.PEx))
+	set("requestFirst", strconv.FormatBool(s.RequestFirst))
+	set("credentialTypes", strings.Join(s.CredentialTypes, ","))
+	set("manifestIDs", strings.Join(s.ManifestIDs, ","))
+	set("issuerURL", s.IssuerURL)
+	set("preAuthorize", strconv.FormatBool(s.PreAuthorize))
+	set("userPIN", s.UserPIN)
+	set("deferIssuance", strconv.FormatBool(s.DeferIssuance))
+	set("pendingCount", strconv.Itoa(s.PendingCount))
+	set("issuerKeyType", s.IssuerKeyType)
+	set("issuerDIDMethod", s.IssuerDIDMethod)
+	set("proofSuite", s.ProofSuite)
+	set("proofRepresentation", s.ProofRepresentation)
+	set("selectiveDisclosure", strconv.FormatBool(s.SelectiveDisclosure))
+	set("statusPurpose", s.StatusPurpose)
+
+	return form
+}
+
+// createSession creates a session from the JSON request and returns it with the invitation or offer URL the wallet
+// is sent to.
+func (v *adapterApp) createSession(w http.ResponseWriter, r *http.Request) {
+	var req sessionRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		handleError(w, http.StatusBadRequest, fmt.Sprintf("failed to decode session request : %s", err))
+
+		return
+	}
+
+	// sessions are created by the same code as the forms of the issuer and verifier pages.
+	r.Form, r.PostForm = req.form(), url.Values{}
+
+	var session *sessionData
+
+	switch req.Type {
+	case sessionTypeWACIIssuance:
+		manifest, response, err := v.prepareWACIIssuance(r)
+		if err != nil {
+			handleError(w, http.StatusBadRequest, err.Error())
+
+			return
+		}
+
+		session = v.createWACIIssuanceSession(w, r, req.DIDCommV2, manifest, response)
+	case sessionTypeWACIShare:
+		session = v.createWACIShareSession(w, r, req.DIDCommV2)
+	case sessionTypeOIDCIssuance:
+		session = v.createOIDCIssuanceSession(w, r)
+	case sessionTypeOIDCShare:
+		session = v.createOIDCShareSession(w, r)
+	default:
+		handleError(w, http.StatusBadRequest, fmt.Sprintf("unsupported session type %q", req.Type))
+
+		return
+	}
+
+	if session == nil {
+		return
+	}
+
+	sendSession(w, http.StatusCreated, session)
+}
+
+// getSession returns status of the session and the presentation it received or credentials it issued.
+func (v *adapterApp) getSession(w http.ResponseWriter, r *http.Request) {
+	session, err := readSession(v.store, mux.Vars(r)["id"])
+	if errors.Is(err, storage.ErrDataNotFound) {
+		handleError(w, http.StatusNotFound, "unknown session")
+
+		return
+	} else if err != nil {
+		handleError(w, http.StatusInternalServerError, fmt.Sprintf("failed to read session : %s", err))
+
+		return
+	}
+
+	sendSession(w, http.StatusOK, session)
+}
+
+func sendSession(w http.ResponseWriter, status int, session *sessionData) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(session)
+	if err != nil {
+		logger.Errorf("failed to write session : %s", err)
+	}
+}
+
+// saveNewSession saves a session of given type which sends the wallet to given URL, errors are written to the
+// response.
+func (v *adapterApp) saveNewSession(w http.ResponseWriter, id, sessionType, sessionURL string,
+	invitation json.RawMessage) *sessionData {
+	now := time.Now()
+
+	session := &sessionData{
+		ID:         id,
+		Type:       sessionType,
+		Status:     sessionStatusCreated,
+		URL:        sessionURL,
+		Invitation: invitation,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	err := saveSession(v.store, session)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, fmt.Sprintf("failed to save session : %s", err))
+
+		return nil
+	}
+
+	v.publishEvent(&adapterEvent{Type: eventInvitationCreated, SessionID: id, Data: map[string]string{"url": sessionURL}})
+
+	return session
+}
+
+// updateSession applies the update to the session with given ID. Interactions not started as a session are
+// ignored, failures are only logged since they do not affect the interaction itself.
+func (v *adapterApp) updateSession(id string, update func(session *sessionData)) {
+	if id == "" {
+		return
+	}
+
+	v.sessionMutex.Lock()
+	defer v.sessionMutex.Unlock()
+
+	session, err := readSession(v.store, id)
+	if errors.Is(err, storage.ErrDataNotFound) {
+		return
+	} else if err != nil {
+		logger.Errorf("failed to read session %s : %s", id, err)
+
+		return
+	}
+
+	update(session)
+	session.UpdatedAt = time.Now()
+
+	err = saveSession(v.store, session)
+	if err != nil {
+		logger.Errorf("failed to save session %s : %s", id, err)
+	}
+}
+
+// startSession sets the session with given ID in progress, it returns false if the session was already started or
+// is unknown.
+func (v *adapterApp) startSession(id string) bool {
+	v.sessionMutex.Lock()
+	defer v.sessionMutex.Unlock()
+
+	session, err := readSession(v.store, id)
+	if err != nil || session.Status != sessionStatusCreated {
+		return false
+	}
+
+	session.Status = sessionStatusInProgress
+	session.UpdatedAt = time.Now()
+
+	err = saveSession(v.store, session)
+	if err != nil {
+		logger.Errorf("failed to save session %s : %s", id, err)
+
+		return false
+	}
+
+	return true
+}
+
+// setSessionStatus sets status of the session with given ID.
+func (v *adapterApp) setSessionStatus(id, status string) {
+	v.updateSession(id, func(session *sessionData) {
+		session.Status = status
+	})
+}
+
+// failSession fails the session with given ID with given error.
+func (v *adapterApp) failSession(id, errMsg string) {
+	v.updateSession(id, func(session *sessionData) {
+		session.Status = sessionStatusFailed
+		session.Error = errMsg
+	})
+}
+
+// setSessionPresentation completes the share session with given ID with the received presentation.
+func (v *adapterApp) setSessionPresentation(id string, presentation json.RawMessage,
+	verification *presentationVerification) {
+	v.updateSession(id, func(session *sessionData) {
+		session.Presentation = presentation
+		session.Verification = verification
+		session.Status = sessionStatusCompleted
+
+		if !verification.Verified() {
+			session.Status = sessionStatusFailed
+			session.Error = verification.Error()
+		}
+	})
+}
+
+// addSessionCredential adds credential issued by the issuance session with given ID.
+func (v *adapterApp) addSessionCredential(id string, credential json.RawMessage) {
+	v.updateSession(id, func(session *sessionData) {
+		session.Credentials = append(session.Credentials, credential)
+		session.Status = sessionStatusCompleted
+	})
+}
+
+// rawPresentation returns presentation received as text, JWT presentations are kept as JSON strings.
+func rawPresentation(presentation []byte) json.RawMessage {
+	if json.Valid(presentation) {
+		return presentation
+	}
+
+	raw, err := json.Marshal(string(presentation))
+	if err != nil {
+		return nil
+	}
+
+	return raw
+}
+
+func saveSession(store storage.Store, session *sessionData) error {
+	sessionBytes, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	return putWithLifetime(store, getSessionKeyPrefix(session.ID), sessionBytes, sessionLifetime)
+}
+
+func readSession(store storage.Store, id string) (*sessionData, error) {
+	sessionBytes, err := store.Get(getSessionKeyPrefix(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var session sessionData
+
+	err = json.Unmarshal(sessionBytes, &session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func getSessionKeyPrefix(id string) string {
+	return fmt.Sprintf("session_%s", id)
+}
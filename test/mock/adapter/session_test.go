@@ -0,0 +1,167 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/key"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionAPI_OIDCIssuance(t *testing.T) {
+	app := newTestAdapterApp(t)
+	app.documentLoader = testDocumentLoader(t)
+	app.presVerifier = newPresentationVerifier(vdr.New(vdr.WithVDR(key.New())), app.documentLoader)
+
+	rr := postSessionRequest(t, app, &sessionRequest{
+		Type:                  sessionTypeOIDCIssuance,
+		WalletInitIssuanceURL: "https://wallet.example.com/initiate",
+		IssuerURL:             "https://issuer.example.com",
+		CredentialTypes:       []string{"VerifiableCredential"},
+		CredManifest:          []byte(`[]`),
+		CredsToIssue:          []byte(`{"VerifiableCredential": ` + testCredential + `}`),
+		PreAuthorize:          true,
+	})
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	var session sessionData
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &session))
+	require.Equal(t, sessionTypeOIDCIssuance, session.Type)
+	require.Equal(t, sessionStatusCreated, session.Status)
+
+	offer, err := url.Parse(session.URL)
+	require.NoError(t, err)
+	require.Equal(t, "https://issuer.example.com/"+session.ID, offer.Query().Get("issuer"))
+	require.Equal(t, "false", offer.Query().Get("user_pin_required"))
+
+	rr = postTokenRequest(app, session.ID, url.Values{"grant_type": {preAuthorizedCodeGrantType},
+		"pre-authorized_code": {offer.Query().Get("pre-authorized_code")}})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Equal(t, sessionStatusInProgress, getTestSession(t, app, session.ID).Status)
+
+	var tokenResp map[string]interface{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tokenResp))
+
+	rr = postCredentialRequest(t, app, session.ID, tokenResp["access_token"].(string),
+		createTestProof(t, "https://issuer.example.com/"+session.ID, tokenResp["c_nonce"].(string)))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	issued := getTestSession(t, app, session.ID)
+	require.Equal(t, sessionStatusCompleted, issued.Status)
+	require.Len(t, issued.Credentials, 1)
+	require.Contains(t, string(issued.Credentials[0]), didKey)
+}
+
+func TestSessionAPI_OIDCShare(t *testing.T) {
+	app := newTestAdapterApp(t)
+
+	rr := postSessionRequest(t, app, &sessionRequest{
+		Type:          sessionTypeOIDCShare,
+		WalletAuthURL: "https://wallet.example.com/auth",
+		PEx:           []byte(`{"id":"pd","input_descriptors":[{"id":"in"}]}`),
+		ProofSuite:    ed25519Signature2018,
+	})
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	var session sessionData
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &session))
+	require.Equal(t, sessionStatusCreated, session.Status)
+	require.True(t, strings.HasPrefix(session.URL, "https://wallet.example.com/auth?"))
+
+	authRequest, err := url.Parse(session.URL)
+	require.NoError(t, err)
+	require.Equal(t, session.ID, authRequest.Query().Get("state"))
+	require.Contains(t, authRequest.Query().Get("claims"), ed25519Signature2018)
+
+	verification := &presentationVerification{}
+	verification.add(presentationProofCheck, errors.New("invalid proof"))
+
+	app.setSessionPresentation(session.ID, rawPresentation([]byte("eyJhbGciOiJFZERTQSJ9.e30.sig")), verification)
+
+	failed := getTestSession(t, app, session.ID)
+	require.Equal(t, sessionStatusFailed, failed.Status)
+	require.Equal(t, `"eyJhbGciOiJFZERTQSJ9.e30.sig"`, string(failed.Presentation))
+	require.Contains(t, failed.Error, "invalid proof")
+}
+
+func TestSessionAPI_Errors(t *testing.T) {
+	app := newTestAdapterApp(t)
+
+	t.Run("invalid request", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		app.createSession(rr, httptest.NewRequest(http.MethodPost, "/api/sessions", strings.NewReader("{")))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("unsupported session type", func(t *testing.T) {
+		rr := postSessionRequest(t, app, &sessionRequest{Type: "chapi"})
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "unsupported session type")
+	})
+
+	t.Run("invalid proof format", func(t *testing.T) {
+		rr := postSessionRequest(t, app, &sessionRequest{
+			Type:       sessionTypeOIDCShare,
+			PEx:        []byte(`{"id":"pd","input_descriptors":[{"id":"in"}]}`),
+			ProofSuite: "RsaSignature2018",
+		})
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("unknown session", func(t *testing.T) {
+		r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/sessions/unknown", nil),
+			map[string]string{"id": "unknown"})
+
+		rr := httptest.NewRecorder()
+		app.getSession(rr, r)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("interactions without session are not tracked", func(t *testing.T) {
+		app.addSessionCredential("unknown", []byte(`{}`))
+
+		_, err := readSession(app.store, "unknown")
+		require.Error(t, err)
+	})
+}
+
+func postSessionRequest(t *testing.T, app *adapterApp, req *sessionRequest) *httptest.ResponseRecorder {
+	t.Helper()
+
+	reqBytes, err := json.Marshal(req)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	app.createSession(rr, httptest.NewRequest(http.MethodPost, "/api/sessions", bytes.NewReader(reqBytes)))
+
+	return rr
+}
+
+func getTestSession(t *testing.T, app *adapterApp, id string) *sessionData {
+	t.Helper()
+
+	r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/sessions/"+id, nil), map[string]string{"id": id})
+
+	rr := httptest.NewRecorder()
+	app.getSession(rr, r)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var session sessionData
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &session))
+
+	return &session
+}
@@ -0,0 +1,465 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/util"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// StatusList2021 credential status, https://w3c-ccg.github.io/vc-status-list-2021/.
+const (
+	statusList2021Context        = "https://w3id.org/vc/status-list/2021/v1"
+	statusList2021EntryType      = "StatusList2021Entry"
+	statusList2021Type           = "StatusList2021"
+	statusList2021CredentialType = "StatusList2021Credential"
+
+	statusPurposeRevocation = "revocation"
+	statusPurposeSuspension = "suspension"
+
+	// statusListSize is the number of credentials a status list holds, the minimum size the specification recommends
+	// for herd privacy.
+	statusListSize = 131072
+)
+
+// credential statuses set through the admin API.
+const (
+	credentialStatusActive    = "active"
+	credentialStatusRevoked   = "revoked"
+	credentialStatusSuspended = "suspended"
+)
+
+// statusList is the bitstring of statuses of credentials issued with the same key for the same status purpose.
+type statusList struct {
+	ID      string `json:"id"`
+	URL     string `json:"url"`
+	Purpose string `json:"purpose"`
+	// IssuerKey signs the status list credential, nil for the built-in did:key.
+	IssuerKey *issuerKey `json:"issuer_key,omitempty"`
+	Bits      []byte     `json:"bits"`
+	// Next is the index allocated to the next issued credential.
+	Next int `json:"next"`
+}
+
+// credentialStatusEntry locates the status of an issued credential.
+type credentialStatusEntry struct {
+	ListID string `json:"list_id"`
+	Index  int    `json:"index"`
+}
+
+// credentialStatusRequest is the request of the admin API changing status of issued credentials.
+type credentialStatusRequest struct {
+	CredentialID string `json:"credential_id"`
+	Status       string `json:"status"`
+}
+
+// sessionStatusPurpose returns purpose of status list entries of credentials issued in the session, credentials are
+// revocable by default.
+func sessionStatusPurpose(r *http.Request) (string, error) {
+	switch purpose := r.FormValue("statusPurpose"); purpose {
+	case "":
+		return statusPurposeRevocation, nil
+	case statusPurposeRevocation, statusPurposeSuspension:
+		return purpose, nil
+	default:
+		return "", fmt.Errorf("unsupported status purpose %s", purpose)
+	}
+}
+
+// addCredentialStatus allocates an entry for the credential in the status list of the issuer key and sets it as
+// credentialStatus. Statuses are managed by credential ID, credentials without an ID or with the ID of an already
+// issued credential are given a random one.
+func (v *adapterApp) addCredentialStatus(vc *verifiable.Credential, key *issuerKey, purpose string) error {
+	if purpose == "" {
+		purpose = statusPurposeRevocation
+	}
+
+	v.statusListMutex.Lock()
+	defer v.statusListMutex.Unlock()
+
+	_, err := readCredentialStatusEntry(v.store, vc.ID)
+	if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		return fmt.Errorf("failed to get credential status : %w", err)
+	}
+
+	if vc.ID == "" || err == nil {
+		vc.ID = "urn:uuid:" + uuid.NewString()
+	}
+
+	list, err := v.issuerStatusList(key, purpose)
+	if err != nil {
+		return fmt.Errorf("failed to get status list : %w", err)
+	}
+
+	index := list.Next
+	list.Next++
+
+	err = saveStatusList(v.store, list)
+	if err != nil {
+		return fmt.Errorf("failed to save status list : %w", err)
+	}
+
+	err = saveCredentialStatusEntry(v.store, vc.ID, &credentialStatusEntry{ListID: list.ID, Index: index})
+	if err != nil {
+		return fmt.Errorf("failed to save credential status : %w", err)
+	}
+
+	if !contains(vc.Context, statusList2021Context) {
+		vc.Context = append(vc.Context, statusList2021Context)
+	}
+
+	vc.Status = &verifiable.TypedID{
+		ID:   fmt.Sprintf("%s#%d", list.URL, index),
+		Type: statusList2021EntryType,
+		CustomFields: verifiable.CustomFields{
+			"statusPurpose":        purpose,
+			"statusListIndex":      strconv.Itoa(index),
+			"statusListCredential": list.URL,
+		},
+	}
+
+	return nil
+}
+
+// issuerStatusList returns status list of the issuer key with free entries, a new list is started when the current
+// one is full.
+func (v *adapterApp) issuerStatusList(key *issuerKey, purpose string) (*statusList, error) {
+	issuerDID := didKey
+	if key != nil {
+		issuerDID = key.DID
+	}
+
+	issuerListKey := getIssuerStatusListKeyPrefix(issuerDID + "_" + purpose)
+
+	listID, err := v.store.Get(issuerListKey)
+	if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		return nil, err
+	}
+
+	if err == nil {
+		list, e := readStatusList(v.store, string(listID))
+		if e != nil {
+			return nil, e
+		}
+
+		if list.Next < statusListSize {
+			return list, nil
+		}
+	}
+
+	list := &statusList{
+		ID:        uuid.NewString(),
+		Purpose:   purpose,
+		IssuerKey: key,
+		Bits:      make([]byte, statusListSize/8),
+	}
+	list.URL = os.Getenv(demoExternalURLEnvKey) + "/status/" + list.ID
+
+	err = v.store.Put(issuerListKey, []byte(list.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// statusListCredential serves signed status list credentials.
+func (v *adapterApp) statusListCredential(w http.ResponseWriter, r *http.Request) {
+	list, err := readStatusList(v.store, mux.Vars(r)["id"])
+	if errors.Is(err, storage.ErrDataNotFound) {
+		handleError(w, http.StatusNotFound, "status list not found")
+
+		return
+	}
+
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, fmt.Sprintf("failed to get status list : %s", err))
+
+		return
+	}
+
+	vc, err := v.newStatusListCredential(list)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, fmt.Sprintf("failed to create status list credential : %s",
+			err))
+
+		return
+	}
+
+	vcBytes, err := vc.MarshalJSON()
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, fmt.Sprintf("failed to write status list credential : %s",
+			err))
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(vcBytes)
+}
+
+// newStatusListCredential creates StatusList2021Credential of the list signed with the key of the list.
+func (v *adapterApp) newStatusListCredential(list *statusList) (*verifiable.Credential, error) {
+	encodedList, err := encodeStatusList(list.Bits)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := v.issuerSigner(list.IssuerKey, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	vc := &verifiable.Credential{
+		Context: []string{"https://www.w3.org/2018/credentials/v1", statusList2021Context},
+		ID:      list.URL,
+		Types:   []string{"VerifiableCredential", statusList2021CredentialType},
+		Issued:  util.NewTime(time.Now()),
+		Subject: verifiable.Subject{
+			ID: list.URL + "#list",
+			CustomFields: verifiable.CustomFields{
+				"type":          statusList2021Type,
+				"statusPurpose": list.Purpose,
+				"encodedList":   encodedList,
+			},
+		},
+	}
+
+	signer.setIssuer(vc)
+
+	err = signCredential(vc, signer, v.documentLoader)
+	if err != nil {
+		return nil, err
+	}
+
+	return vc, nil
+}
+
+// updateCredentialStatus is the admin API revoking, suspending and reinstating issued credentials by ID.
+func (v *adapterApp) updateCredentialStatus(w http.ResponseWriter, r *http.Request) {
+	if v.adminToken != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(v.adminToken)) != 1 {
+			handleError(w, http.StatusUnauthorized, "invalid admin token")
+
+			return
+		}
+	}
+
+	var req credentialStatusRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		handleError(w, http.StatusBadRequest, fmt.Sprintf("failed to parse request : %s", err))
+
+		return
+	}
+
+	v.statusListMutex.Lock()
+	defer v.statusListMutex.Unlock()
+
+	entry, err := readCredentialStatusEntry(v.store, req.CredentialID)
+	if errors.Is(err, storage.ErrDataNotFound) {
+		handleError(w, http.StatusNotFound, fmt.Sprintf("credential %s not found", req.CredentialID))
+
+		return
+	}
+
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, fmt.Sprintf("failed to get credential status : %s", err))
+
+		return
+	}
+
+	list, err := readStatusList(v.store, entry.ListID)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, fmt.Sprintf("failed to get status list : %s", err))
+
+		return
+	}
+
+	err = setCredentialStatus(list, entry.Index, req.Status)
+	if err != nil {
+		handleError(w, http.StatusBadRequest, fmt.Sprintf("failed to update credential %s : %s",
+			req.CredentialID, err))
+
+		return
+	}
+
+	err = saveStatusList(v.store, list)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, fmt.Sprintf("failed to save status list : %s", err))
+
+		return
+	}
+
+	logger.Infof("credential status updated : id=%s status=%s", req.CredentialID, req.Status)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&req) //nolint:errcheck,gosec // response of already applied update
+}
+
+// setCredentialStatus sets bit of the credential in the list, revocation is permanent and only credentials of
+// suspension lists can be suspended and reinstated.
+func setCredentialStatus(list *statusList, index int, status string) error {
+	switch {
+	case status == credentialStatusRevoked && list.Purpose == statusPurposeRevocation,
+		status == credentialStatusSuspended && list.Purpose == statusPurposeSuspension:
+		setStatusBit(list.Bits, index, true)
+	case status == credentialStatusActive && list.Purpose == statusPurposeSuspension:
+		setStatusBit(list.Bits, index, false)
+	case status == credentialStatusActive && list.Purpose == statusPurposeRevocation:
+		if statusBit(list.Bits, index) {
+			return errors.New("revoked credentials can not be reinstated")
+		}
+	case status == credentialStatusRevoked, status == credentialStatusSuspended:
+		return fmt.Errorf("credential has %s status, it can not be %s", list.Purpose, status)
+	default:
+		return fmt.Errorf("unsupported status %q", status)
+	}
+
+	return nil
+}
+
+// statusBit returns bit of the credential with given index, the first index is the most significant bit of the
+// first byte.
+func statusBit(bits []byte, index int) bool {
+	return bits[index/8]&(1<<(7-index%8)) != 0
+}
+
+func setStatusBit(bits []byte, index int, value bool) {
+	if value {
+		bits[index/8] |= 1 << (7 - index%8)
+	} else {
+		bits[index/8] &^= 1 << (7 - index%8)
+	}
+}
+
+// encodeStatusList compresses the bitstring with GZIP and encodes it as base64url.
+func encodeStatusList(bits []byte) (string, error) {
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+
+	_, err := zw.Write(bits)
+	if err != nil {
+		return "", fmt.Errorf("failed to compress status list : %w", err)
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to compress status list : %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// decodeStatusList decodes encodedList of status list credentials, padded base64 of other issuers is accepted too.
+func decodeStatusList(encodedList string) ([]byte, error) {
+	compressed, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encodedList, "="))
+	if err != nil {
+		compressed, err = base64.StdEncoding.DecodeString(encodedList)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode status list : %w", err)
+		}
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress status list : %w", err)
+	}
+
+	bits, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress status list : %w", err)
+	}
+
+	return bits, nil
+}
+
+// saveStatusList saves the status list, lists never expire as verifiers check the status of issued credentials for
+// as long as the credentials are valid.
+func saveStatusList(store storage.Store, list *statusList) error {
+	listBytes, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+
+	return store.Put(getStatusListKeyPrefix(list.ID), listBytes)
+}
+
+func readStatusList(store storage.Store, id string) (*statusList, error) {
+	listBytes, err := store.Get(getStatusListKeyPrefix(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var list statusList
+
+	err = json.Unmarshal(listBytes, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// saveCredentialStatusEntry saves the status list entry of an issued credential, entries are kept with their lists
+// so that the status of the credential can be updated for as long as it is valid.
+func saveCredentialStatusEntry(store storage.Store, credentialID string, entry *credentialStatusEntry) error {
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return store.Put(getCredentialStatusKeyPrefix(credentialID), entryBytes)
+}
+
+func readCredentialStatusEntry(store storage.Store, credentialID string) (*credentialStatusEntry, error) {
+	entryBytes, err := store.Get(getCredentialStatusKeyPrefix(credentialID))
+	if err != nil {
+		return nil, err
+	}
+
+	var entry credentialStatusEntry
+
+	err = json.Unmarshal(entryBytes, &entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func getStatusListKeyPrefix(key string) string {
+	return fmt.Sprintf("status_list_%s", key)
+}
+
+func getIssuerStatusListKeyPrefix(key string) string {
+	return fmt.Sprintf("issuer_status_list_%s", key)
+}
+
+func getCredentialStatusKeyPrefix(key string) string {
+	return fmt.Sprintf("credential_status_%s", key)
+}
@@ -0,0 +1,171 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialStatus(t *testing.T) {
+	app, _, _ := newTestIssuer(t, &issuerSettings{})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/status/{id}", app.statusListCredential).Methods(http.MethodGet)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	t.Setenv(demoExternalURLEnvKey, server.URL)
+
+	issue := func(t *testing.T, format, purpose string) (*verifiable.Presentation, *verifiable.Credential) {
+		t.Helper()
+
+		credBytes, err := app.issueCredential("issuer-1", "VerifiableCredential", format, didKey, "",
+			&issuerSettings{StatusPurpose: purpose})
+		require.NoError(t, err)
+
+		opt := verifiable.WithJSONLDDocumentLoader(app.documentLoader)
+
+		var jws string
+		if json.Unmarshal(credBytes, &jws) == nil {
+			vc, e := verifiable.ParseCredential([]byte(jws), verifiable.WithDisabledProofCheck(), opt)
+			require.NoError(t, e)
+
+			vp, e := verifiable.NewPresentation(verifiable.WithJWTCredentials(jws))
+			require.NoError(t, e)
+
+			return vp, vc
+		}
+
+		vc, err := verifiable.ParseCredential(credBytes, verifiable.WithDisabledProofCheck(), opt)
+		require.NoError(t, err)
+
+		vp, err := verifiable.NewPresentation(verifiable.WithCredentials(vc))
+		require.NoError(t, err)
+
+		return vp, vc
+	}
+
+	t.Run("revocation", func(t *testing.T) {
+		vp, vc := issue(t, ldpVCFormat, "")
+		require.NoError(t, app.presVerifier.checkCredentialStatuses(vp))
+		require.Contains(t, vc.Context, statusList2021Context)
+		require.Equal(t, statusList2021EntryType, vc.Status.Type)
+		require.Equal(t, statusPurposeRevocation, vc.Status.CustomFields["statusPurpose"])
+		require.Contains(t, vc.Status.CustomFields["statusListCredential"], server.URL+"/status/")
+
+		rr := postCredentialStatus(app, "", vc.ID, credentialStatusSuspended)
+		require.Equal(t, http.StatusBadRequest, rr.Code, rr.Body.String())
+
+		rr = postCredentialStatus(app, "", vc.ID, credentialStatusRevoked)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.ErrorContains(t, app.presVerifier.checkCredentialStatuses(vp), "is revoked")
+
+		rr = postCredentialStatus(app, "", vc.ID, credentialStatusActive)
+		require.Equal(t, http.StatusBadRequest, rr.Code, rr.Body.String())
+		require.Contains(t, rr.Body.String(), "can not be reinstated")
+	})
+
+	t.Run("suspension of JWT credential", func(t *testing.T) {
+		vp, vc := issue(t, jwtVCJSONFormat, statusPurposeSuspension)
+		require.NoError(t, app.presVerifier.checkCredentialStatuses(vp))
+		require.NotEqual(t, "http://example.gov/credentials/3732", vc.ID)
+
+		rr := postCredentialStatus(app, "", vc.ID, credentialStatusSuspended)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.ErrorContains(t, app.presVerifier.checkCredentialStatuses(vp), "is suspended")
+
+		rr = postCredentialStatus(app, "", vc.ID, credentialStatusActive)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.NoError(t, app.presVerifier.checkCredentialStatuses(vp))
+	})
+
+	t.Run("admin API errors", func(t *testing.T) {
+		_, vc := issue(t, ldpVCFormat, "")
+
+		rr := postCredentialStatus(app, "", "urn:uuid:unknown", credentialStatusRevoked)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+
+		rr = postCredentialStatus(app, "", vc.ID, "deleted")
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+
+		app.adminToken = "secret"
+		defer func() { app.adminToken = "" }()
+
+		rr = postCredentialStatus(app, "", vc.ID, credentialStatusRevoked)
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		rr = postCredentialStatus(app, "secret", "urn:uuid:unknown", credentialStatusRevoked)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("template of another issuer", func(t *testing.T) {
+		require.NoError(t, app.store.Put(getCredStoreKeyPrefix("issuer-1", "VerifiableCredential"),
+			[]byte(strings.Replace(testCredential, didKey, "did:example:b34ca6cd37bbf23", 1))))
+
+		for _, format := range []string{ldpVCFormat, jwtVCJSONFormat} {
+			vp, vc := issue(t, format, "")
+			require.Equal(t, didKey, vc.Issuer.ID)
+			require.NoError(t, app.presVerifier.checkCredentialStatuses(vp))
+
+			rr := postCredentialStatus(app, "", vc.ID, credentialStatusRevoked)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+			require.ErrorContains(t, app.presVerifier.checkCredentialStatuses(vp), "is revoked")
+		}
+	})
+
+	t.Run("unknown status list", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/status/unknown") //nolint:noctx // test server
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestStatusListEncoding(t *testing.T) {
+	bits := make([]byte, statusListSize/8)
+	setStatusBit(bits, 0, true)
+	setStatusBit(bits, 9, true)
+	setStatusBit(bits, statusListSize-1, true)
+	setStatusBit(bits, 9, false)
+
+	encodedList, err := encodeStatusList(bits)
+	require.NoError(t, err)
+
+	decoded, err := decodeStatusList(encodedList)
+	require.NoError(t, err)
+	require.Equal(t, bits, decoded)
+	require.Equal(t, byte(0x80), decoded[0])
+	require.True(t, statusBit(decoded, statusListSize-1))
+	require.False(t, statusBit(decoded, 9))
+
+	_, err = decodeStatusList("not a list")
+	require.Error(t, err)
+}
+
+func postCredentialStatus(app *adapterApp, token, credentialID, status string) *httptest.ResponseRecorder {
+	reqBytes, _ := json.Marshal(&credentialStatusRequest{CredentialID: credentialID, Status: status}) //nolint:errcheck
+
+	r := httptest.NewRequest(http.MethodPost, "/admin/credential-status", bytes.NewReader(reqBytes))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rr := httptest.NewRecorder()
+	app.updateCredentialStatus(rr, r)
+
+	return rr
+}
@@ -0,0 +1,44 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/aries-framework-go-ext/component/storage/mysql"
+	"github.com/hyperledger/aries-framework-go/component/storage/leveldb"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// storage types of the agent and the adapter.
+const (
+	storageTypeMem     = "mem"
+	storageTypeLevelDB = "leveldb"
+	storageTypeMySQL   = "mysql"
+)
+
+// createStoreProvider creates storage provider of given type. Stores of leveldb providers are kept in databases at
+// storageURL suffixed with the store name, mysql providers connect to the DSN in storageURL and create databases
+// prefixed with dbPrefix.
+func createStoreProvider(storageType, storageURL, dbPrefix string) (storage.Provider, error) {
+	switch storageType {
+	case "", storageTypeMem:
+		return mem.NewProvider(), nil
+	case storageTypeLevelDB:
+		if storageURL == "" {
+			return nil, errors.New("path of the leveldb databases is required")
+		}
+
+		return leveldb.NewProvider(storageURL), nil
+	case storageTypeMySQL:
+		return mysql.NewProvider(storageURL, mysql.WithDBPrefix(dbPrefix))
+	default:
+		return nil, fmt.Errorf("unsupported storage type %s", storageType)
+	}
+}
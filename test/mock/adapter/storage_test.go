@@ -0,0 +1,136 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/did"
+	vdrapi "github.com/hyperledger/aries-framework-go/pkg/framework/aries/api/vdr"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	mockvdr "github.com/hyperledger/aries-framework-go/pkg/mock/vdr"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateStoreProvider(t *testing.T) {
+	provider, err := createStoreProvider("", "", "")
+	require.NoError(t, err)
+	require.IsType(t, &mem.Provider{}, provider)
+
+	_, err = createStoreProvider(storageTypeLevelDB, "", "")
+	require.ErrorContains(t, err, "path of the leveldb databases is required")
+
+	_, err = createStoreProvider("couchdb", "", "")
+	require.ErrorContains(t, err, "unsupported storage type")
+}
+
+func TestLevelDBProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "adapter")
+
+	provider, err := createStoreProvider(storageTypeLevelDB, path, "")
+	require.NoError(t, err)
+
+	store, err := provider.OpenStore("Verifier")
+	require.NoError(t, err)
+
+	require.NoError(t, store.Put("k1", []byte("v1"), storage.Tag{Name: "session", Value: "s1"}))
+	require.NoError(t, store.Put("k2", []byte("v2")))
+	require.NoError(t, store.Batch([]storage.Operation{
+		{Key: "k3", Value: []byte("v3"), Tags: []storage.Tag{{Name: "session", Value: "s1"}}},
+		{Key: "k2"},
+	}))
+	require.NoError(t, store.Delete("k1"))
+	require.NoError(t, putWithLifetime(store, "expired", []byte("v4"), -time.Minute))
+	require.NoError(t, provider.Close())
+
+	// data and tags survive reopening the databases.
+	provider, err = createStoreProvider(storageTypeLevelDB, path, "")
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, provider.Close()) }()
+
+	store, err = provider.OpenStore("verifier")
+	require.NoError(t, err)
+
+	value, err := store.Get("k3")
+	require.NoError(t, err)
+	require.Equal(t, []byte("v3"), value)
+
+	_, err = store.Get("k1")
+	require.ErrorIs(t, err, storage.ErrDataNotFound)
+
+	_, err = store.Get("k2")
+	require.ErrorIs(t, err, storage.ErrDataNotFound)
+
+	iter, err := store.Query("session:s1")
+	require.NoError(t, err)
+
+	ok, err := iter.Next()
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	key, err := iter.Key()
+	require.NoError(t, err)
+	require.Equal(t, "k3", key)
+	require.NoError(t, iter.Close())
+
+	// records that expired while the adapter was down are swept.
+	swept, err := sweepExpiredRecords(store, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 1, swept)
+
+	_, err = store.Get("expired")
+	require.ErrorIs(t, err, storage.ErrDataNotFound)
+}
+
+func TestAgentPublicDIDV2(t *testing.T) {
+	app := newTestAdapterApp(t)
+
+	var created int
+
+	vdri := &mockvdr.MockVDR{
+		CreateFunc: func(doc *did.Doc, _ ...vdrapi.DIDMethodOption) (*did.DocResolution, error) {
+			created++
+
+			return &did.DocResolution{DIDDocument: &did.Doc{ID: "did:orb:test"}}, nil
+		},
+	}
+
+	orbDID, err := agentPublicDIDV2(app.store, vdri, app.kms, kms.ECDSAP256TypeIEEEP1363, kms.NISTP256ECDHKWType)
+	require.NoError(t, err)
+	require.Equal(t, "did:orb:test", orbDID.DID)
+	require.Equal(t, "did:orb:test", orbDID.IssuerKey.DID)
+
+	// a restarted agent comes back with the saved DID.
+	saved, err := agentPublicDIDV2(app.store, vdri, app.kms, kms.ECDSAP256TypeIEEEP1363, kms.NISTP256ECDHKWType)
+	require.NoError(t, err)
+	require.Equal(t, 1, created)
+	require.Equal(t, orbDID, saved)
+}
+
+func TestStartupIssuerKey(t *testing.T) {
+	app := newTestAdapterApp(t)
+
+	key, err := app.startupIssuerKey("ecdsap256ieee1363", didMethodWeb, "https://adapter.example.com")
+	require.NoError(t, err)
+
+	saved, err := app.startupIssuerKey("ecdsap256ieee1363", didMethodWeb, "https://adapter.example.com")
+	require.NoError(t, err)
+	require.Equal(t, key, saved)
+
+	other, err := app.startupIssuerKey("ed25519", didMethodWeb, "https://adapter.example.com")
+	require.NoError(t, err)
+	require.NotEqual(t, key.KMSKeyID, other.KMSKeyID)
+
+	builtIn, err := app.startupIssuerKey("", "", "")
+	require.NoError(t, err)
+	require.Nil(t, builtIn)
+}
@@ -0,0 +1,537 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	afjwt "github.com/hyperledger/aries-framework-go/pkg/doc/jwt"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/presexch"
+	sigverifier "github.com/hyperledger/aries-framework-go/pkg/doc/signature/verifier"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
+	vdrapi "github.com/hyperledger/aries-framework-go/pkg/framework/aries/api/vdr"
+	"github.com/piprate/json-gold/ld"
+	"github.com/square/go-jose/jwt"
+)
+
+// presentation verification checks.
+const (
+	stateCheck                  = "state"
+	idTokenSignatureCheck       = "id_token signature"
+	idTokenSubjectCheck         = "id_token subject"
+	nonceCheck                  = "nonce"
+	presentationProofCheck      = "presentation proof"
+	challengeAndDomainCheck     = "challenge and domain"
+	credentialProofsCheck       = "credential proofs"
+	credentialStatusCheck       = "credential status"
+	presentationDefinitionCheck = "presentation definition"
+	credentialApplicationCheck  = "credential application"
+)
+
+// presentationCheck is the outcome of a single check performed on a received presentation.
+type presentationCheck struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+// Passed returns true if the check succeeded.
+func (c *presentationCheck) Passed() bool {
+	return c.Error == ""
+}
+
+// presentationVerification is the outcome of all checks performed on a received presentation.
+type presentationVerification struct {
+	Checks []*presentationCheck `json:"checks"`
+}
+
+// Verified returns true if every check succeeded.
+func (r *presentationVerification) Verified() bool {
+	for _, check := range r.Checks {
+		if !check.Passed() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Error returns the failed checks joined into a single message.
+func (r *presentationVerification) Error() string {
+	var failures []string
+
+	for _, check := range r.Checks {
+		if !check.Passed() {
+			failures = append(failures, fmt.Sprintf("%s : %s", check.Name, check.Error))
+		}
+	}
+
+	return strings.Join(failures, "; ")
+}
+
+func (r *presentationVerification) add(name string, err error) bool {
+	check := &presentationCheck{Name: name}
+
+	if err != nil {
+		check.Error = err.Error()
+	}
+
+	r.Checks = append(r.Checks, check)
+
+	return err == nil
+}
+
+// presentationRequest holds what the verifier asked the holder to present.
+type presentationRequest struct {
+	Definition *presexch.PresentationDefinition
+	Challenge  string
+	Domain     string
+	// Submission, if set, is evaluated instead of the presentation_submission embedded in the presentation.
+	Submission *presexch.PresentationSubmission
+}
+
+// presentationVerifier verifies presentations received from wallets by resolving signer DIDs through the agent's VDRs.
+type presentationVerifier struct {
+	vdr            vdrapi.Registry
+	documentLoader ld.DocumentLoader
+	// httpClient fetches status list credentials.
+	httpClient *http.Client
+}
+
+func newPresentationVerifier(vdr vdrapi.Registry, documentLoader ld.DocumentLoader) *presentationVerifier {
+	return &presentationVerifier{
+		vdr:            vdr,
+		documentLoader: documentLoader,
+		httpClient: &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec // demo issuers use test certs
+		}},
+	}
+}
+
+// verify checks presentation and credential proofs, the challenge and domain issued to the holder and statuses of
+// the credentials and evaluates the presentation against the requested presentation definition.
+func (pv *presentationVerifier) verify(vpBytes []byte,
+	req *presentationRequest) (*verifiable.Presentation, *presentationVerification) {
+	result := &presentationVerification{}
+
+	vpBytes, jws := readPresentationJWS(vpBytes)
+
+	vp, err := pv.parsePresentation(vpBytes)
+	if !result.add(presentationProofCheck, err) {
+		return nil, result
+	}
+
+	result.add(challengeAndDomainCheck, checkChallengeAndDomain(vp, jws, req.Challenge, req.Domain))
+	result.add(credentialProofsCheck, pv.checkCredentialProofs(vp, acceptedProofTypes(req.Definition)))
+	result.add(credentialStatusCheck, pv.checkCredentialStatuses(vp))
+	result.add(presentationDefinitionCheck, pv.matchDefinition(vp, req))
+
+	return vp, result
+}
+
+// verifyJWT checks the signature of a JWT signed with a DID key. The DID is taken from the "kid" header when it is a
+// DID URL, otherwise from the issuer claim.
+func (pv *presentationVerifier) verifyJWT(token string) (*afjwt.JSONWebToken, error) {
+	fetcher := verifiable.NewVDRKeyResolver(pv.vdr).PublicKeyFetcher()
+
+	jwt, err := afjwt.Parse(token, afjwt.WithSignatureVerifier(afjwt.NewVerifier(afjwt.KeyResolverFunc(
+		func(issuer, kid string) (*sigverifier.PublicKey, error) {
+			signerDID, keyID := issuer, kid
+
+			if parts := strings.SplitN(kid, "#", 2); len(parts) == 2 {
+				if parts[0] != "" {
+					signerDID = parts[0]
+				}
+
+				keyID = "#" + parts[1]
+			}
+
+			return fetcher(signerDID, keyID)
+		}))))
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify JWT : %w", err)
+	}
+
+	return jwt, nil
+}
+
+// checkIDTokenSubject checks that the verified id_token is signed by its subject, who holds the presentation.
+func checkIDTokenSubject(idToken *afjwt.JSONWebToken, vp *verifiable.Presentation) error {
+	signerDID := jwtSignerDID(idToken)
+
+	if sub, _ := idToken.Payload["sub"].(string); sub != "" && sub != signerDID {
+		return fmt.Errorf("id_token subject %s is not its signer %s", sub, signerDID)
+	}
+
+	holderDID := presentationHolderDID(vp)
+	if holderDID != signerDID {
+		return fmt.Errorf("id_token is signed by %s, presentation is held by %q", signerDID, holderDID)
+	}
+
+	return nil
+}
+
+// jwtSignerDID returns DID of the key a JWT is signed with, taken the way verifyJWT resolves the key.
+func jwtSignerDID(token *afjwt.JSONWebToken) string {
+	if kid, ok := token.Headers.KeyID(); ok {
+		if parts := strings.SplitN(kid, "#", 2); len(parts) == 2 && parts[0] != "" {
+			return parts[0]
+		}
+	}
+
+	iss, _ := token.Payload["iss"].(string)
+
+	return iss
+}
+
+// presentationHolderDID returns the holder of the presentation, or DID of the key of its first proof if the holder
+// is not set.
+func presentationHolderDID(vp *verifiable.Presentation) string {
+	if vp.Holder != "" {
+		return vp.Holder
+	}
+
+	for _, proof := range vp.Proofs {
+		if method, ok := proof["verificationMethod"].(string); ok {
+			return strings.SplitN(method, "#", 2)[0]
+		}
+	}
+
+	return ""
+}
+
+func (pv *presentationVerifier) matchDefinition(vp *verifiable.Presentation, req *presentationRequest) error {
+	if req.Submission != nil {
+		// evaluate a copy carrying the submission received out of band, e.g. in an OIDC id_token.
+		submitted := *vp
+		submitted.Context = append(append([]string{}, vp.Context...), presexch.PresentationSubmissionJSONLDContextIRI)
+		submitted.Type = append(append([]string{}, vp.Type...), presexch.PresentationSubmissionJSONLDType)
+		submitted.CustomFields = verifiable.CustomFields{}
+
+		for k, val := range vp.CustomFields {
+			submitted.CustomFields[k] = val
+		}
+
+		subBytes, err := json.Marshal(req.Submission)
+		if err != nil {
+			return fmt.Errorf("failed to marshal presentation submission : %w", err)
+		}
+
+		var subMap map[string]interface{}
+
+		err = json.Unmarshal(subBytes, &subMap)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal presentation submission : %w", err)
+		}
+
+		submitted.CustomFields["presentation_submission"] = subMap
+		vp = &submitted
+	}
+
+	_, err := req.Definition.Match(vp, pv.documentLoader, presexch.WithCredentialOptions(
+		verifiable.WithJSONLDDocumentLoader(pv.documentLoader), verifiable.WithDisabledProofCheck()))
+
+	return err
+}
+
+func (pv *presentationVerifier) parsePresentation(vpBytes []byte) (*verifiable.Presentation, error) {
+	vp, err := verifiable.ParsePresentation(vpBytes,
+		verifiable.WithPresPublicKeyFetcher(verifiable.NewVDRKeyResolver(pv.vdr).PublicKeyFetcher()),
+		verifiable.WithPresJSONLDDocumentLoader(pv.documentLoader))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse presentation : %w", err)
+	}
+
+	if !isJWS(vpBytes) && len(vp.Proofs) == 0 {
+		return nil, errors.New("presentation is not signed")
+	}
+
+	for _, proof := range vp.Proofs {
+		if proofType, _ := proof["type"].(string); !contains(supportedProofTypes, proofType) {
+			return nil, fmt.Errorf("unsupported presentation proof type %s", proofType)
+		}
+	}
+
+	return vp, nil
+}
+
+// checkCredentialProofs verifies proofs of credentials in the presentation, linked data proofs must be of one of
+// given types.
+func (pv *presentationVerifier) checkCredentialProofs(vp *verifiable.Presentation, proofTypes []string) error {
+	for _, raw := range vp.Credentials() {
+		vcBytes, err := credentialBytes(raw)
+		if err != nil {
+			return err
+		}
+
+		vc, err := verifiable.ParseCredential(vcBytes,
+			verifiable.WithPublicKeyFetcher(verifiable.NewVDRKeyResolver(pv.vdr).PublicKeyFetcher()),
+			verifiable.WithJSONLDDocumentLoader(pv.documentLoader))
+		if err != nil {
+			return fmt.Errorf("failed to verify credential : %w", err)
+		}
+
+		if !isJWS(vcBytes) && len(vc.Proofs) == 0 {
+			return fmt.Errorf("credential %s is not signed", vc.ID)
+		}
+
+		for _, proof := range vc.Proofs {
+			if proofType, _ := proof["type"].(string); !contains(proofTypes, proofType) {
+				return fmt.Errorf("credential %s proof type %s is not one of requested %v", vc.ID, proofType,
+					proofTypes)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkCredentialStatuses rejects presentations of revoked or suspended credentials, statuses of StatusList2021
+// entries are read from status list credentials of the issuers.
+func (pv *presentationVerifier) checkCredentialStatuses(vp *verifiable.Presentation) error {
+	for _, raw := range vp.Credentials() {
+		vcBytes, err := credentialBytes(raw)
+		if err != nil {
+			return err
+		}
+
+		vc, err := verifiable.ParseCredential(vcBytes, verifiable.WithDisabledProofCheck(),
+			verifiable.WithJSONLDDocumentLoader(pv.documentLoader))
+		if err != nil {
+			return fmt.Errorf("failed to parse credential : %w", err)
+		}
+
+		if vc.Status == nil || vc.Status.Type != statusList2021EntryType {
+			continue
+		}
+
+		set, err := pv.statusListBit(vc)
+		if err != nil {
+			return fmt.Errorf("failed to check status of credential %s : %w", vc.ID, err)
+		}
+
+		if set {
+			status := credentialStatusRevoked
+			if vc.Status.CustomFields["statusPurpose"] == statusPurposeSuspension {
+				status = credentialStatusSuspended
+			}
+
+			return fmt.Errorf("credential %s is %s", vc.ID, status)
+		}
+	}
+
+	return nil
+}
+
+// statusListBit fetches status list credential of the credential status entry and returns the bit of the credential.
+func (pv *presentationVerifier) statusListBit(vc *verifiable.Credential) (bool, error) {
+	purpose, _ := vc.Status.CustomFields["statusPurpose"].(string)
+	listURL, _ := vc.Status.CustomFields["statusListCredential"].(string)
+
+	var index int
+
+	switch i := vc.Status.CustomFields["statusListIndex"].(type) {
+	case string:
+		var err error
+
+		index, err = strconv.Atoi(i)
+		if err != nil {
+			return false, fmt.Errorf("invalid statusListIndex : %w", err)
+		}
+	case float64:
+		index = int(i)
+	default:
+		return false, errors.New("statusListIndex is required")
+	}
+
+	listVC, err := pv.fetchStatusListCredential(listURL)
+	if err != nil {
+		return false, err
+	}
+
+	if listVC.Issuer.ID != vc.Issuer.ID {
+		return false, fmt.Errorf("status list is issued by %s", listVC.Issuer.ID)
+	}
+
+	subjects, ok := listVC.Subject.([]verifiable.Subject)
+	if !ok || len(subjects) != 1 {
+		return false, errors.New("status list credential must have one subject")
+	}
+
+	if listPurpose, _ := subjects[0].CustomFields["statusPurpose"].(string); listPurpose != purpose {
+		return false, fmt.Errorf("status list purpose %s does not match entry purpose %s", listPurpose, purpose)
+	}
+
+	encodedList, _ := subjects[0].CustomFields["encodedList"].(string)
+
+	bits, err := decodeStatusList(encodedList)
+	if err != nil {
+		return false, err
+	}
+
+	if index < 0 || index >= len(bits)*8 {
+		return false, fmt.Errorf("statusListIndex %d is out of status list", index)
+	}
+
+	return statusBit(bits, index), nil
+}
+
+func (pv *presentationVerifier) fetchStatusListCredential(listURL string) (*verifiable.Credential, error) {
+	resp, err := pv.httpClient.Get(listURL) //nolint:noctx // status lists are fetched during verification only
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch status list : %w", err)
+	}
+
+	defer resp.Body.Close() //nolint:errcheck // response is read fully
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch status list : status %d", resp.StatusCode)
+	}
+
+	listBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read status list : %w", err)
+	}
+
+	listVC, err := verifiable.ParseCredential(listBytes,
+		verifiable.WithPublicKeyFetcher(verifiable.NewVDRKeyResolver(pv.vdr).PublicKeyFetcher()),
+		verifiable.WithJSONLDDocumentLoader(pv.documentLoader))
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify status list credential : %w", err)
+	}
+
+	if !contains(listVC.Types, statusList2021CredentialType) {
+		return nil, fmt.Errorf("%s is not a %s", listURL, statusList2021CredentialType)
+	}
+
+	return listVC, nil
+}
+
+// credentialBytes returns credential of a presentation as JSON or as compact JWS.
+func credentialBytes(raw interface{}) ([]byte, error) {
+	if jws, ok := raw.(string); ok {
+		return []byte(jws), nil
+	}
+
+	vcBytes, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal credential : %w", err)
+	}
+
+	return vcBytes, nil
+}
+
+// acceptedProofTypes returns proof types of linked data credentials accepted by the presentation definition,
+// definitions without ldp_vc format accept all supported proof types.
+func acceptedProofTypes(pd *presexch.PresentationDefinition) []string {
+	if pd != nil && pd.Format != nil && pd.Format.LdpVC != nil {
+		return pd.Format.LdpVC.ProofType
+	}
+
+	if pd != nil && pd.Format != nil && pd.Format.Ldp != nil {
+		return pd.Format.Ldp.ProofType
+	}
+
+	return supportedProofTypes
+}
+
+// requestSelectiveDisclosure makes presentation definition request credentials disclosing only the constrained
+// fields, derived from BBS+ signed credentials.
+func requestSelectiveDisclosure(pd *presexch.PresentationDefinition) {
+	if pd.Format == nil {
+		pd.Format = &presexch.Format{}
+	}
+
+	// wallets select credentials to derive proofs from by ldp_vp proof types.
+	pd.Format.LdpVP = &presexch.LdpType{ProofType: []string{bbsBlsSignature2020}}
+	pd.Format.LdpVC = &presexch.LdpType{ProofType: []string{bbsBlsSignatureProof2020}}
+
+	required := presexch.Required
+
+	for _, descriptor := range pd.InputDescriptors {
+		if descriptor.Constraints == nil {
+			descriptor.Constraints = &presexch.Constraints{}
+		}
+
+		descriptor.Constraints.LimitDisclosure = &required
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func checkChallengeAndDomain(vp *verifiable.Presentation, jws, challenge, domain string) error {
+	if jws != "" {
+		token, err := jwt.ParseSigned(jws)
+		if err != nil {
+			return fmt.Errorf("failed to parse presentation JWT : %w", err)
+		}
+
+		// signature is already verified while parsing the presentation.
+		claims := jwt.Claims{}
+		extra := struct {
+			Nonce string `json:"nonce"`
+		}{}
+
+		err = token.UnsafeClaimsWithoutVerification(&claims, &extra)
+		if err != nil {
+			return fmt.Errorf("failed to read presentation JWT claims : %w", err)
+		}
+
+		if extra.Nonce != challenge {
+			return fmt.Errorf("nonce %q does not match challenge %q", extra.Nonce, challenge)
+		}
+
+		if domain != "" && !claims.Audience.Contains(domain) {
+			return fmt.Errorf("audience %v does not contain domain %q", claims.Audience, domain)
+		}
+
+		return nil
+	}
+
+	for _, proof := range vp.Proofs {
+		if proof["challenge"] == challenge && (domain == "" || proof["domain"] == domain) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no presentation proof with challenge %q and domain %q", challenge, domain)
+}
+
+// readPresentationJWS returns the presentation and its compact JWS if it is a JWT presentation. JWT presentations
+// may be attached as JSON strings or sent as they are, e.g. in the vp_token of an OIDC response.
+func readPresentationJWS(vpBytes []byte) ([]byte, string) {
+	var jws string
+	if json.Unmarshal(vpBytes, &jws) == nil {
+		return []byte(jws), jws
+	}
+
+	if isJWS(vpBytes) {
+		jws = strings.TrimSpace(string(vpBytes))
+
+		return []byte(jws), jws
+	}
+
+	return vpBytes, ""
+}
+
+func isJWS(data []byte) bool {
+	return !strings.HasPrefix(strings.TrimSpace(string(data)), "{")
+}
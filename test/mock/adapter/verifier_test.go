@@ -0,0 +1,387 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/tls"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/jose"
+	afjwt "github.com/hyperledger/aries-framework-go/pkg/doc/jwt"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/presexch"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/jsonld"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite/ed25519signature2018"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/key"
+	"github.com/piprate/json-gold/ld"
+	"github.com/stretchr/testify/require"
+)
+
+const testCredential = `{
+	"@context": ["https://www.w3.org/2018/credentials/v1"],
+	"id": "http://example.gov/credentials/3732",
+	"type": ["VerifiableCredential"],
+	"issuer": "did:key:z6MknC1wwS6DEYwtGbZZo2QvjQjkh2qSBjb4GYmbye8dv4S5",
+	"issuanceDate": "2020-03-16T22:37:26.544Z",
+	"credentialSubject": {"id": "did:example:ebfeb1f712ebc6f1c276e12ec21"}
+}`
+
+func TestPresentationVerifier(t *testing.T) {
+	loader := testDocumentLoader(t)
+	pv := newPresentationVerifier(vdr.New(vdr.WithVDR(key.New())), loader)
+
+	pd := &presexch.PresentationDefinition{
+		ID: "pd-1",
+		InputDescriptors: []*presexch.InputDescriptor{{
+			ID:     "vc",
+			Schema: []*presexch.Schema{{URI: "https://www.w3.org/2018/credentials#VerifiableCredential"}},
+		}},
+	}
+
+	t.Run("success", func(t *testing.T) {
+		vpBytes := createTestPresentation(t, loader, pd, "challenge", "domain", true)
+
+		vp, result := pv.verify(vpBytes, &presentationRequest{Definition: pd, Challenge: "challenge", Domain: "domain"})
+		require.NotNil(t, vp)
+		require.True(t, result.Verified(), result.Error())
+		require.Len(t, result.Checks, 5)
+	})
+
+	t.Run("challenge mismatch", func(t *testing.T) {
+		vpBytes := createTestPresentation(t, loader, pd, "other", "domain", true)
+
+		_, result := pv.verify(vpBytes, &presentationRequest{Definition: pd, Challenge: "challenge", Domain: "domain"})
+		require.False(t, result.Verified())
+		require.Contains(t, result.Error(), challengeAndDomainCheck)
+	})
+
+	t.Run("unsigned credential", func(t *testing.T) {
+		vpBytes := createTestPresentation(t, loader, pd, "challenge", "domain", false)
+
+		_, result := pv.verify(vpBytes, &presentationRequest{Definition: pd, Challenge: "challenge", Domain: "domain"})
+		require.False(t, result.Verified())
+		require.Contains(t, result.Error(), credentialProofsCheck)
+	})
+
+	t.Run("presentation definition mismatch", func(t *testing.T) {
+		vpBytes := createTestPresentation(t, loader, pd, "challenge", "domain", true)
+
+		other := &presexch.PresentationDefinition{
+			ID: "pd-2",
+			InputDescriptors: []*presexch.InputDescriptor{{
+				ID:     "prc",
+				Schema: []*presexch.Schema{{URI: "https://w3id.org/citizenship#PermanentResidentCard"}},
+			}},
+		}
+
+		_, result := pv.verify(vpBytes, &presentationRequest{Definition: other, Challenge: "challenge", Domain: "domain"})
+		require.False(t, result.Verified())
+		require.Contains(t, result.Error(), presentationDefinitionCheck)
+	})
+
+	t.Run("JWT presentation", func(t *testing.T) {
+		jws := createTestJWTPresentation(t, loader, pd, "challenge", "domain")
+
+		// vp_token of OIDC responses is the compact JWS itself, DIDComm attachments hold it as a JSON string.
+		for _, vpBytes := range [][]byte{[]byte(jws), []byte(`"` + jws + `"`)} {
+			_, result := pv.verify(vpBytes, &presentationRequest{Definition: pd, Challenge: "challenge", Domain: "domain"})
+			require.True(t, result.Verified(), result.Error())
+			require.Len(t, result.Checks, 5)
+
+			_, result = pv.verify(vpBytes, &presentationRequest{Definition: pd, Challenge: "other", Domain: "domain"})
+			require.False(t, result.Verified())
+			require.Contains(t, result.Error(), challengeAndDomainCheck)
+		}
+	})
+
+	t.Run("unsigned presentation", func(t *testing.T) {
+		_, result := pv.verify([]byte(`{
+			"@context": ["https://www.w3.org/2018/credentials/v1"],
+			"type": ["VerifiablePresentation"]
+		}`), &presentationRequest{Definition: pd, Challenge: "challenge", Domain: "domain"})
+		require.False(t, result.Verified())
+		require.Len(t, result.Checks, 1)
+		require.Contains(t, result.Error(), "presentation is not signed")
+	})
+}
+
+func TestPresentationVerifier_Submission(t *testing.T) {
+	loader := testDocumentLoader(t)
+	pv := newPresentationVerifier(vdr.New(vdr.WithVDR(key.New())), loader)
+
+	pd := &presexch.PresentationDefinition{
+		ID: "pd-1",
+		InputDescriptors: []*presexch.InputDescriptor{{
+			ID:     "vc",
+			Schema: []*presexch.Schema{{URI: "https://www.w3.org/2018/credentials#VerifiableCredential"}},
+		}},
+	}
+
+	submission := &presexch.PresentationSubmission{
+		ID:           "sub-1",
+		DefinitionID: pd.ID,
+		DescriptorMap: []*presexch.InputDescriptorMapping{{
+			ID:     "vc",
+			Format: "ldp_vc",
+			Path:   "$.verifiableCredential[0]",
+		}},
+	}
+
+	vc, err := verifiable.ParseCredential([]byte(testCredential), verifiable.WithJSONLDDocumentLoader(loader))
+	require.NoError(t, err)
+	require.NoError(t, vc.AddLinkedDataProof(testProofContext("assertionMethod", "", ""),
+		jsonld.WithDocumentLoader(loader)))
+
+	vp, err := verifiable.NewPresentation(verifiable.WithCredentials(vc))
+	require.NoError(t, err)
+	require.NoError(t, vp.AddLinkedDataProof(testProofContext("authentication", "nonce", ""),
+		jsonld.WithDocumentLoader(loader)))
+
+	vpBytes, err := vp.MarshalJSON()
+	require.NoError(t, err)
+
+	t.Run("submission received out of band", func(t *testing.T) {
+		_, result := pv.verify(vpBytes, &presentationRequest{Definition: pd, Challenge: "nonce", Submission: submission})
+		require.True(t, result.Verified(), result.Error())
+	})
+
+	t.Run("missing submission", func(t *testing.T) {
+		_, result := pv.verify(vpBytes, &presentationRequest{Definition: pd, Challenge: "nonce"})
+		require.False(t, result.Verified())
+		require.Contains(t, result.Error(), presentationDefinitionCheck)
+	})
+}
+
+func TestPresentationVerifier_SelectiveDisclosure(t *testing.T) {
+	app := newTestAdapterApp(t)
+	loader := testDocumentLoader(t)
+	keyVDR := vdr.New(vdr.WithVDR(key.New()))
+	pv := newPresentationVerifier(keyVDR, loader)
+
+	bbsKey, err := app.createIssuerKey("bls12381g2", didMethodKey, "", "issuer-1")
+	require.NoError(t, err)
+
+	signer, err := app.issuerSigner(bbsKey, nil)
+	require.NoError(t, err)
+
+	pd := &presexch.PresentationDefinition{
+		ID: "pd-1",
+		InputDescriptors: []*presexch.InputDescriptor{{
+			ID:     "vc",
+			Schema: []*presexch.Schema{{URI: "https://www.w3.org/2018/credentials#VerifiableCredential"}},
+			Constraints: &presexch.Constraints{
+				Fields: []*presexch.Field{{Path: []string{"$.credentialSubject.id"}}},
+			},
+		}},
+	}
+	requestSelectiveDisclosure(pd)
+	require.Equal(t, []string{bbsBlsSignatureProof2020}, acceptedProofTypes(pd))
+
+	t.Run("derived proof", func(t *testing.T) {
+		vc, err := verifiable.ParseCredential([]byte(testCredential), verifiable.WithJSONLDDocumentLoader(loader))
+		require.NoError(t, err)
+
+		signer.setIssuer(vc)
+		require.NoError(t, signCredential(vc, signer, loader))
+
+		// limit_disclosure makes presentation definition derive BBS+ proofs of BBS+ signed credentials.
+		vp, err := pd.CreateVP([]*verifiable.Credential{vc}, loader, verifiable.WithJSONLDDocumentLoader(loader),
+			verifiable.WithPublicKeyFetcher(verifiable.NewVDRKeyResolver(keyVDR).PublicKeyFetcher()))
+		require.NoError(t, err)
+
+		require.NoError(t, vp.AddLinkedDataProof(testProofContext("authentication", "challenge", ""),
+			jsonld.WithDocumentLoader(loader)))
+
+		vpBytes, err := vp.MarshalJSON()
+		require.NoError(t, err)
+
+		_, result := pv.verify(vpBytes, &presentationRequest{Definition: pd, Challenge: "challenge"})
+		require.True(t, result.Verified(), result.Error())
+		require.Contains(t, string(vpBytes), bbsBlsSignatureProof2020)
+	})
+
+	t.Run("credential without derived proof", func(t *testing.T) {
+		vpBytes := createTestPresentation(t, loader, &presexch.PresentationDefinition{
+			ID:               "pd-1",
+			InputDescriptors: pd.InputDescriptors,
+		}, "challenge", "", true)
+
+		_, result := pv.verify(vpBytes, &presentationRequest{Definition: pd, Challenge: "challenge"})
+		require.False(t, result.Verified())
+		require.Contains(t, result.Error(), credentialProofsCheck)
+	})
+}
+
+func TestPresentationVerifier_VerifyJWT(t *testing.T) {
+	pv := newPresentationVerifier(vdr.New(vdr.WithVDR(key.New())), testDocumentLoader(t))
+
+	claims := map[string]interface{}{"iss": "https://self-issued.me/v2", "sub": didKey, "nonce": "nonce"}
+
+	t.Run("signed by holder DID", func(t *testing.T) {
+		token, err := afjwt.NewSigned(claims, nil, &testJWTSigner{kid: kid})
+		require.NoError(t, err)
+
+		jws, err := token.Serialize(false)
+		require.NoError(t, err)
+
+		_, err = pv.verifyJWT(jws)
+		require.NoError(t, err)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		token, err := afjwt.NewSigned(claims, nil, &testJWTSigner{kid: didKey + "#unknown"})
+		require.NoError(t, err)
+
+		jws, err := token.Serialize(false)
+		require.NoError(t, err)
+
+		_, err = pv.verifyJWT(jws)
+		require.Error(t, err)
+	})
+
+	t.Run("unsecured", func(t *testing.T) {
+		token, err := afjwt.NewUnsecured(claims, nil)
+		require.NoError(t, err)
+
+		jws, err := token.Serialize(false)
+		require.NoError(t, err)
+
+		_, err = pv.verifyJWT(jws)
+		require.Error(t, err)
+	})
+}
+
+func TestCheckIDTokenSubject(t *testing.T) {
+	vp := &verifiable.Presentation{Proofs: []verifiable.Proof{{"type": "Ed25519Signature2018",
+		"verificationMethod": kid}}}
+
+	idToken := func(t *testing.T, sub, signerKID string) *afjwt.JSONWebToken {
+		t.Helper()
+
+		token, err := afjwt.NewSigned(map[string]interface{}{"iss": "https://self-issued.me/v2", "sub": sub},
+			nil, &testJWTSigner{kid: signerKID})
+		require.NoError(t, err)
+
+		return token
+	}
+
+	t.Run("same subject", func(t *testing.T) {
+		require.NoError(t, checkIDTokenSubject(idToken(t, didKey, kid), vp))
+	})
+
+	t.Run("subject is not the signer", func(t *testing.T) {
+		err := checkIDTokenSubject(idToken(t, "did:example:other", kid), vp)
+		require.Contains(t, err.Error(), "is not its signer")
+	})
+
+	t.Run("presentation of another holder", func(t *testing.T) {
+		held := *vp
+		held.Holder = "did:example:other"
+
+		err := checkIDTokenSubject(idToken(t, didKey, kid), &held)
+		require.Contains(t, err.Error(), "presentation is held by \"did:example:other\"")
+	})
+
+	t.Run("signed with another key", func(t *testing.T) {
+		err := checkIDTokenSubject(idToken(t, "did:example:other", "did:example:other#key-1"), vp)
+		require.Contains(t, err.Error(), "id_token is signed by did:example:other")
+	})
+}
+
+type testJWTSigner struct {
+	kid string
+}
+
+func (s *testJWTSigner) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(ed25519.PrivateKey(base58.Decode(pkBase58)), data), nil
+}
+
+func (s *testJWTSigner) Headers() jose.Headers {
+	return jose.Headers{jose.HeaderAlgorithm: "EdDSA", jose.HeaderKeyID: s.kid}
+}
+
+func testDocumentLoader(t *testing.T) ld.DocumentLoader {
+	t.Helper()
+
+	loader, err := createJSONLDDocumentLoader(mem.NewProvider(), &tls.Config{MinVersion: tls.VersionTLS12}, "")
+	require.NoError(t, err)
+
+	return loader
+}
+
+func createTestPresentation(t *testing.T, loader ld.DocumentLoader, pd *presexch.PresentationDefinition,
+	challenge, domain string, signCredential bool) []byte {
+	t.Helper()
+
+	vc, err := verifiable.ParseCredential([]byte(testCredential), verifiable.WithJSONLDDocumentLoader(loader))
+	require.NoError(t, err)
+
+	if signCredential {
+		require.NoError(t, vc.AddLinkedDataProof(testProofContext("assertionMethod", "", ""),
+			jsonld.WithDocumentLoader(loader)))
+	}
+
+	vp, err := pd.CreateVP([]*verifiable.Credential{vc}, loader, verifiable.WithJSONLDDocumentLoader(loader),
+		verifiable.WithDisabledProofCheck())
+	require.NoError(t, err)
+
+	require.NoError(t, vp.AddLinkedDataProof(testProofContext("authentication", challenge, domain),
+		jsonld.WithDocumentLoader(loader)))
+
+	vpBytes, err := vp.MarshalJSON()
+	require.NoError(t, err)
+
+	return vpBytes
+}
+
+// createTestJWTPresentation returns the test presentation as a compact JWT signed by the holder with given nonce and
+// audience.
+func createTestJWTPresentation(t *testing.T, loader ld.DocumentLoader, pd *presexch.PresentationDefinition,
+	nonce, audience string) string {
+	t.Helper()
+
+	var vp map[string]interface{}
+	require.NoError(t, json.Unmarshal(createTestPresentation(t, loader, pd, "", "", true), &vp))
+
+	delete(vp, "proof")
+
+	token, err := afjwt.NewSigned(map[string]interface{}{
+		"iss":   didKey,
+		"aud":   audience,
+		"nonce": nonce,
+		"vp":    vp,
+	}, nil, &testJWTSigner{kid: kid})
+	require.NoError(t, err)
+
+	jws, err := token.Serialize(false)
+	require.NoError(t, err)
+
+	return jws
+}
+
+func testProofContext(purpose, challenge, domain string) *verifiable.LinkedDataProofContext {
+	created := time.Now()
+
+	return &verifiable.LinkedDataProofContext{
+		SignatureType:           "Ed25519Signature2018",
+		SignatureRepresentation: verifiable.SignatureProofValue,
+		Suite: ed25519signature2018.New(suite.WithSigner(
+			&edd25519Signer{privateKey: ed25519.PrivateKey(base58.Decode(pkBase58))})),
+		VerificationMethod: kid,
+		Purpose:            purpose,
+		Challenge:          challenge,
+		Domain:             domain,
+		Created:            &created,
+	}
+}